@@ -1,36 +1,182 @@
+import math
 import pandas as pd
 from sqlalchemy.orm import Session
 from sqlalchemy import text
 import datetime
-import os
 
 # Constantes de Negocio
 # Según estándares FDA/HACCP, si un alimento perecedero permanece en la "Zona de Peligro"
 # por más de 4 horas, se considera no apto para el consumo (Pérdida Total).
 CRITICAL_EXPOSURE_LIMIT_HOURS = 4.0
-ASSUMED_INVENTORY_KG = 200.0
 
-def get_average_meat_price():
+# Temperatura cinética media (MKT): constante de los gases en J/(mol·K) y energía de
+# activación de referencia de USP <1079> en kJ/mol (se configura por categoría en product_categories)
+GAS_CONSTANT = 8.3144598
+DEFAULT_ACTIVATION_ENERGY = 83.144
+
+# Hasta este rango las métricas térmicas usan las lecturas crudas; en rangos mayores, agregados por hora
+RAW_RANGE_LIMIT_HOURS = 48
+# Un tramo sin lecturas más largo que esto no se integra (igual que las excursiones del Backend Go)
+MAX_GAP_MINUTES = 30
+
+# Mismas palabras clave que categoryKeywords en el Backend Go, para cámaras sin categoría explícita
+CATEGORY_KEYWORDS = [
+    ("frozen_meat", ["carne", "pollo", "pescado", "mariscos", "congelad"]),
+    ("dairy", ["lácteo", "lacteo", "leche", "queso", "yogur", "mantequilla"]),
+    ("vegetables", ["vegetal", "verdura", "hortaliza", "fruta"]),
+]
+
+def get_chamber_inventory(db: Session, sensor_id: str, at=None):
     """
-    Lee el archivo de precios de mercado generado por el scraper y calcula el promedio.
-    Si no existe, retorna un valor por defecto.
+    Contenido de la cámara en el instante `at` (por defecto ahora), a partir de
+    los movimientos de stock registrados. Se valora al precio vigente de cada producto.
+    Retorna (valor_total, descripción); sin inventario registrado, (0.0, None).
     """
-    csv_path = "../datos/precios_mercado.csv"
-    
-    # Intentar ruta relativa desde la carpeta analytics
-    if not os.path.exists(csv_path):
-        # Fallback para ejecución desde tests
-        csv_path = "../../datos/precios_mercado.csv"
-
-    if os.path.exists(csv_path):
-        try:
-            df = pd.read_csv(csv_path)
-            if not df.empty and 'precio_kg' in df.columns:
-                return df['precio_kg'].mean()
-        except Exception as e:
-            print(f"Error leyendo precios de mercado: {e}")
-            
-    return 25.50 # Precio default (aprox $25/kg)
+    query = text("""
+        SELECT p.name, p.price_per_kg,
+               SUM(CASE WHEN m.type = 'out' THEN -m.quantity_kg ELSE m.quantity_kg END) AS quantity
+        FROM stock_movements m
+        JOIN products p ON p.id = m.product_id
+        WHERE m.sensor_id = :sensor_id
+        AND m.moved_at <= :at
+        GROUP BY p.id, p.name, p.price_per_kg
+        HAVING quantity > 0
+        ORDER BY quantity * p.price_per_kg DESC, p.name
+    """)
+
+    rows = db.execute(query, {"sensor_id": sensor_id, "at": at or datetime.datetime.now()}).fetchall()
+    if not rows:
+        return 0.0, None
+
+    total_value = sum(float(row[1]) * float(row[2]) for row in rows)
+    content = ", ".join(f"{row[0]} {float(row[2]):.1f} kg" for row in rows)
+    return total_value, content
+
+def get_chamber_category(content, product_category):
+    """
+    Categoría de producto de la cámara; sin categoría registrada se deduce de su contenido.
+    """
+    if product_category:
+        return product_category
+    content = (content or "").lower()
+    for category, keywords in CATEGORY_KEYWORDS:
+        if any(kw in content for kw in keywords):
+            return category
+    return "general"
+
+def _arrhenius(temp_c, activation_energy):
+    return math.exp(-activation_energy * 1000.0 / (GAS_CONSTANT * (temp_c + 273.15)))
+
+def _mean_kinetic_temperature(weighted, minutes, activation_energy):
+    """
+    MKT en °C a partir de la suma ponderada de factores de Arrhenius (Σ minutos · e^(-ΔH/RT)).
+    """
+    if minutes <= 0 or weighted <= 0:
+        return None
+    kelvin = activation_energy * 1000.0 / GAS_CONSTANT / -math.log(weighted / minutes)
+    return kelvin - 273.15
+
+def get_thermal_metrics(db: Session, sensor_id: str, start=None, end=None, timeframe_minutes: int = 30):
+    """
+    Temperatura cinética media y grados-minuto sobre los umbrales de warning y crítico en [start, end].
+    Sin rango, usa los últimos `timeframe_minutes` hasta la última lectura (igual que los KPIs).
+    Rangos de hasta RAW_RANGE_LIMIT_HOURS usan las lecturas crudas; los mayores, agregados por hora.
+    """
+    chamber = db.execute(text("""
+        SELECT content, product_category, warning_threshold, critical_threshold
+        FROM chambers
+        WHERE id = :sensor_id
+    """), {"sensor_id": sensor_id}).fetchone()
+    if chamber is None:
+        return None
+
+    category = get_chamber_category(chamber[0], chamber[1])
+    warning, critical = float(chamber[2]), float(chamber[3])
+    activation_energy = db.execute(
+        text("SELECT activation_energy FROM product_categories WHERE category = :category"),
+        {"category": category}
+    ).scalar()
+    activation_energy = float(activation_energy) if activation_energy else DEFAULT_ACTIVATION_ENERGY
+
+    if start is None or end is None:
+        end = db.execute(
+            text("SELECT MAX(timestamp) FROM temperature_readings WHERE sensor_id = :sensor_id AND quality = 'OK'"),
+            {"sensor_id": sensor_id}
+        ).scalar() or datetime.datetime.now()
+        start = end - datetime.timedelta(minutes=timeframe_minutes)
+
+    params = {"sensor_id": sensor_id, "start": start, "end": end, "warning": warning, "critical": critical}
+    weighted = covered = above_warning = above_critical = 0.0
+    temps = []
+    readings = 0
+
+    if (end - start) <= datetime.timedelta(hours=RAW_RANGE_LIMIT_HOURS):
+        source = "raw"
+        rows = db.execute(text("""
+            SELECT timestamp, temperature
+            FROM temperature_readings
+            WHERE sensor_id = :sensor_id AND quality = 'OK' AND timestamp BETWEEN :start AND :end
+            ORDER BY timestamp ASC
+        """), params).fetchall()
+        readings = len(rows)
+        temps = [float(row[1]) for row in rows]
+
+        # Cada tramo entre lecturas consecutivas se integra con la regla del trapecio
+        for (t0, temp0), (t1, temp1) in zip(rows, rows[1:]):
+            minutes = (t1 - t0).total_seconds() / 60.0
+            if minutes <= 0 or minutes > MAX_GAP_MINUTES:
+                continue
+            temp0, temp1 = float(temp0), float(temp1)
+            weighted += (_arrhenius(temp0, activation_energy) + _arrhenius(temp1, activation_energy)) / 2 * minutes
+            above_warning += (max(temp0 - warning, 0) + max(temp1 - warning, 0)) / 2 * minutes
+            above_critical += (max(temp0 - critical, 0) + max(temp1 - critical, 0)) / 2 * minutes
+            covered += minutes
+        if readings == 1:
+            weighted, covered = _arrhenius(temps[0], activation_energy), 1.0
+    else:
+        source = "hourly"
+        # Agregado por hora: cada hora pesa lo que cubren sus lecturas, con su promedio
+        rows = db.execute(text("""
+            SELECT AVG(temperature), MIN(temperature), MAX(temperature), COUNT(*),
+                   AVG(GREATEST(temperature - :warning, 0)), AVG(GREATEST(temperature - :critical, 0)),
+                   LEAST(GREATEST(TIMESTAMPDIFF(SECOND, MIN(timestamp), MAX(timestamp)) / 60.0, 1), 60)
+            FROM temperature_readings
+            WHERE sensor_id = :sensor_id AND quality = 'OK' AND timestamp BETWEEN :start AND :end
+            GROUP BY FLOOR(UNIX_TIMESTAMP(timestamp) / 3600)
+        """), params).fetchall()
+        for avg, low, high, count, excess_warning, excess_critical, minutes in rows:
+            minutes = float(minutes)
+            weighted += _arrhenius(float(avg), activation_energy) * minutes
+            above_warning += float(excess_warning) * minutes
+            above_critical += float(excess_critical) * minutes
+            covered += minutes
+            readings += count
+            temps += [float(low), float(high)]
+
+    mkt = _mean_kinetic_temperature(weighted, covered, activation_energy)
+    avg_temperature = None
+    if source == "raw" and temps:
+        avg_temperature = sum(temps) / len(temps)
+    elif rows:
+        avg_temperature = sum(float(row[0]) * row[3] for row in rows) / readings
+
+    return {
+        "start": start.isoformat(),
+        "end": end.isoformat(),
+        "source": source,
+        "readings": readings,
+        "covered_minutes": round(covered, 1),
+        "category": category,
+        "activation_energy": activation_energy,
+        "mkt": round(mkt, 2) if mkt is not None else None,
+        "min_temperature": min(temps) if temps else None,
+        "avg_temperature": round(avg_temperature, 2) if avg_temperature is not None else None,
+        "max_temperature": max(temps) if temps else None,
+        "warning_threshold": warning,
+        "critical_threshold": critical,
+        "degree_minutes_above_warning": round(above_warning, 2),
+        "degree_minutes_above_critical": round(above_critical, 2),
+    }
 
 def calculate_rate_of_change(db: Session, sensor_id: str, minutes: int = 30):
     """
@@ -40,6 +186,7 @@ def calculate_rate_of_change(db: Session, sensor_id: str, minutes: int = 30):
         SELECT temperature, timestamp 
         FROM temperature_readings 
         WHERE sensor_id = :sensor_id 
+        AND quality = 'OK'
         AND timestamp >= NOW() - INTERVAL :minutes MINUTE
         ORDER BY timestamp ASC
     """)
@@ -76,6 +223,7 @@ def get_chamber_kpis(db: Session, sensor_id: str, timeframe_minutes: int = 30):
         FROM temperature_readings tr
         JOIN chambers c ON tr.sensor_id = c.id
         WHERE tr.sensor_id = :sensor_id 
+        AND tr.quality = 'OK'
         ORDER BY tr.timestamp ASC
         LIMIT 2000
     """)
@@ -83,6 +231,7 @@ def get_chamber_kpis(db: Session, sensor_id: str, timeframe_minutes: int = 30):
     risk_rows = db.execute(query_raw_risk, {"sensor_id": sensor_id}).fetchall()
     
     hours_at_risk = 0.0
+    last_reading_time = None
     
     if risk_rows:
         df_risk = pd.DataFrame(risk_rows, columns=['timestamp', 'temperature', 'threshold'])
@@ -109,12 +258,14 @@ def get_chamber_kpis(db: Session, sensor_id: str, timeframe_minutes: int = 30):
             
             hours_at_risk = critical_periods['duration_hours'].sum()
 
-    # Obtener precio promedio del mercado real
-    avg_price_kg = get_average_meat_price()
+    # Valor del inventario real de la cámara al momento de la última lectura
+    inventory_value, affected_content = get_chamber_inventory(
+        db, sensor_id, last_reading_time.to_pydatetime() if last_reading_time is not None else None
+    )
     
     # Riesgo = (Horas en Riesgo / Límite Crítico) * Valor del Inventario
     risk_factor = min(hours_at_risk / CRITICAL_EXPOSURE_LIMIT_HOURS, 1.0)
-    estimated_cost = round(risk_factor * (avg_price_kg * ASSUMED_INVENTORY_KG), 2)
+    estimated_cost = round(risk_factor * inventory_value, 2)
 
     # Calcular Total de Alertas Reales en el intervalo
     query_alerts = text("""
@@ -125,6 +276,20 @@ def get_chamber_kpis(db: Session, sensor_id: str, timeframe_minutes: int = 30):
     """)
     total_alerts = db.execute(query_alerts, {"sensor_id": sensor_id, "minutes": timeframe_minutes}).scalar() or 0
 
+    # Alertas por revisión de configuración activa al dispararse
+    # (permite explicar decisiones históricas tras un cambio de umbrales)
+    query_alerts_by_revision = text("""
+        SELECT config_revision, COUNT(*) 
+        FROM alerts 
+        WHERE sensor_id = :sensor_id 
+        AND timestamp >= NOW() - INTERVAL :minutes MINUTE
+        GROUP BY config_revision
+    """)
+    revision_rows = db.execute(query_alerts_by_revision, {"sensor_id": sensor_id, "minutes": timeframe_minutes}).fetchall()
+    alerts_by_config_revision = [
+        {"config_revision": row[0], "alerts": row[1]} for row in revision_rows
+    ]
+
     # Calcular Uptime (Confiabilidad)
     # Esperamos 1 lectura cada 5 segundos -> 12 lecturas por minuto
     expected_readings = float(timeframe_minutes * 12)
@@ -147,8 +312,51 @@ def get_chamber_kpis(db: Session, sensor_id: str, timeframe_minutes: int = 30):
         "chamber_id": sensor_id,
         "hours_at_risk": round(hours_at_risk, 4),
         "estimated_cost": estimated_cost,
+        "inventory_value": round(inventory_value, 2),
+        "affected_content": affected_content,
         "uptime_percentage": uptime_percentage,
         "avg_rate_of_change": calculate_rate_of_change(db, sensor_id, timeframe_minutes),
         "total_alerts": total_alerts,
+        "alerts_by_config_revision": alerts_by_config_revision,
         "timeframe_minutes": timeframe_minutes
     }
+
+
+def get_scope_counts(db: Session, location_ids=None):
+    """
+    Cuenta cámaras y alertas sin leer y valora su inventario, opcionalmente limitado a ciertos locales.
+    location_ids=None significa sin restricción; una lista vacía no ve nada.
+    """
+    where = ""
+    params = {}
+    if location_ids is not None:
+        if not location_ids:
+            return {"total_chambers": 0, "unread_alerts": 0, "total_risk_exposure": 0.0}
+        keys = [f"loc{i}" for i in range(len(location_ids))]
+        where = "WHERE c.location_id IN (" + ", ".join(f":{k}" for k in keys) + ")"
+        params = dict(zip(keys, location_ids))
+
+    total_chambers = db.execute(text(f"SELECT COUNT(*) FROM chambers c {where}"), params).scalar() or 0
+
+    alert_where = where + (" AND" if where else "WHERE") + " a.is_read = FALSE"
+    unread_alerts = db.execute(text(f"""
+        SELECT COUNT(*)
+        FROM alerts a
+        JOIN chambers c ON c.id = a.sensor_id
+        {alert_where}
+    """), params).scalar() or 0
+
+    # Exposición total = valor actual del inventario en las cámaras visibles
+    total_risk_exposure = db.execute(text(f"""
+        SELECT COALESCE(SUM(CASE WHEN m.type = 'out' THEN -m.quantity_kg ELSE m.quantity_kg END * p.price_per_kg), 0)
+        FROM stock_movements m
+        JOIN products p ON p.id = m.product_id
+        JOIN chambers c ON c.id = m.sensor_id
+        {where}
+    """), params).scalar() or 0
+
+    return {
+        "total_chambers": total_chambers,
+        "unread_alerts": unread_alerts,
+        "total_risk_exposure": round(float(total_risk_exposure), 2),
+    }
@@ -1,3 +1,4 @@
+from typing import Optional
 from fastapi import FastAPI, Depends, HTTPException
 from sqlalchemy.orm import Session
 from database import get_db
@@ -11,27 +12,36 @@ def health_check():
     return {"status": "analytics_ok", "timestamp": datetime.datetime.now().isoformat()}
 
 @app.get("/analyze/report/{chamber_id}")
-def get_report(chamber_id: str, minutes: int = 30, db: Session = Depends(get_db)):
+def get_report(chamber_id: str, minutes: int = 30,
+               start: Optional[datetime.datetime] = None, end: Optional[datetime.datetime] = None,
+               db: Session = Depends(get_db)):
     """
     Endpoint principal de análisis consumido por el Backend Go.
     El parámetro 'minutes' permite ajustar el rango del reporte (default 30 min).
+    'start' y 'end' (UTC, sin zona) fijan el rango de las métricas térmicas (MKT y grados-minuto).
     """
     try:
         data = analysis.get_chamber_kpis(db, chamber_id, timeframe_minutes=minutes)
+        data["thermal"] = analysis.get_thermal_metrics(db, chamber_id, start, end, timeframe_minutes=minutes)
         return data
     except Exception as e:
         raise HTTPException(status_code=500, detail=str(e))
 
 @app.get("/analyze/statistics")
-def get_global_stats(db: Session = Depends(get_db)):
+def get_global_stats(location_ids: Optional[str] = None, db: Session = Depends(get_db)):
     """
     Métricas agregadas de todo el sistema.
+    'location_ids' (separados por coma) restringe las métricas a esos locales;
+    el Backend Go lo envía según los locales asignados al usuario.
     """
-    # Aquí podríamos sumar horas en riesgo de todas las cámaras
+    scope = None
+    if location_ids is not None:
+        scope = [l for l in location_ids.split(",") if l]
+
     return {
         "system_health": "good",
-        "total_risk_exposure": 15000.0,
-        "active_analysis": True
+        "active_analysis": True,
+        **analysis.get_scope_counts(db, scope)
     }
 
 if __name__ == "__main__":
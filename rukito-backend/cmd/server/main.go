@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/angello/rukito-backend/internal/api"
+	"github.com/angello/rukito-backend/internal/auth"
 	"github.com/angello/rukito-backend/internal/db"
 	"github.com/angello/rukito-backend/internal/service"
 	"github.com/gorilla/mux"
@@ -22,15 +23,34 @@ func main() {
 	// Initialize Database
 	db.InitDB()
 
+	// Authentication (JWT) and initial owner account
+	if err := auth.Init(); err != nil {
+		log.Fatal(err)
+	}
+	service.EnsureOwnerAccount()
+
 	// Select Simulation Mode
 	simMode := os.Getenv("SIMULATION_MODE")
 	if simMode == "SCENARIO" {
 		service.StartScenarioSimulation()
+	} else if simMode == "REPLAY" {
+		service.StartReplaySimulation()
+	} else if simMode == "DEVICES" {
+		service.StartDeviceIngestion()
 	} else {
 		// Default: Random "Real" Simulation
 		service.StartSensorSimulation()
 	}
 
+	// Recordatorios de calibración vencida
+	service.StartCalibrationMonitor()
+
+	// Métricas diarias del compresor y tendencia del ciclo de trabajo
+	service.StartEquipmentMonitor()
+
+	// Reportes HACCP programados (REPORT_SCHEDULE)
+	service.StartReportScheduler()
+
 	// Initialize Router
 	r := mux.NewRouter()
 
@@ -40,6 +60,7 @@ func main() {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, Content-Disposition")
 			
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -52,18 +73,79 @@ func main() {
 
 	// Routes
 	apiRouter := r.PathPrefix("/api").Subrouter()
+	apiRouter.Use(api.ValidatePathParams)
+
+	// Public routes
 	apiRouter.HandleFunc("/health", api.GetHealth).Methods("GET")
-	apiRouter.HandleFunc("/chambers", api.GetChambers).Methods("GET")
-	apiRouter.HandleFunc("/chambers/{id}", api.GetChamber).Methods("GET")
-	apiRouter.HandleFunc("/readings/{id}", api.GetReadings).Methods("GET")
-	apiRouter.HandleFunc("/readings/{id}/history", api.GetReadingHistory).Methods("GET")
-	apiRouter.HandleFunc("/alerts", api.GetAlerts).Methods("GET")
-	apiRouter.HandleFunc("/alerts/chamber/{id}", api.GetChamberAlerts).Methods("GET")
-	apiRouter.HandleFunc("/alerts/{id}/read", api.MarkAlertRead).Methods("PATCH")
-	apiRouter.HandleFunc("/config/alerts/{id}", api.GetAlertConfig).Methods("GET")
-	apiRouter.HandleFunc("/config/alerts/{id}", api.UpdateAlertConfig).Methods("PUT")
-	apiRouter.HandleFunc("/reports/{id}", api.GetReport).Methods("GET")
-	apiRouter.HandleFunc("/statistics", api.GetStatistics).Methods("GET")
+	apiRouter.HandleFunc("/auth/login", api.Login).Methods("POST")
+	apiRouter.HandleFunc("/auth/refresh", api.RefreshToken).Methods("POST")
+	apiRouter.HandleFunc("/ingest/readings", api.IngestReadings).Methods("POST") // device API key
+
+	// Authenticated routes (any role can read; writes require the role noted)
+	protected := apiRouter.NewRoute().Subrouter()
+	protected.Use(auth.Authenticate)
+	protected.HandleFunc("/auth/me", api.GetCurrentUser).Methods("GET")
+	protected.HandleFunc("/users", auth.RequireRole(auth.RoleManager, api.GetUsers)).Methods("GET")
+	protected.HandleFunc("/users", auth.RequireRole(auth.RoleManager, api.CreateUser)).Methods("POST")
+	protected.HandleFunc("/users/{id}/locations", auth.RequireRole(auth.RoleManager, api.SetUserLocations)).Methods("PUT")
+	protected.HandleFunc("/locations", api.GetLocations).Methods("GET")
+	protected.HandleFunc("/locations", auth.RequireRole(auth.RoleOwner, api.CreateLocation)).Methods("POST")
+	protected.HandleFunc("/chambers", api.GetChambers).Methods("GET")
+	protected.HandleFunc("/chambers", auth.RequireRole(auth.RoleManager, api.CreateChamber)).Methods("POST")
+	protected.HandleFunc("/chambers/{id}", api.GetChamber).Methods("GET")
+	protected.HandleFunc("/chambers/{id}", auth.RequireRole(auth.RoleManager, api.UpdateChamber)).Methods("PUT")
+	protected.HandleFunc("/chambers/{id}/inventory", api.GetChamberInventory).Methods("GET")
+	protected.HandleFunc("/chambers/{id}/spoilage-risk", api.GetSpoilageRisk).Methods("GET")
+	protected.HandleFunc("/chambers/{id}/anomaly", api.GetChamberAnomaly).Methods("GET")
+	protected.HandleFunc("/chambers/{id}/equipment", api.GetChamberEquipment).Methods("GET")
+	protected.HandleFunc("/chambers/{id}/stock/movements", api.GetStockMovements).Methods("GET")
+	protected.HandleFunc("/chambers/{id}/stock/in", auth.RequireRole(auth.RoleStaff, api.StockIn)).Methods("POST")
+	protected.HandleFunc("/chambers/{id}/stock/out", auth.RequireRole(auth.RoleStaff, api.StockOut)).Methods("POST")
+	protected.HandleFunc("/chambers/{id}/lots", auth.RequireRole(auth.RoleStaff, api.CreateLot)).Methods("POST")
+	protected.HandleFunc("/chambers/{id}/defrost-schedules", api.GetDefrostSchedules).Methods("GET")
+	protected.HandleFunc("/chambers/{id}/defrost-schedules", auth.RequireRole(auth.RoleManager, api.CreateDefrostSchedule)).Methods("POST")
+	protected.HandleFunc("/chambers/{id}/defrost-cycles", api.GetDefrostCycles).Methods("GET")
+	protected.HandleFunc("/defrost-schedules/{id}", auth.RequireRole(auth.RoleManager, api.UpdateDefrostSchedule)).Methods("PUT")
+	protected.HandleFunc("/lots", api.GetLots).Methods("GET")
+	protected.HandleFunc("/lots/{id}", api.GetLot).Methods("GET")
+	protected.HandleFunc("/lots/{id}/traceability", api.GetLotTraceability).Methods("GET")
+	protected.HandleFunc("/lots/{id}/resolve", auth.RequireRole(auth.RoleManager, api.ResolveLot)).Methods("POST")
+	protected.HandleFunc("/products", api.GetProducts).Methods("GET")
+	protected.HandleFunc("/products", auth.RequireRole(auth.RoleManager, api.CreateProduct)).Methods("POST")
+	protected.HandleFunc("/products/{id}", auth.RequireRole(auth.RoleManager, api.UpdateProduct)).Methods("PUT")
+	protected.HandleFunc("/product-categories", api.GetProductCategories).Methods("GET")
+	protected.HandleFunc("/product-categories/{category}", auth.RequireRole(auth.RoleManager, api.UpdateProductCategory)).Methods("PUT")
+	protected.HandleFunc("/readings/{id}", api.GetReadings).Methods("GET")
+	protected.HandleFunc("/readings/{id}/history", api.GetReadingHistory).Methods("GET")
+	protected.HandleFunc("/alerts", api.GetAlerts).Methods("GET")
+	protected.HandleFunc("/alerts/chamber/{id}", api.GetChamberAlerts).Methods("GET")
+	protected.HandleFunc("/alerts/{id}/read", auth.RequireRole(auth.RoleStaff, api.MarkAlertRead)).Methods("PATCH")
+	protected.HandleFunc("/excursions", api.GetExcursions).Methods("GET")
+	protected.HandleFunc("/excursions/{id}", api.GetExcursion).Methods("GET")
+	protected.HandleFunc("/corrective-actions", api.GetCorrectiveActions).Methods("GET")
+	protected.HandleFunc("/corrective-actions", auth.RequireRole(auth.RoleStaff, api.CreateCorrectiveAction)).Methods("POST")
+	protected.HandleFunc("/config/alerts/{id}", api.GetAlertConfig).Methods("GET")
+	protected.HandleFunc("/config/alerts/{id}", auth.RequireRole(auth.RoleManager, api.UpdateAlertConfig)).Methods("PUT")
+	protected.HandleFunc("/config/alerts/{id}", auth.RequireRole(auth.RoleManager, api.PatchAlertConfig)).Methods("PATCH")
+	protected.HandleFunc("/config/alerts/{id}/revisions", api.GetAlertConfigRevisions).Methods("GET")
+	protected.HandleFunc("/config/alerts/{id}/revisions/diff", api.DiffAlertConfigRevisions).Methods("GET")
+	protected.HandleFunc("/config/alerts/{id}/revisions/{revision:[0-9]+}", api.GetAlertConfigRevision).Methods("GET")
+	protected.HandleFunc("/config/alerts/{id}/rollback", auth.RequireRole(auth.RoleManager, api.RollbackAlertConfig)).Methods("POST")
+	protected.HandleFunc("/reports/{id}", api.GetReport).Methods("GET")
+	protected.HandleFunc("/reports/{id}/pdf", api.GetHACCPReportPDF).Methods("GET")
+	protected.HandleFunc("/statistics", api.GetStatistics).Methods("GET")
+	protected.HandleFunc("/export/readings", api.ExportReadings).Methods("GET")
+	protected.HandleFunc("/export/alerts", api.ExportAlerts).Methods("GET")
+	protected.HandleFunc("/calibrations/{id}", api.GetCalibrations).Methods("GET")
+	protected.HandleFunc("/calibrations/{id}", auth.RequireRole(auth.RoleManager, api.CreateCalibration)).Methods("POST")
+	protected.HandleFunc("/devices", auth.RequireRole(auth.RoleManager, api.GetDevices)).Methods("GET")
+	protected.HandleFunc("/devices", auth.RequireRole(auth.RoleManager, api.CreateDevice)).Methods("POST")
+	protected.HandleFunc("/devices/rejections", auth.RequireRole(auth.RoleManager, api.GetDeviceRejections)).Methods("GET")
+	protected.HandleFunc("/devices/{id}/rotate", auth.RequireRole(auth.RoleManager, api.RotateDeviceKey)).Methods("POST")
+	protected.HandleFunc("/devices/{id}/revoke", auth.RequireRole(auth.RoleManager, api.RevokeDevice)).Methods("POST")
+	protected.HandleFunc("/replays", api.GetReplayRuns).Methods("GET")
+	protected.HandleFunc("/replays/{id}/alerts", api.GetReplayAlerts).Methods("GET")
+	protected.HandleFunc("/audit", auth.RequireRole(auth.RoleManager, api.GetAuditLog)).Methods("GET")
 
 	port := os.Getenv("SERVER_PORT")
 	if port == "" {
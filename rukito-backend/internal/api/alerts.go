@@ -2,110 +2,203 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/angello/rukito-backend/internal/db"
 	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
 	"github.com/gorilla/mux"
 )
 
-// GetAlerts returns all alerts with optional filtering
-// Query Params: limit, unread_only (bool)
+// GetAlerts returns the alerts of the user's locations, newest first
+// Query Params: limit, cursor, chamber_id, priority, type, start, end (ISO8601),
+// is_read (bool), unread_only (bool), location_id
 func GetAlerts(w http.ResponseWriter, r *http.Request) {
-	limitStr := r.URL.Query().Get("limit")
-	unreadOnlyStr := r.URL.Query().Get("unread_only")
-
-	limit := 50
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
 	}
 
-	query := `SELECT id, title, description, priority, type, sensor_id, is_read, estimated_cost, timestamp FROM alerts`
+	var conditions []string
 	var args []interface{}
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	if chamberID := r.URL.Query().Get("chamber_id"); chamberID != "" {
+		conditions = append(conditions, `a.sensor_id = ?`)
+		args = append(args, chamberID)
+	}
+
+	listAlerts(w, r, conditions, args)
+}
 
-	if unreadOnlyStr == "true" {
-		query += ` WHERE is_read = FALSE`
+// GetChamberAlerts returns the alerts of a chamber, newest first
+// Query Params: same as GetAlerts except chamber_id and location_id
+func GetChamberAlerts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
 	}
 
-	query += ` ORDER BY timestamp DESC LIMIT ?`
-	args = append(args, limit)
+	listAlerts(w, r, []string{`a.sensor_id = ?`}, []interface{}{sensorID})
+}
 
-	rows, err := db.DB.Query(query, args...)
+// listAlerts applies the common filters and cursor pagination on top of the
+// given conditions and writes the page
+func listAlerts(w http.ResponseWriter, r *http.Request, conditions []string, args []interface{}) {
+	limit, err := queryLimit(r, 50)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
+		return
+	}
+	cursor, err := queryCursor(r)
+	if err != nil {
+		response.Fail(w, err)
 		return
 	}
-	defer rows.Close()
 
-	var alerts []models.Alert
-	for rows.Next() {
-		var a models.Alert
-		// Handling nullable EstimatedCost
-		var estCost sql.NullFloat64
-		
-		err := rows.Scan(&a.ID, &a.Title, &a.Description, &a.Priority, &a.Type, &a.SensorID, &a.IsRead, &estCost, &a.Timestamp)
+	for _, f := range []struct{ param, column string }{{"priority", "a.priority"}, {"type", "a.type"}} {
+		v, err := queryInt(r, f.param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if v != nil {
+			conditions = append(conditions, f.column+" = ?")
+			args = append(args, *v)
+		}
+	}
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Fail(w, err)
 			return
 		}
+		if t != nil {
+			conditions = append(conditions, "a.timestamp "+op+" ?")
+			args = append(args, *t)
+		}
+	}
 
-		if estCost.Valid {
-			val := estCost.Float64
-			a.EstimatedCost = &val
+	unreadOnly, err := queryBool(r, "unread_only")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if unreadOnly {
+		conditions = append(conditions, `a.is_read = FALSE`)
+	} else if v := r.URL.Query().Get("is_read"); v != "" {
+		isRead, err := queryBool(r, "is_read")
+		if err != nil {
+			response.Fail(w, err)
+			return
 		}
+		conditions = append(conditions, `a.is_read = ?`)
+		args = append(args, isRead)
+	}
 
-		alerts = append(alerts, a)
+	from := ` FROM alerts a JOIN chambers c ON c.id = a.sensor_id`
+	if len(conditions) > 0 {
+		from += ` WHERE ` + strings.Join(conditions, " AND ")
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(alerts)
-}
+	// El total no depende del cursor: es el de todas las páginas
+	var total int
+	if err := db.DB.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		response.Fail(w, err)
+		return
+	}
 
-// GetChamberAlerts returns alerts for a specific chamber
-func GetChamberAlerts(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sensorID := vars["id"]
+	if cursor != nil {
+		where, cursorArgs := cursor.clause("a.timestamp", "a.id")
+		if len(conditions) > 0 {
+			from += ` AND ` + where
+		} else {
+			from += ` WHERE ` + where
+		}
+		args = append(args, cursorArgs...)
+	}
 
 	query := `
-		SELECT id, title, description, priority, type, sensor_id, is_read, estimated_cost, timestamp 
-		FROM alerts 
-		WHERE sensor_id = ? 
-		ORDER BY timestamp DESC 
-		LIMIT 50`
+		SELECT ` + alertColumns + from + `
+		ORDER BY a.timestamp DESC, a.id DESC 
+		LIMIT ?`
+	args = append(args, limit+1) // una fila extra indica si hay página siguiente
 
-	rows, err := db.DB.Query(query, sensorID)
+	rows, err := db.DB.Query(query, args...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
 		return
 	}
 	defer rows.Close()
 
-	var alerts []models.Alert
+	alerts := []models.Alert{}
 	for rows.Next() {
-		var a models.Alert
-		var estCost sql.NullFloat64
-
-		err := rows.Scan(&a.ID, &a.Title, &a.Description, &a.Priority, &a.Type, &a.SensorID, &a.IsRead, &estCost, &a.Timestamp)
+		a, err := scanAlert(rows)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Fail(w, err)
 			return
 		}
+		alerts = append(alerts, a)
+	}
 
-		if estCost.Valid {
-			val := estCost.Float64
-			a.EstimatedCost = &val
-		}
+	next := ""
+	if len(alerts) > limit {
+		alerts = alerts[:limit]
+		last := alerts[limit-1]
+		next = encodeCursor(last.Timestamp, last.ID)
+	}
 
-		alerts = append(alerts, a)
+	writePageHeaders(w, total, next)
+	response.JSON(w, http.StatusOK, alerts)
+}
+
+// alertColumns are the columns read by scanAlert (alerts aliased as a). An alert
+// counts as handled if it, or the excursion it belongs to, has a corrective action.
+const alertColumns = `a.id, a.title, a.description, a.priority, a.type, a.sensor_id, a.is_read, a.estimated_cost, a.affected_content, a.suggested_action, a.config_revision, a.excursion_id, a.timestamp,
+	EXISTS(SELECT 1 FROM corrective_actions ca WHERE ca.alert_id = a.id OR (a.excursion_id IS NOT NULL AND ca.excursion_id = a.excursion_id))`
+
+func scanAlert(rows *sql.Rows) (models.Alert, error) {
+	var a models.Alert
+	// Handling nullable EstimatedCost
+	var estCost sql.NullFloat64
+	var affectedContent, suggestedAction sql.NullString
+	var configRevision sql.NullInt64
+	var excursionID sql.NullString
+
+	err := rows.Scan(&a.ID, &a.Title, &a.Description, &a.Priority, &a.Type, &a.SensorID, &a.IsRead, &estCost, &affectedContent, &suggestedAction, &configRevision, &excursionID, &a.Timestamp, &a.HasCorrectiveAction)
+	if err != nil {
+		return a, err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(alerts)
+	if estCost.Valid {
+		val := estCost.Float64
+		a.EstimatedCost = &val
+	}
+	if affectedContent.Valid {
+		val := affectedContent.String
+		a.AffectedContent = &val
+	}
+	if suggestedAction.Valid {
+		val := suggestedAction.String
+		a.SuggestedAction = &val
+	}
+	if configRevision.Valid {
+		val := int(configRevision.Int64)
+		a.ConfigRevision = &val
+	}
+	if excursionID.Valid {
+		val := excursionID.String
+		a.ExcursionID = &val
+	}
+	return a, nil
 }
 
 // MarkAlertRead marks an alert as read
@@ -113,19 +206,35 @@ func MarkAlertRead(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	alertID := vars["id"]
 
+	var sensorID string
+	var wasRead bool
+	err := db.DB.QueryRow(`SELECT sensor_id, is_read FROM alerts WHERE id = ?`, alertID).Scan(&sensorID, &wasRead)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Alert not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
 	query := `UPDATE alerts SET is_read = TRUE WHERE id = ?`
-	_, err := db.DB.Exec(query, alertID)
+	_, err = db.DB.Exec(query, alertID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
 		return
 	}
 
-	response := map[string]interface{}{
+	recordAudit(r, service.AuditAlertAck, "alert", alertID, chamberLocation(sensorID),
+		map[string]interface{}{"is_read": wasRead}, map[string]interface{}{"is_read": true})
+
+	result := map[string]interface{}{
 		"id":         alertID,
 		"is_read":    true,
 		"updated_at": time.Now().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	response.JSON(w, http.StatusOK, result)
 }
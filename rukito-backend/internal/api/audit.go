@@ -0,0 +1,125 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+)
+
+// recordAudit logs an action performed by the authenticated user of the request
+func recordAudit(r *http.Request, action, entityType, entityID string, locationID *string, before, after interface{}) {
+	entry := models.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		LocationID: locationID,
+		RemoteAddr: r.RemoteAddr,
+	}
+
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		actorID := claims.UserID
+		entry.ActorID = &actorID
+		entry.ActorUsername = claims.Username
+	}
+
+	service.RecordAudit(entry, before, after)
+}
+
+// GetAuditLog returns audit entries, newest first. Entries not tied to a
+// location (logins, users) are only visible to owners.
+// Query Params: entity_type, entity_id, actor_id, action, start, end (ISO8601), limit (default 100), location_id
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `
+		SELECT id, actor_id, COALESCE(actor_username, ''), action, entity_type, entity_id, location_id, before_data, after_data, changes, COALESCE(remote_addr, ''), created_at 
+		FROM audit_log`
+	var conditions []string
+	var args []interface{}
+
+	if where, scopeArgs := scope.clause("location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	for _, f := range []string{"entity_type", "entity_id", "actor_id", "action"} {
+		if v := q.Get(f); v != "" {
+			conditions = append(conditions, f+" = ?")
+			args = append(args, v)
+		}
+	}
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "created_at "+op+" ?")
+			args = append(args, *t)
+		}
+	}
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var actorID, locationID sql.NullString
+		var before, after, changes []byte
+
+		err := rows.Scan(&e.ID, &actorID, &e.ActorUsername, &e.Action, &e.EntityType, &e.EntityID, &locationID, &before, &after, &changes, &e.RemoteAddr, &e.CreatedAt)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+
+		if actorID.Valid {
+			val := actorID.String
+			e.ActorID = &val
+		}
+		if locationID.Valid {
+			val := locationID.String
+			e.LocationID = &val
+		}
+		if before != nil {
+			e.Before = json.RawMessage(before)
+		}
+		if after != nil {
+			e.After = json.RawMessage(after)
+		}
+		json.Unmarshal(changes, &e.Changes)
+
+		entries = append(entries, e)
+	}
+
+	response.JSON(w, http.StatusOK, entries)
+}
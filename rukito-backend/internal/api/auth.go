@@ -0,0 +1,259 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+)
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type createUserRequest struct {
+	Username string `json:"username"`
+	FullName string `json:"full_name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	RefreshToken string      `json:"refresh_token"`
+	TokenType    string      `json:"token_type"`
+	ExpiresIn    int         `json:"expires_in"` // segundos
+	User         models.User `json:"user"`
+}
+
+const userColumns = `id, username, full_name, password_hash, role, is_active, created_at, last_login_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var u models.User
+	var fullName sql.NullString
+	var lastLogin sql.NullTime
+
+	err := row.Scan(&u.ID, &u.Username, &fullName, &u.PasswordHash, &u.Role, &u.IsActive, &u.CreatedAt, &lastLogin)
+	if err != nil {
+		return u, err
+	}
+
+	u.FullName = fullName.String
+	if lastLogin.Valid {
+		val := lastLogin.Time
+		u.LastLoginAt = &val
+	}
+
+	u.LocationIDs, err = userLocations(u.ID)
+	return u, err
+}
+
+func writeTokens(w http.ResponseWriter, u models.User) {
+	access, err := auth.IssueToken(u.ID, u.Username, u.Role, auth.TokenAccess)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	refresh, err := auth.IssueToken(u.ID, u.Username, u.Role, auth.TokenRefresh)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, tokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTTL().Seconds()),
+		User:         u,
+	})
+}
+
+// Login validates credentials and issues an access/refresh token pair
+func Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	row := db.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, req.Username)
+	u, err := scanUser(row)
+	if err == sql.ErrNoRows || (err == nil && (!u.IsActive || !auth.CheckPassword(u.PasswordHash, req.Password))) {
+		service.RecordAudit(models.AuditEntry{
+			ActorUsername: req.Username,
+			Action:        service.AuditLoginFailed,
+			EntityType:    "user",
+			EntityID:      req.Username,
+			RemoteAddr:    r.RemoteAddr,
+		}, nil, nil)
+		response.Fail(w, response.Unauthorized("Invalid username or password"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	now := time.Now()
+	db.DB.Exec(`UPDATE users SET last_login_at = ? WHERE id = ?`, now, u.ID)
+	u.LastLoginAt = &now
+
+	service.RecordAudit(models.AuditEntry{
+		ActorID:       &u.ID,
+		ActorUsername: u.Username,
+		Action:        service.AuditLogin,
+		EntityType:    "user",
+		EntityID:      u.ID,
+		RemoteAddr:    r.RemoteAddr,
+	}, nil, nil)
+
+	writeTokens(w, u)
+}
+
+// RefreshToken exchanges a valid refresh token for a new token pair.
+// The user is reloaded so role changes and deactivations take effect.
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	claims, err := auth.ParseToken(req.RefreshToken, auth.TokenRefresh)
+	if err != nil {
+		response.Fail(w, response.Unauthorized("Invalid or expired refresh token"))
+		return
+	}
+
+	row := db.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, claims.UserID)
+	u, err := scanUser(row)
+	if err == sql.ErrNoRows || (err == nil && !u.IsActive) {
+		response.Fail(w, response.Unauthorized("Invalid or expired refresh token"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	writeTokens(w, u)
+}
+
+// GetCurrentUser returns the authenticated user
+func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	claims := auth.FromContext(r.Context())
+
+	row := db.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, claims.UserID)
+	u, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("User not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, u)
+}
+
+// GetUsers returns the user accounts within the caller's locations: users assigned to at
+// least one of them, plus non-owners without any location yet (so they can be assigned).
+// Owners see every account.
+// Query Params: location_id
+func GetUsers(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `SELECT ` + userColumns + ` FROM users u`
+	var args []interface{}
+	if where, scopeArgs := scope.clause("ul.location_id"); where != "" {
+		query += `
+		WHERE EXISTS (SELECT 1 FROM user_locations ul WHERE ul.user_id = u.id AND ` + where + `)
+			OR (u.role <> ? AND NOT EXISTS (SELECT 1 FROM user_locations ul WHERE ul.user_id = u.id))`
+		args = append(scopeArgs, auth.RoleOwner)
+	}
+	query += ` ORDER BY u.username`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		users = append(users, u)
+	}
+
+	response.JSON(w, http.StatusOK, users)
+}
+
+// CreateUser registers a new account. Only owners may create other owners.
+func CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if req.Username == "" || len(req.Password) < 8 {
+		response.Fail(w, response.BadRequest("'username' is required and 'password' must have at least 8 characters"))
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		response.Fail(w, response.BadRequest("Invalid 'role' (owner, manager, staff, readonly)"))
+		return
+	}
+
+	claims := auth.FromContext(r.Context())
+	if req.Role == auth.RoleOwner && claims.Role != auth.RoleOwner {
+		response.Fail(w, response.Forbidden("Insufficient permissions"))
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	u := models.User{
+		ID:          "USR-" + uuid.New().String()[:8],
+		Username:    req.Username,
+		FullName:    req.FullName,
+		Role:        req.Role,
+		IsActive:    true,
+		LocationIDs: []string{},
+		CreatedAt:   time.Now(),
+	}
+
+	_, err = db.DB.Exec(`INSERT INTO users (id, username, full_name, password_hash, role) VALUES (?, ?, ?, ?, ?)`,
+		u.ID, u.Username, u.FullName, hash, u.Role)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, "Username "+u.Username+" already exists"))
+		return
+	}
+
+	recordAudit(r, service.AuditUserCreate, "user", u.ID, nil, nil, u)
+
+	response.JSON(w, http.StatusCreated, u)
+}
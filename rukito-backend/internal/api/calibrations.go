@@ -0,0 +1,156 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// calibrationRequest is the body of POST /calibrations/{id}.
+// Gain is optional (defaults to 1); the offset is derived from the reference reading.
+// NextDueAt overrides the default due date (calibrated_at + CALIBRATION_INTERVAL_DAYS).
+type calibrationRequest struct {
+	CalibratedAt   *time.Time `json:"calibrated_at"`
+	NextDueAt      *time.Time `json:"next_due_at"`
+	ReferenceValue *float64   `json:"reference_value"`
+	MeasuredValue  *float64   `json:"measured_value"`
+	Gain           *float64   `json:"gain"`
+	Technician     string     `json:"technician"`
+	Notes          *string    `json:"notes"`
+}
+
+// GetCalibrations returns the calibration history of a sensor, newest first
+func GetCalibrations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	query := `
+		SELECT id, sensor_id, calibrated_at, reference_value, measured_value, offset, gain, technician, notes, next_due_at
+		FROM sensor_calibrations
+		WHERE sensor_id = ?
+		ORDER BY calibrated_at DESC`
+
+	rows, err := db.DB.Query(query, sensorID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	interval := service.CalibrationInterval()
+
+	var calibrations []models.SensorCalibration
+	for rows.Next() {
+		var c models.SensorCalibration
+		var notes sql.NullString
+		var nextDueAt sql.NullTime
+
+		err := rows.Scan(&c.ID, &c.SensorID, &c.CalibratedAt, &c.ReferenceValue, &c.MeasuredValue, &c.Offset, &c.Gain, &c.Technician, &notes, &nextDueAt)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+
+		if notes.Valid {
+			val := notes.String
+			c.Notes = &val
+		}
+		c.NextDueAt = c.CalibratedAt.Add(interval)
+		if nextDueAt.Valid {
+			c.NextDueAt = nextDueAt.Time
+		}
+
+		calibrations = append(calibrations, c)
+	}
+
+	response.JSON(w, http.StatusOK, calibrations)
+}
+
+// CreateCalibration records a calibration event for a sensor.
+// The new offset/gain applies to incoming readings within a minute.
+func CreateCalibration(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	var req calibrationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if req.ReferenceValue == nil || req.MeasuredValue == nil || req.Technician == "" {
+		response.Fail(w, response.BadRequest("Missing 'reference_value', 'measured_value' or 'technician'"))
+		return
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM chambers WHERE id = ?)`, sensorID).Scan(&exists); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if !exists {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	}
+
+	c := models.SensorCalibration{
+		ID:             "CAL-" + uuid.New().String()[:8],
+		SensorID:       sensorID,
+		CalibratedAt:   time.Now(),
+		ReferenceValue: *req.ReferenceValue,
+		MeasuredValue:  *req.MeasuredValue,
+		Gain:           1.0,
+		Technician:     req.Technician,
+		Notes:          req.Notes,
+	}
+	if req.CalibratedAt != nil {
+		c.CalibratedAt = *req.CalibratedAt
+	}
+	if req.Gain != nil {
+		if *req.Gain <= 0 {
+			response.Fail(w, response.BadRequest("'gain' must be greater than 0"))
+			return
+		}
+		c.Gain = *req.Gain
+	}
+
+	// corregido = crudo * gain + offset, de modo que la lectura medida coincida con la referencia
+	c.Offset = c.ReferenceValue - c.MeasuredValue*c.Gain
+	c.NextDueAt = c.CalibratedAt.Add(service.CalibrationInterval())
+	if req.NextDueAt != nil {
+		if !req.NextDueAt.After(c.CalibratedAt) {
+			response.Fail(w, response.BadRequest("'next_due_at' must be after 'calibrated_at'"))
+			return
+		}
+		c.NextDueAt = *req.NextDueAt
+	}
+
+	query := `
+		INSERT INTO sensor_calibrations (id, sensor_id, calibrated_at, reference_value, measured_value, offset, gain, technician, notes, next_due_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.DB.Exec(query, c.ID, c.SensorID, c.CalibratedAt, c.ReferenceValue, c.MeasuredValue, c.Offset, c.Gain, c.Technician, c.Notes, req.NextDueAt)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditCalibration, "calibration", c.ID, chamberLocation(sensorID), nil, c)
+
+	response.JSON(w, http.StatusCreated, c)
+}
@@ -1,77 +1,418 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/angello/rukito-backend/internal/db"
 	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
 	"github.com/gorilla/mux"
 )
 
-// GetAlertConfig returns the alert configuration for a sensor
-func GetAlertConfig(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sensorID := vars["id"]
+// Límites de validación de la configuración de alertas
+const (
+	maxRateOfChangeThreshold = 10.0 // °C/min; por encima ninguna alerta de tendencia tendría sentido
+	minAlertPriority         = 0
+	maxAlertPriority         = 2
+)
 
-	query := `
-		SELECT id, sensor_id, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, created_at, updated_at 
+// notificationChannels son los canales que el backend sabe notificar
+var notificationChannels = map[string]bool{"sms": true, "push": true, "email": true}
+
+var (
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`) // E.164
+	emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+)
+
+// alertConfigRequest is the body of PUT and PATCH /config/alerts/{id}.
+// Omitted fields are nil: PUT requires the thresholds, PATCH keeps the stored values.
+// Read-only fields are accepted (and ignored) so a GET response can be sent back as is.
+type alertConfigRequest struct {
+	MaxTemp               *float64  `json:"max_temperature"`
+	MinTemp               *float64  `json:"min_temperature"`
+	RateOfChangeThreshold *float64  `json:"rate_of_change_threshold"`
+	Priority              *int      `json:"priority"`
+	IsEnabled             *bool     `json:"is_enabled"`
+	NotificationChannels  *[]string `json:"notification_channels"`
+	Recipients            *[]string `json:"recipients"`
+
+	ID        string          `json:"id"`
+	SensorID  string          `json:"sensor_id"`
+	Revision  int             `json:"revision"`
+	CreatedAt json.RawMessage `json:"created_at"`
+	UpdatedAt json.RawMessage `json:"updated_at"`
+}
+
+// apply copies the fields present in the request onto c
+func (req alertConfigRequest) apply(c *models.AlertConfig) {
+	if req.MaxTemp != nil {
+		c.MaxTemp = *req.MaxTemp
+	}
+	if req.MinTemp != nil {
+		c.MinTemp = *req.MinTemp
+	}
+	if req.RateOfChangeThreshold != nil {
+		c.RateOfChangeThreshold = *req.RateOfChangeThreshold
+	}
+	if req.Priority != nil {
+		c.Priority = *req.Priority
+	}
+	if req.IsEnabled != nil {
+		c.IsEnabled = *req.IsEnabled
+	}
+	if req.NotificationChannels != nil {
+		c.NotificationChannels = *req.NotificationChannels
+	}
+	if req.Recipients != nil {
+		c.Recipients = *req.Recipients
+	}
+}
+
+func invalid(field, message string) response.FieldError {
+	return response.FieldError{Field: field, Message: message}
+}
+
+// missingFields lists the thresholds required to create or replace a configuration
+func (req alertConfigRequest) missingFields() []response.FieldError {
+	var fields []response.FieldError
+	if req.MaxTemp == nil {
+		fields = append(fields, invalid("max_temperature", "is required"))
+	}
+	if req.MinTemp == nil {
+		fields = append(fields, invalid("min_temperature", "is required"))
+	}
+	if req.RateOfChangeThreshold == nil {
+		fields = append(fields, invalid("rate_of_change_threshold", "is required"))
+	}
+	if req.Priority == nil {
+		fields = append(fields, invalid("priority", "is required"))
+	}
+	return fields
+}
+
+// validateAlertConfig checks a configuration against the chamber it belongs to
+func validateAlertConfig(c models.AlertConfig, chamber models.ColdChamber) []response.FieldError {
+	var fields []response.FieldError
+
+	if c.MinTemp >= c.MaxTemp {
+		fields = append(fields, invalid("min_temperature", "must be lower than max_temperature"))
+	}
+
+	// Los umbrales deben caer dentro del rango físico del tipo de cámara y contener la temperatura objetivo
+	low, high := service.PhysicalRange(chamber.TargetTemperature)
+	if c.MaxTemp < low || c.MaxTemp > high {
+		fields = append(fields, invalid("max_temperature", fmt.Sprintf("must be between %.0f and %.0f for this chamber", low, high)))
+	}
+	if c.MinTemp < low || c.MinTemp > high {
+		fields = append(fields, invalid("min_temperature", fmt.Sprintf("must be between %.0f and %.0f for this chamber", low, high)))
+	}
+	if c.MinTemp < c.MaxTemp && (chamber.TargetTemperature < c.MinTemp || chamber.TargetTemperature > c.MaxTemp) {
+		fields = append(fields, invalid("max_temperature", fmt.Sprintf("range must include the target temperature (%.1f)", chamber.TargetTemperature)))
+	}
+
+	if c.RateOfChangeThreshold <= 0 || c.RateOfChangeThreshold > maxRateOfChangeThreshold {
+		fields = append(fields, invalid("rate_of_change_threshold", fmt.Sprintf("must be greater than 0 and at most %.0f", maxRateOfChangeThreshold)))
+	}
+	if c.Priority < minAlertPriority || c.Priority > maxAlertPriority {
+		fields = append(fields, invalid("priority", "must be 0 (P1, highest), 1 (P2) or 2 (P3)"))
+	}
+
+	channels := make(map[string]bool)
+	for _, ch := range c.NotificationChannels {
+		if !notificationChannels[ch] {
+			fields = append(fields, invalid("notification_channels", "unknown channel '" + ch + "'"))
+		}
+		channels[ch] = true
+	}
+
+	var phones, emails int
+	for _, rcp := range c.Recipients {
+		switch {
+		case phonePattern.MatchString(rcp):
+			phones++
+		case emailPattern.MatchString(rcp):
+			emails++
+		default:
+			fields = append(fields, invalid("recipients", "'" + rcp + "' is not an E.164 phone number or an email address"))
+		}
+	}
+	if channels["sms"] && phones == 0 {
+		fields = append(fields, invalid("recipients", "channel 'sms' requires at least one phone number"))
+	}
+	if channels["email"] && emails == 0 {
+		fields = append(fields, invalid("recipients", "channel 'email' requires at least one email address"))
+	}
+
+	return fields
+}
+
+// alertConfigQuery reads the configuration of one sensor, in the column order of scanAlertConfig
+const alertConfigQuery = `
+		SELECT id, sensor_id, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, revision, created_at, updated_at 
 		FROM alert_configs 
 		WHERE sensor_id = ?`
 
-	row := db.DB.QueryRow(query, sensorID)
+// loadAlertConfig reads the alert configuration of a sensor (sql.ErrNoRows if missing)
+func loadAlertConfig(sensorID string) (models.AlertConfig, error) {
+	return scanAlertConfig(db.DB.QueryRow(alertConfigQuery, sensorID))
+}
 
+func scanAlertConfig(row *sql.Row) (models.AlertConfig, error) {
 	var c models.AlertConfig
 	var channelsJSON, recipientsJSON []byte
 
-	err := row.Scan(&c.ID, &c.SensorID, &c.MaxTemp, &c.MinTemp, &c.RateOfChangeThreshold, &c.Priority, &c.IsEnabled, &channelsJSON, &recipientsJSON, &c.CreatedAt, &c.UpdatedAt)
+	err := row.Scan(&c.ID, &c.SensorID, &c.MaxTemp, &c.MinTemp, &c.RateOfChangeThreshold, &c.Priority, &c.IsEnabled, &channelsJSON, &recipientsJSON, &c.Revision, &c.CreatedAt, &c.UpdatedAt)
 	if err != nil {
-		// If not found, return a default config or 404. Ideally we should create a default one.
-		// For now returning 404 to be safe.
-		http.Error(w, "Configuration not found", http.StatusNotFound)
-		return
+		return c, err
 	}
 
 	// Parse JSON fields
 	json.Unmarshal(channelsJSON, &c.NotificationChannels)
 	json.Unmarshal(recipientsJSON, &c.Recipients)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(c)
+	return c, nil
 }
 
-// UpdateAlertConfig updates the configuration
-func UpdateAlertConfig(w http.ResponseWriter, r *http.Request) {
+// GetAlertConfig returns the alert configuration for a sensor. Chambers without
+// one get the default of their product category, stored as revision 1.
+func GetAlertConfig(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sensorID := vars["id"]
 
-	var c models.AlertConfig
-	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	c, err := loadAlertConfig(sensorID)
+	if err == sql.ErrNoRows {
+		chamber, err := loadChamber(sensorID)
+		if err == sql.ErrNoRows {
+			response.Fail(w, response.NotFound("chamber "+sensorID+" not found"))
+			return
+		} else if err != nil {
+			response.Fail(w, err)
+			return
+		}
+
+		var created bool
+		c, created, err = ensureAlertConfig(chamber, nil)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if created {
+			recordAudit(r, service.AuditConfigDefault, "alert_config", sensorID, chamberLocation(sensorID), nil, c)
+		}
+	} else if err != nil {
+		response.Fail(w, err)
 		return
 	}
 
-	// Marshall JSON fields for DB
-	channelsJSON, _ := json.Marshal(c.NotificationChannels)
-	recipientsJSON, _ := json.Marshal(c.Recipients)
+	response.JSON(w, http.StatusOK, c)
+}
+
+// ensureAlertConfig stores the default configuration of a chamber unless it already
+// has one, and returns the configuration in effect. created is false if another
+// request got there first.
+func ensureAlertConfig(chamber models.ColdChamber, createdBy *string) (models.AlertConfig, bool, error) {
+	c := service.DefaultAlertConfig(chamber)
+
+	channelsJSON, err := json.Marshal(c.NotificationChannels)
+	if err != nil {
+		return c, false, err
+	}
+	recipientsJSON, err := json.Marshal(c.Recipients)
+	if err != nil {
+		return c, false, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return c, false, err
+	}
+	defer tx.Rollback()
 
 	query := `
-		UPDATE alert_configs 
-		SET max_temperature=?, min_temperature=?, rate_of_change_threshold=?, priority=?, is_enabled=?, notification_channels=?, recipients=?, updated_at=NOW() 
-		WHERE sensor_id=?`
+		INSERT IGNORE INTO alert_configs (id, sensor_id, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, revision)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`
 
-	_, err := db.DB.Exec(query, c.MaxTemp, c.MinTemp, c.RateOfChangeThreshold, c.Priority, c.IsEnabled, channelsJSON, recipientsJSON, sensorID)
+	res, err := tx.Exec(query, "CONFIG-"+chamber.ID, chamber.ID, c.MaxTemp, c.MinTemp, c.RateOfChangeThreshold, c.Priority, c.IsEnabled, channelsJSON, recipientsJSON)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return c, false, err
+	}
+
+	created := false
+	if n, _ := res.RowsAffected(); n > 0 {
+		query = `
+			INSERT INTO alert_config_revisions (sensor_id, revision, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, created_by)
+			VALUES (?, 1, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+		if _, err := tx.Exec(query, chamber.ID, c.MaxTemp, c.MinTemp, c.RateOfChangeThreshold, c.Priority, c.IsEnabled, channelsJSON, recipientsJSON, createdBy); err != nil {
+			return c, false, err
+		}
+		created = true
+	}
+	if err := tx.Commit(); err != nil {
+		return c, false, err
+	}
+
+	stored, err := loadAlertConfig(chamber.ID)
+	return stored, created, err
+}
+
+// UpdateAlertConfig replaces the configuration (creating it if missing) as a new revision
+func UpdateAlertConfig(w http.ResponseWriter, r *http.Request) {
+	writeAlertConfig(w, r, false)
+}
+
+// PatchAlertConfig updates only the fields present in the body, as a new revision
+func PatchAlertConfig(w http.ResponseWriter, r *http.Request) {
+	writeAlertConfig(w, r, true)
+}
+
+// writeAlertConfig implements PUT (full replacement) and PATCH (partial update).
+// Both create the configuration if the sensor has none: PUT from the body alone,
+// PATCH on top of the chamber's default template.
+func writeAlertConfig(w http.ResponseWriter, r *http.Request, partial bool) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	chamber, err := loadChamber(sensorID)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("chamber "+sensorID+" not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var req alertConfigRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		response.Fail(w, response.BadRequest("invalid JSON body: "+err.Error()))
+		return
+	}
+
+	// Base de un PATCH; el estado previo de la auditoría lo lee saveAlertConfig con la fila bloqueada
+	current, err := loadAlertConfig(sensorID)
+	if err != nil && err != sql.ErrNoRows {
+		response.Fail(w, err)
+		return
+	}
+
+	c := models.AlertConfig{
+		SensorID:             sensorID,
+		IsEnabled:            true,
+		NotificationChannels: []string{},
+		Recipients:           []string{},
+	}
+	if partial && err == nil {
+		c = current
+	} else if partial {
+		c = service.DefaultAlertConfig(chamber)
+	} else if missing := req.missingFields(); len(missing) > 0 {
+		response.Fail(w, response.Validation(missing))
+		return
+	}
+	req.apply(&c)
+
+	if fields := validateAlertConfig(c, chamber); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	before, err := saveAlertConfig(&c, requestUserID(r), nil)
+	if err != nil {
+		response.Fail(w, err)
 		return
 	}
 
-	// Return updated config (fetching it again to be sure)
-	// For simplicity, we just return what we received + updated timestamp
-	c.SensorID = sensorID
-	c.UpdatedAt = time.Now()
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(c)
+	c.ID = "CONFIG-" + sensorID
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = c.CreatedAt
+	if before != nil {
+		c.ID = before.ID
+		c.CreatedAt = before.CreatedAt
+	}
+
+	var previous interface{}
+	if before != nil {
+		previous = *before
+	}
+	recordAudit(r, service.AuditConfigUpdate, "alert_config", sensorID, chamberLocation(sensorID), previous, c)
+
+	status := http.StatusOK
+	if before == nil {
+		status = http.StatusCreated
+	}
+	response.JSON(w, status, c)
+}
+
+// saveAlertConfig writes (or creates) the configuration of c.SensorID and appends
+// it as a new revision, setting c.Revision. It returns the configuration it replaced
+// (nil if there was none), read with the row locked so that concurrent writes each
+// get the revision right before their own for the audit trail.
+func saveAlertConfig(c *models.AlertConfig, createdBy *string, rolledBackFrom *int) (*models.AlertConfig, error) {
+	channelsJSON, err := json.Marshal(c.NotificationChannels)
+	if err != nil {
+		return nil, err
+	}
+	recipientsJSON, err := json.Marshal(c.Recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var before *models.AlertConfig
+	current, err := scanAlertConfig(tx.QueryRow(alertConfigQuery+` FOR UPDATE`, c.SensorID))
+	if err == nil {
+		before = &current
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// sensor_id es UNIQUE: si ya existe se actualiza y se incrementa la revisión
+	query := `
+		INSERT INTO alert_configs (id, sensor_id, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, revision)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+		ON DUPLICATE KEY UPDATE 
+			max_temperature=VALUES(max_temperature), min_temperature=VALUES(min_temperature), rate_of_change_threshold=VALUES(rate_of_change_threshold), 
+			priority=VALUES(priority), is_enabled=VALUES(is_enabled), notification_channels=VALUES(notification_channels), recipients=VALUES(recipients), 
+			revision=revision+1, updated_at=NOW()`
+
+	_, err = tx.Exec(query, "CONFIG-"+c.SensorID, c.SensorID, c.MaxTemp, c.MinTemp, c.RateOfChangeThreshold, c.Priority, c.IsEnabled, channelsJSON, recipientsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	// La fila queda bloqueada por la escritura, así que la revisión leída es la nuestra
+	if err := tx.QueryRow(`SELECT revision FROM alert_configs WHERE sensor_id = ?`, c.SensorID).Scan(&c.Revision); err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO alert_config_revisions (sensor_id, revision, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, created_by, rolled_back_from)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if _, err := tx.Exec(query, c.SensorID, c.Revision, c.MaxTemp, c.MinTemp, c.RateOfChangeThreshold, c.Priority, c.IsEnabled, channelsJSON, recipientsJSON, createdBy, rolledBackFrom); err != nil {
+		return nil, err
+	}
+
+	return before, tx.Commit()
 }
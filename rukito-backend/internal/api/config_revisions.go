@@ -0,0 +1,247 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type rollbackRequest struct {
+	Revision int `json:"revision"`
+}
+
+const revisionColumns = `sensor_id, revision, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients, created_by, rolled_back_from, created_at`
+
+func scanRevision(row interface{ Scan(...interface{}) error }) (models.AlertConfigRevision, error) {
+	var rev models.AlertConfigRevision
+	var channelsJSON, recipientsJSON []byte
+	var createdBy sql.NullString
+	var rolledBackFrom sql.NullInt64
+
+	err := row.Scan(&rev.SensorID, &rev.Revision, &rev.MaxTemp, &rev.MinTemp, &rev.RateOfChangeThreshold, &rev.Priority, &rev.IsEnabled,
+		&channelsJSON, &recipientsJSON, &createdBy, &rolledBackFrom, &rev.CreatedAt)
+	if err != nil {
+		return rev, err
+	}
+
+	json.Unmarshal(channelsJSON, &rev.NotificationChannels)
+	json.Unmarshal(recipientsJSON, &rev.Recipients)
+
+	if createdBy.Valid {
+		val := createdBy.String
+		rev.CreatedBy = &val
+	}
+	if rolledBackFrom.Valid {
+		val := int(rolledBackFrom.Int64)
+		rev.RolledBackFrom = &val
+	}
+	return rev, nil
+}
+
+// loadRevision reads one revision of a sensor's configuration (sql.ErrNoRows if missing)
+func loadRevision(sensorID string, revision int) (models.AlertConfigRevision, error) {
+	row := db.DB.QueryRow(`SELECT `+revisionColumns+` FROM alert_config_revisions WHERE sensor_id = ? AND revision = ?`, sensorID, revision)
+	return scanRevision(row)
+}
+
+// revisionSettings keeps only the alerting settings of a revision, so diffs
+// ignore bookkeeping fields (revision number, author, timestamps)
+func revisionSettings(rev models.AlertConfigRevision) map[string]interface{} {
+	return map[string]interface{}{
+		"max_temperature":          rev.MaxTemp,
+		"min_temperature":          rev.MinTemp,
+		"rate_of_change_threshold": rev.RateOfChangeThreshold,
+		"priority":                 rev.Priority,
+		"is_enabled":               rev.IsEnabled,
+		"notification_channels":    rev.NotificationChannels,
+		"recipients":               rev.Recipients,
+	}
+}
+
+// requestUserID returns the ID of the authenticated user, or nil
+func requestUserID(r *http.Request) *string {
+	claims := auth.FromContext(r.Context())
+	if claims == nil {
+		return nil
+	}
+	id := claims.UserID
+	return &id
+}
+
+// GetAlertConfigRevisions returns the configuration history of a sensor, newest first
+func GetAlertConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT `+revisionColumns+` FROM alert_config_revisions WHERE sensor_id = ? ORDER BY revision DESC`, sensorID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var revisions []models.AlertConfigRevision
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+
+	response.JSON(w, http.StatusOK, revisions)
+}
+
+// GetAlertConfigRevision returns a single revision
+func GetAlertConfigRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	revision, _ := strconv.Atoi(vars["revision"])
+	rev, err := loadRevision(sensorID, revision)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Revision not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, rev)
+}
+
+// DiffAlertConfigRevisions compares the settings of two revisions
+// Query Params: from, to (revision numbers; to defaults to the active revision)
+func DiffAlertConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	from, err := queryInt(r, "from")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if from == nil {
+		response.Fail(w, response.BadRequest("Missing 'from' query parameter"))
+		return
+	}
+	toParam, err := queryInt(r, "to")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var to int
+	if toParam != nil {
+		to = *toParam
+	} else if err := db.DB.QueryRow(`SELECT revision FROM alert_configs WHERE sensor_id = ?`, sensorID).Scan(&to); err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Configuration not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	revs := make([]models.AlertConfigRevision, 2)
+	for i, n := range []int{*from, to} {
+		revs[i], err = loadRevision(sensorID, n)
+		if err == sql.ErrNoRows {
+			response.Fail(w, response.NotFound("Revision not found: "+strconv.Itoa(n)))
+			return
+		} else if err != nil {
+			response.Fail(w, err)
+			return
+		}
+	}
+
+	diff := models.AlertConfigDiff{
+		SensorID: sensorID,
+		From:     *from,
+		To:       to,
+		Changes:  service.DiffFields(revisionSettings(revs[0]), revisionSettings(revs[1])),
+	}
+
+	response.JSON(w, http.StatusOK, diff)
+}
+
+// RollbackAlertConfig restores the settings of an older revision. The history is
+// never rewritten: the restored settings become a new revision.
+func RollbackAlertConfig(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	var req rollbackRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	current, err := loadAlertConfig(sensorID)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Configuration not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	target, err := loadRevision(sensorID, req.Revision)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Revision not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	c := models.AlertConfig{
+		ID:                    current.ID,
+		SensorID:              sensorID,
+		MaxTemp:               target.MaxTemp,
+		MinTemp:               target.MinTemp,
+		RateOfChangeThreshold: target.RateOfChangeThreshold,
+		Priority:              target.Priority,
+		IsEnabled:             target.IsEnabled,
+		NotificationChannels:  target.NotificationChannels,
+		Recipients:            target.Recipients,
+		CreatedAt:             current.CreatedAt,
+	}
+
+	// El estado previo de la auditoría es el que reemplazó esta escritura, no el leído arriba
+	before, err := saveAlertConfig(&c, requestUserID(r), &target.Revision)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	c.UpdatedAt = time.Now()
+
+	recordAudit(r, service.AuditConfigRollback, "alert_config", sensorID, chamberLocation(sensorID), before, c)
+
+	response.JSON(w, http.StatusOK, c)
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+)
+
+// dispositions son los destinos de producto aceptados en una acción correctiva
+var dispositions = map[string]bool{
+	models.DispositionKept:      true,
+	models.DispositionMoved:     true,
+	models.DispositionDiscarded: true,
+}
+
+// correctiveActionRequest is the body of POST /corrective-actions.
+// It must reference an alert (alert_id), an excursion (excursion_id) or an
+// excursion by its start (chamber_id + excursion_start).
+type correctiveActionRequest struct {
+	AlertID        *string    `json:"alert_id"`
+	ExcursionID    *string    `json:"excursion_id"`
+	ChamberID      string     `json:"chamber_id"`
+	ExcursionStart *time.Time `json:"excursion_start"`
+	Action         string     `json:"action"`
+	Disposition    string     `json:"disposition"`
+	PerformedBy    string     `json:"performed_by"`
+	PerformedAt    *time.Time `json:"performed_at"`
+	Notes          *string    `json:"notes"`
+}
+
+// GetCorrectiveActions returns the corrective actions of the user's locations, newest first
+// Query Params: chamber_id, alert_id, excursion_id, start, end (ISO8601, on performed_at), limit (default 100), location_id
+func GetCorrectiveActions(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var conditions []string
+	var args []interface{}
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	for param, column := range map[string]string{"chamber_id": "ca.sensor_id", "alert_id": "ca.alert_id", "excursion_id": "ca.excursion_id"} {
+		if v := r.URL.Query().Get(param); v != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, v)
+		}
+	}
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "ca.performed_at "+op+" ?")
+			args = append(args, *t)
+		}
+	}
+
+	query := `
+		SELECT ` + correctiveActionColumns + `
+		FROM corrective_actions ca
+		JOIN chambers c ON c.id = ca.sensor_id`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY ca.performed_at DESC, ca.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	actions := []models.CorrectiveAction{}
+	for rows.Next() {
+		a, err := scanCorrectiveAction(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		actions = append(actions, a)
+	}
+
+	response.JSON(w, http.StatusOK, actions)
+}
+
+// correctiveActionColumns are the columns read by scanCorrectiveAction (corrective_actions aliased as ca)
+const correctiveActionColumns = `ca.id, ca.sensor_id, ca.alert_id, ca.excursion_id, ca.excursion_start, ca.action, ca.disposition, ca.performed_by, ca.performed_at, ca.notes, ca.recorded_by, ca.created_at`
+
+func scanCorrectiveAction(rows *sql.Rows) (models.CorrectiveAction, error) {
+	var a models.CorrectiveAction
+	var alertID, excursionID, notes, recordedBy sql.NullString
+	var excursionStart sql.NullTime
+
+	err := rows.Scan(&a.ID, &a.SensorID, &alertID, &excursionID, &excursionStart, &a.Action, &a.Disposition, &a.PerformedBy, &a.PerformedAt, &notes, &recordedBy, &a.CreatedAt)
+	if err != nil {
+		return a, err
+	}
+
+	if alertID.Valid {
+		val := alertID.String
+		a.AlertID = &val
+	}
+	if excursionID.Valid {
+		val := excursionID.String
+		a.ExcursionID = &val
+	}
+	if excursionStart.Valid {
+		val := excursionStart.Time
+		a.ExcursionStart = &val
+	}
+	if notes.Valid {
+		val := notes.String
+		a.Notes = &val
+	}
+	if recordedBy.Valid {
+		val := recordedBy.String
+		a.RecordedBy = &val
+	}
+	return a, nil
+}
+
+// CreateCorrectiveAction documents what was done about an alert or excursion.
+// performed_by defaults to the authenticated user and performed_at to now.
+func CreateCorrectiveAction(w http.ResponseWriter, r *http.Request) {
+	var req correctiveActionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var fields []response.FieldError
+	if strings.TrimSpace(req.Action) == "" {
+		fields = append(fields, invalid("action", "is required"))
+	}
+	if !dispositions[req.Disposition] {
+		fields = append(fields, invalid("disposition", "must be kept, moved or discarded"))
+	}
+	if req.PerformedAt != nil && req.PerformedAt.After(time.Now().Add(5*time.Minute)) {
+		fields = append(fields, invalid("performed_at", "must not be in the future"))
+	}
+	if req.AlertID == nil && req.ExcursionID == nil && req.ExcursionStart == nil {
+		fields = append(fields, invalid("alert_id", "alert_id, excursion_id or excursion_start is required"))
+	}
+	if req.AlertID == nil && req.ExcursionID == nil && req.ExcursionStart != nil && req.ChamberID == "" {
+		fields = append(fields, invalid("chamber_id", "is required with excursion_start"))
+	}
+	if len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	// Con una alerta, la cámara (y la excursión, si la tiene) son las de la alerta
+	if req.AlertID != nil {
+		var sensorID string
+		var excursionID sql.NullString
+		err := db.DB.QueryRow(`SELECT sensor_id, excursion_id FROM alerts WHERE id = ?`, *req.AlertID).Scan(&sensorID, &excursionID)
+		if err == sql.ErrNoRows {
+			response.Fail(w, response.NotFound("Alert not found"))
+			return
+		} else if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if req.ChamberID != "" && req.ChamberID != sensorID {
+			response.Fail(w, response.Validation([]response.FieldError{invalid("chamber_id", "does not match the alert's chamber")}))
+			return
+		}
+		if req.ExcursionID != nil && (!excursionID.Valid || *req.ExcursionID != excursionID.String) {
+			response.Fail(w, response.Validation([]response.FieldError{invalid("excursion_id", "does not match the alert's excursion")}))
+			return
+		}
+		req.ChamberID = sensorID
+		if excursionID.Valid {
+			val := excursionID.String
+			req.ExcursionID = &val
+		}
+	}
+
+	// Con una excursión registrada, su inicio se guarda también en excursion_start
+	if req.ExcursionID != nil {
+		var sensorID string
+		var startedAt time.Time
+		err := db.DB.QueryRow(`SELECT sensor_id, started_at FROM excursions WHERE id = ?`, *req.ExcursionID).Scan(&sensorID, &startedAt)
+		if err == sql.ErrNoRows {
+			response.Fail(w, response.NotFound("Excursion not found"))
+			return
+		} else if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if req.ChamberID != "" && req.ChamberID != sensorID {
+			response.Fail(w, response.Validation([]response.FieldError{invalid("chamber_id", "does not match the excursion's chamber")}))
+			return
+		}
+		req.ChamberID = sensorID
+		req.ExcursionStart = &startedAt
+	}
+
+	if !checkChamberAccess(w, r, req.ChamberID) {
+		return
+	}
+
+	a := models.CorrectiveAction{
+		ID:             "CA-" + uuid.New().String()[:8],
+		SensorID:       req.ChamberID,
+		AlertID:        req.AlertID,
+		ExcursionID:    req.ExcursionID,
+		ExcursionStart: req.ExcursionStart,
+		Action:         strings.TrimSpace(req.Action),
+		Disposition:    req.Disposition,
+		PerformedBy:    strings.TrimSpace(req.PerformedBy),
+		PerformedAt:    time.Now(),
+		Notes:          req.Notes,
+		RecordedBy:     requestUserID(r),
+		CreatedAt:      time.Now(),
+	}
+	if req.PerformedAt != nil {
+		a.PerformedAt = *req.PerformedAt
+	}
+	if a.PerformedBy == "" {
+		if claims := auth.FromContext(r.Context()); claims != nil {
+			a.PerformedBy = claims.Username
+		}
+	}
+
+	query := `
+		INSERT INTO corrective_actions (id, sensor_id, alert_id, excursion_id, excursion_start, action, disposition, performed_by, performed_at, notes, recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.DB.Exec(query, a.ID, a.SensorID, a.AlertID, a.ExcursionID, a.ExcursionStart, a.Action, a.Disposition, a.PerformedBy, a.PerformedAt, a.Notes, a.RecordedBy)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, ""))
+		return
+	}
+
+	recordAudit(r, service.AuditCorrectiveAction, "corrective_action", a.ID, chamberLocation(a.SensorID), nil, a)
+
+	response.JSON(w, http.StatusCreated, a)
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// defrostScheduleRequest is the body of POST /chambers/{id}/defrost-schedules and
+// PUT /defrost-schedules/{id}; on update, absent fields are kept
+type defrostScheduleRequest struct {
+	StartTime       *string  `json:"start_time"` // HH:MM, local time (EXPORT_TIMEZONE)
+	DurationMinutes *int     `json:"duration_minutes"`
+	RecoveryMinutes *int     `json:"recovery_minutes"`
+	MaxTemperature  *float64 `json:"max_temperature"`
+	Active          *bool    `json:"active"`
+	Notes           *string  `json:"notes"`
+}
+
+// validate checks the fields present; creating requires start_time and duration_minutes
+func (req defrostScheduleRequest) validate(creating bool) []response.FieldError {
+	var fields []response.FieldError
+	if req.StartTime == nil {
+		if creating {
+			fields = append(fields, invalid("start_time", "is required"))
+		}
+	} else if _, err := service.ParseDefrostStart(*req.StartTime); err != nil || strings.Count(*req.StartTime, ":") != 1 {
+		fields = append(fields, invalid("start_time", "must be HH:MM"))
+	}
+	if req.DurationMinutes == nil {
+		if creating {
+			fields = append(fields, invalid("duration_minutes", "is required"))
+		}
+	} else if *req.DurationMinutes < 1 || *req.DurationMinutes > 120 {
+		fields = append(fields, invalid("duration_minutes", "must be between 1 and 120"))
+	}
+	if req.RecoveryMinutes != nil && (*req.RecoveryMinutes < 1 || *req.RecoveryMinutes > 240) {
+		fields = append(fields, invalid("recovery_minutes", "must be between 1 and 240"))
+	}
+	return fields
+}
+
+// normalizeDefrostStart writes a validated start time as HH:MM ("6:00" becomes "06:00")
+func normalizeDefrostStart(value string) string {
+	start, _ := service.ParseDefrostStart(value)
+	return fmt.Sprintf("%02d:%02d", int(start.Hours()), int(start.Minutes())%60)
+}
+
+// defrostScheduleColumns are the columns read by scanDefrostSchedule
+const defrostScheduleColumns = `id, sensor_id, TIME_FORMAT(start_time, '%H:%i'), duration_minutes, recovery_minutes, max_temperature, active, notes, recorded_by, created_at`
+
+func scanDefrostSchedule(row interface{ Scan(...interface{}) error }) (models.DefrostSchedule, error) {
+	var s models.DefrostSchedule
+	var maxTemperature sql.NullFloat64
+	var notes, recordedBy sql.NullString
+
+	err := row.Scan(&s.ID, &s.SensorID, &s.StartTime, &s.DurationMinutes, &s.RecoveryMinutes, &maxTemperature, &s.Active, &notes, &recordedBy, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+
+	if maxTemperature.Valid {
+		val := maxTemperature.Float64
+		s.MaxTemperature = &val
+	}
+	if notes.Valid {
+		val := notes.String
+		s.Notes = &val
+	}
+	if recordedBy.Valid {
+		val := recordedBy.String
+		s.RecordedBy = &val
+	}
+	return s, nil
+}
+
+// defrostCycleColumns are the columns read by scanDefrostCycle
+const defrostCycleColumns = `id, sensor_id, source, schedule_id, started_at, heating_until, recover_by, ended_at, peak_temperature, status`
+
+func scanDefrostCycle(row interface{ Scan(...interface{}) error }) (models.DefrostCycle, error) {
+	var c models.DefrostCycle
+	var scheduleID sql.NullString
+	var endedAt sql.NullTime
+
+	err := row.Scan(&c.ID, &c.SensorID, &c.Source, &scheduleID, &c.StartedAt, &c.HeatingUntil, &c.RecoverBy, &endedAt, &c.PeakTemperature, &c.Status)
+	if err != nil {
+		return c, err
+	}
+
+	if scheduleID.Valid {
+		val := scheduleID.String
+		c.ScheduleID = &val
+	}
+	if endedAt.Valid {
+		val := endedAt.Time
+		c.EndedAt = &val
+	}
+	return c, nil
+}
+
+// GetDefrostSchedules returns the defrost schedules of a chamber by start time
+func GetDefrostSchedules(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT `+defrostScheduleColumns+` FROM defrost_schedules WHERE sensor_id = ? ORDER BY start_time, id`, sensorID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	schedules := []models.DefrostSchedule{}
+	for rows.Next() {
+		s, err := scanDefrostSchedule(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		schedules = append(schedules, s)
+	}
+
+	response.JSON(w, http.StatusOK, schedules)
+}
+
+// CreateDefrostSchedule adds a daily defrost to a chamber.
+// The pipeline picks it up within a minute.
+func CreateDefrostSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	var req defrostScheduleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if fields := req.validate(true); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	s := models.DefrostSchedule{
+		ID:              "DFS-" + uuid.New().String()[:8],
+		SensorID:        sensorID,
+		StartTime:       normalizeDefrostStart(*req.StartTime),
+		DurationMinutes: *req.DurationMinutes,
+		RecoveryMinutes: 30,
+		MaxTemperature:  req.MaxTemperature,
+		Active:          true,
+		Notes:           req.Notes,
+		RecordedBy:      requestUserID(r),
+		CreatedAt:       time.Now(),
+	}
+	if req.RecoveryMinutes != nil {
+		s.RecoveryMinutes = *req.RecoveryMinutes
+	}
+	if req.Active != nil {
+		s.Active = *req.Active
+	}
+
+	query := `
+		INSERT INTO defrost_schedules (id, sensor_id, start_time, duration_minutes, recovery_minutes, max_temperature, active, notes, recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.DB.Exec(query, s.ID, s.SensorID, s.StartTime, s.DurationMinutes, s.RecoveryMinutes, s.MaxTemperature, s.Active, s.Notes, s.RecordedBy)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, ""))
+		return
+	}
+
+	recordAudit(r, service.AuditDefrostCreate, "defrost_schedule", s.ID, chamberLocation(sensorID), nil, s)
+
+	response.JSON(w, http.StatusCreated, s)
+}
+
+// UpdateDefrostSchedule edits a defrost schedule; "active": false disables it
+func UpdateDefrostSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req defrostScheduleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if fields := req.validate(false); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	before, err := scanDefrostSchedule(db.DB.QueryRow(`SELECT `+defrostScheduleColumns+` FROM defrost_schedules WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Defrost schedule not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if !checkChamberAccess(w, r, before.SensorID) {
+		return
+	}
+
+	s := before
+	if req.StartTime != nil {
+		s.StartTime = normalizeDefrostStart(*req.StartTime)
+	}
+	if req.DurationMinutes != nil {
+		s.DurationMinutes = *req.DurationMinutes
+	}
+	if req.RecoveryMinutes != nil {
+		s.RecoveryMinutes = *req.RecoveryMinutes
+	}
+	if req.MaxTemperature != nil {
+		s.MaxTemperature = req.MaxTemperature
+	}
+	if req.Active != nil {
+		s.Active = *req.Active
+	}
+	if req.Notes != nil {
+		s.Notes = req.Notes
+	}
+
+	query := `
+		UPDATE defrost_schedules
+		SET start_time = ?, duration_minutes = ?, recovery_minutes = ?, max_temperature = ?, active = ?, notes = ?
+		WHERE id = ?`
+
+	_, err = db.DB.Exec(query, s.StartTime, s.DurationMinutes, s.RecoveryMinutes, s.MaxTemperature, s.Active, s.Notes, id)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, ""))
+		return
+	}
+
+	recordAudit(r, service.AuditDefrostUpdate, "defrost_schedule", id, chamberLocation(s.SensorID), before, s)
+
+	response.JSON(w, http.StatusOK, s)
+}
+
+// GetDefrostCycles returns the defrosts recognized in a chamber, newest first
+// Query Params: start, end (ISO8601, on started_at), status (in_progress|recovered|prolonged), limit (default 100)
+func GetDefrostCycles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	conditions := []string{`sensor_id = ?`}
+	args := []interface{}{sensorID}
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "started_at "+op+" ?")
+			args = append(args, *t)
+		}
+	}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case models.DefrostInProgress, models.DefrostRecovered, models.DefrostProlonged:
+		conditions = append(conditions, `status = ?`)
+		args = append(args, status)
+	default:
+		response.Fail(w, response.BadRequest("'status' must be in_progress, recovered or prolonged"))
+		return
+	}
+
+	query := `
+		SELECT ` + defrostCycleColumns + `
+		FROM defrost_cycles
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	cycles := []models.DefrostCycle{}
+	for rows.Next() {
+		c, err := scanDefrostCycle(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		cycles = append(cycles, c)
+	}
+
+	response.JSON(w, http.StatusOK, cycles)
+}
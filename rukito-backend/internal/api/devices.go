@@ -0,0 +1,373 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type createDeviceRequest struct {
+	ID        string `json:"id"`
+	ChamberID string `json:"chamber_id"`
+	Name      string `json:"name"`
+}
+
+// ingestReading is one reading sent by a device. SensorID is optional and,
+// when present, must match the chamber the device is bound to.
+type ingestReading struct {
+	SensorID    string     `json:"sensor_id"`
+	Temperature *float64   `json:"temperature"`
+	Timestamp   *time.Time `json:"timestamp"`
+}
+
+type ingestRequest struct {
+	Readings []ingestReading `json:"readings"`
+}
+
+const deviceColumns = `id, chamber_id, name, key_rotated_at, last_seen_at, revoked_at, created_at`
+
+func scanDevice(row interface{ Scan(...interface{}) error }) (models.Device, error) {
+	var d models.Device
+	var lastSeen, revokedAt sql.NullTime
+
+	err := row.Scan(&d.ID, &d.ChamberID, &d.Name, &d.KeyRotatedAt, &lastSeen, &revokedAt, &d.CreatedAt)
+	if err != nil {
+		return d, err
+	}
+
+	if lastSeen.Valid {
+		val := lastSeen.Time
+		d.LastSeenAt = &val
+	}
+	if revokedAt.Valid {
+		val := revokedAt.Time
+		d.RevokedAt = &val
+	}
+	return d, nil
+}
+
+// GetDevices returns the device registry of the user's locations
+// Query Params: location_id
+func GetDevices(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `SELECT ` + deviceColumns + ` FROM devices`
+	where, args := scope.clause("c.location_id")
+	if where != "" {
+		query += ` WHERE chamber_id IN (SELECT c.id FROM chambers c WHERE ` + where + `)`
+	}
+	query += ` ORDER BY chamber_id, id`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var devices []models.Device
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		devices = append(devices, d)
+	}
+
+	response.JSON(w, http.StatusOK, devices)
+}
+
+// CreateDevice registers a device bound to a chamber and returns its API key (shown only once)
+func CreateDevice(w http.ResponseWriter, r *http.Request) {
+	var req createDeviceRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if req.ID == "" || req.ChamberID == "" {
+		response.Fail(w, response.BadRequest("Missing 'id' or 'chamber_id'"))
+		return
+	}
+	if !checkChamberAccess(w, r, req.ChamberID) {
+		return
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM chambers WHERE id = ?)`, req.ChamberID).Scan(&exists); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if !exists {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	}
+
+	key, hash, err := service.GenerateDeviceKey()
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	now := time.Now()
+
+	_, err = db.DB.Exec(`INSERT INTO devices (id, chamber_id, name, api_key_hash, key_rotated_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		req.ID, req.ChamberID, req.Name, hash, now, now)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, "Device "+req.ID+" already exists"))
+		return
+	}
+
+	creds := models.DeviceCredentials{
+		Device: models.Device{ID: req.ID, ChamberID: req.ChamberID, Name: req.Name, KeyRotatedAt: now, CreatedAt: now},
+		APIKey: key,
+	}
+
+	// Se audita el dispositivo, nunca la API key
+	recordAudit(r, service.AuditDeviceCreate, "device", req.ID, chamberLocation(req.ChamberID), nil, creds.Device)
+
+	response.JSON(w, http.StatusCreated, creds)
+}
+
+// checkDeviceAccess writes a 404 and returns false if the device does not exist
+// or is bound to a chamber outside the user's locations
+func checkDeviceAccess(w http.ResponseWriter, r *http.Request, deviceID string) bool {
+	var chamberID string
+	err := db.DB.QueryRow(`SELECT chamber_id FROM devices WHERE id = ?`, deviceID).Scan(&chamberID)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Device not found"))
+		return false
+	} else if err != nil {
+		response.Fail(w, err)
+		return false
+	}
+	return checkChamberAccess(w, r, chamberID)
+}
+
+// RotateDeviceKey issues a new API key. The previous key keeps working
+// for the configured grace period so the device can be reconfigured.
+func RotateDeviceKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	if !checkDeviceAccess(w, r, deviceID) {
+		return
+	}
+
+	key, hash, err := service.GenerateDeviceKey()
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	now := time.Now()
+
+	query := `
+		UPDATE devices
+		SET previous_key_hash = api_key_hash, previous_key_expires_at = ?, api_key_hash = ?, key_rotated_at = ?
+		WHERE id = ? AND revoked_at IS NULL`
+
+	res, err := db.DB.Exec(query, now.Add(service.DeviceKeyGracePeriod()), hash, now, deviceID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Fail(w, response.NotFound("Device not found or revoked"))
+		return
+	}
+
+	d, err := scanDevice(db.DB.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`, deviceID))
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditDeviceRotateKey, "device", deviceID, chamberLocation(d.ChamberID),
+		nil, map[string]interface{}{"key_rotated_at": d.KeyRotatedAt})
+
+	response.JSON(w, http.StatusOK, models.DeviceCredentials{Device: d, APIKey: key})
+}
+
+// RevokeDevice permanently disables a device and all its keys
+func RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID := vars["id"]
+
+	if !checkDeviceAccess(w, r, deviceID) {
+		return
+	}
+
+	query := `UPDATE devices SET revoked_at = ?, previous_key_hash = NULL, previous_key_expires_at = NULL WHERE id = ? AND revoked_at IS NULL`
+	res, err := db.DB.Exec(query, time.Now(), deviceID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		response.Fail(w, response.NotFound("Device not found or already revoked"))
+		return
+	}
+
+	d, err := scanDevice(db.DB.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`, deviceID))
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditDeviceRevoke, "device", deviceID, chamberLocation(d.ChamberID),
+		nil, map[string]interface{}{"revoked_at": d.RevokedAt})
+
+	response.JSON(w, http.StatusOK, d)
+}
+
+// GetDeviceRejections returns the latest rejected ingestion attempts.
+// Attempts from unknown devices are only visible to owners.
+// Query Params: limit (default 100), device_id, location_id
+func GetDeviceRejections(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `
+		SELECT dr.id, COALESCE(dr.device_id, ''), COALESCE(dr.sensor_id, ''), COALESCE(dr.remote_addr, ''), dr.reason, dr.created_at 
+		FROM device_rejections dr 
+		LEFT JOIN devices d ON d.id = dr.device_id 
+		LEFT JOIN chambers c ON c.id = d.chamber_id`
+	var conditions []string
+	var args []interface{}
+
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	if deviceID := r.URL.Query().Get("device_id"); deviceID != "" {
+		conditions = append(conditions, `dr.device_id = ?`)
+		args = append(args, deviceID)
+	}
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	query += ` ORDER BY dr.created_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var rejections []models.DeviceRejection
+	for rows.Next() {
+		var rej models.DeviceRejection
+		if err := rows.Scan(&rej.ID, &rej.DeviceID, &rej.SensorID, &rej.RemoteAddr, &rej.Reason, &rej.CreatedAt); err != nil {
+			response.Fail(w, err)
+			return
+		}
+		rejections = append(rejections, rej)
+	}
+
+	response.JSON(w, http.StatusOK, rejections)
+}
+
+// IngestReadings accepts readings from a registered device.
+// Headers: X-Device-ID, X-API-Key. Readings are only accepted for the device's own chamber.
+func IngestReadings(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.Header.Get("X-Device-ID")
+	apiKey := r.Header.Get("X-API-Key")
+
+	if deviceID == "" || apiKey == "" {
+		service.LogDeviceRejection(deviceID, "", r.RemoteAddr, "missing credentials")
+		response.Fail(w, response.Unauthorized("Missing 'X-Device-ID' or 'X-API-Key' header"))
+		return
+	}
+
+	device, err := service.AuthenticateDevice(deviceID, apiKey)
+	switch err {
+	case nil:
+	case service.ErrDeviceUnknown, service.ErrDeviceRevoked, service.ErrDeviceBadKey:
+		service.LogDeviceRejection(deviceID, "", r.RemoteAddr, err.Error())
+		response.Fail(w, response.Unauthorized("Invalid device credentials"))
+		return
+	default:
+		response.Fail(w, err)
+		return
+	}
+
+	var req ingestRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if len(req.Readings) == 0 {
+		response.Fail(w, response.BadRequest("No readings in request"))
+		return
+	}
+
+	// Validar el lote completo antes de encolar nada
+	now := time.Now()
+	points := make([]service.DataPoint, 0, len(req.Readings))
+	for _, rd := range req.Readings {
+		if rd.SensorID != "" && rd.SensorID != device.ChamberID {
+			service.LogDeviceRejection(deviceID, rd.SensorID, r.RemoteAddr, service.ErrDeviceMismatch.Error())
+			response.Fail(w, response.Forbidden("Device is not bound to chamber "+rd.SensorID))
+			return
+		}
+		if rd.Temperature == nil {
+			response.Fail(w, response.BadRequest("Missing 'temperature' in reading"))
+			return
+		}
+
+		ts := now
+		if rd.Timestamp != nil {
+			ts = *rd.Timestamp
+			if ts.After(now.Add(5 * time.Minute)) {
+				response.Fail(w, response.BadRequest("Reading timestamp is in the future"))
+				return
+			}
+		}
+
+		points = append(points, service.DataPoint{SensorID: device.ChamberID, Temperature: *rd.Temperature, Timestamp: ts})
+	}
+
+	accepted := 0
+	for _, dp := range points {
+		if err := service.Ingest(dp); err != nil {
+			if accepted == 0 {
+				response.Fail(w, response.Unavailable(err.Error()))
+				return
+			}
+			break
+		}
+		accepted++
+	}
+
+	service.TouchDevice(deviceID)
+
+	response.JSON(w, http.StatusAccepted, map[string]interface{}{
+		"device_id":  deviceID,
+		"chamber_id": device.ChamberID,
+		"accepted":   accepted,
+		"dropped":    len(points) - accepted,
+	})
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Códigos de error de MySQL que se traducen a errores del cliente
+const (
+	mysqlDuplicateEntry   = 1062
+	mysqlMissingReference = 1452
+)
+
+// decodeJSON decodes the request body into v
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return response.BadRequest("invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+// dbWriteError maps an INSERT/UPDATE error: a duplicate key becomes a 409 with the
+// given details and a broken foreign key a 400. Anything else stays internal.
+func dbWriteError(err error, duplicate string) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlDuplicateEntry:
+			return response.Conflict(duplicate)
+		case mysqlMissingReference:
+			return response.BadRequest("references a record that does not exist")
+		}
+	}
+	return err
+}
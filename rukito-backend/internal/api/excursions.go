@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// excursionColumns are the columns read by scanExcursion (excursions aliased as e)
+const excursionColumns = `e.id, e.sensor_id, e.direction, e.threshold, e.started_at, e.ended_at, e.last_reading_at, e.peak_temperature, e.degree_minutes, e.mkt, e.activation_energy, e.reading_count,
+	(SELECT COUNT(*) FROM alerts a WHERE a.excursion_id = e.id),
+	EXISTS(SELECT 1 FROM corrective_actions ca WHERE ca.excursion_id = e.id)`
+
+func scanExcursion(row interface{ Scan(...interface{}) error }) (models.Excursion, error) {
+	var e models.Excursion
+	var endedAt sql.NullTime
+	var mkt, activationEnergy sql.NullFloat64
+
+	err := row.Scan(&e.ID, &e.SensorID, &e.Direction, &e.Threshold, &e.StartedAt, &endedAt, &e.LastReadingAt, &e.PeakTemperature, &e.DegreeMinutes,
+		&mkt, &activationEnergy, &e.ReadingCount, &e.AlertCount, &e.HasCorrectiveAction)
+	if err != nil {
+		return e, err
+	}
+
+	if mkt.Valid {
+		val := mkt.Float64
+		e.MKT = &val
+	}
+	if activationEnergy.Valid {
+		val := activationEnergy.Float64
+		e.ActivationEnergy = &val
+	}
+
+	// Una excursión abierta dura hasta ahora
+	end := time.Now()
+	if endedAt.Valid {
+		val := endedAt.Time
+		e.EndedAt = &val
+		end = val
+	}
+	e.DurationMinutes = end.Sub(e.StartedAt).Minutes()
+	return e, nil
+}
+
+// GetExcursions returns the excursions of the user's locations, newest first
+// Query Params: limit (default 50), cursor, chamber_id, direction (high|low), start, end (ISO8601, on started_at),
+// open_only (bool), missing_action (bool), location_id
+func GetExcursions(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	limit, err := queryLimit(r, 50)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	cursor, err := queryCursor(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var conditions []string
+	var args []interface{}
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	if chamberID := r.URL.Query().Get("chamber_id"); chamberID != "" {
+		conditions = append(conditions, `e.sensor_id = ?`)
+		args = append(args, chamberID)
+	}
+	switch direction := r.URL.Query().Get("direction"); direction {
+	case "":
+	case service.ExcursionHigh, service.ExcursionLow:
+		conditions = append(conditions, `e.direction = ?`)
+		args = append(args, direction)
+	default:
+		response.Fail(w, response.BadRequest("'direction' must be high or low"))
+		return
+	}
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "e.started_at "+op+" ?")
+			args = append(args, *t)
+		}
+	}
+
+	openOnly, err := queryBool(r, "open_only")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if openOnly {
+		conditions = append(conditions, `e.ended_at IS NULL`)
+	}
+	missingAction, err := queryBool(r, "missing_action")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if missingAction {
+		conditions = append(conditions, `NOT EXISTS(SELECT 1 FROM corrective_actions ca WHERE ca.excursion_id = e.id)`)
+	}
+
+	from := ` FROM excursions e JOIN chambers c ON c.id = e.sensor_id`
+	if len(conditions) > 0 {
+		from += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.DB.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if cursor != nil {
+		where, cursorArgs := cursor.clause("e.started_at", "e.id")
+		if len(conditions) > 0 {
+			from += ` AND ` + where
+		} else {
+			from += ` WHERE ` + where
+		}
+		args = append(args, cursorArgs...)
+	}
+
+	query := `
+		SELECT ` + excursionColumns + from + `
+		ORDER BY e.started_at DESC, e.id DESC
+		LIMIT ?`
+	args = append(args, limit+1) // una fila extra indica si hay página siguiente
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	excursions := []models.Excursion{}
+	for rows.Next() {
+		e, err := scanExcursion(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		excursions = append(excursions, e)
+	}
+
+	next := ""
+	if len(excursions) > limit {
+		excursions = excursions[:limit]
+		last := excursions[limit-1]
+		next = encodeCursor(last.StartedAt, last.ID)
+	}
+
+	writePageHeaders(w, total, next)
+	response.JSON(w, http.StatusOK, excursions)
+}
+
+// GetExcursion returns an excursion with its alerts and corrective actions
+func GetExcursion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	excursionID := vars["id"]
+
+	e, err := scanExcursion(db.DB.QueryRow(`SELECT `+excursionColumns+` FROM excursions e WHERE e.id = ?`, excursionID))
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Excursion not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if !checkChamberAccess(w, r, e.SensorID) {
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT `+alertColumns+` FROM alerts a WHERE a.excursion_id = ? ORDER BY a.timestamp ASC, a.id ASC`, e.ID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	e.Alerts = []models.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		e.Alerts = append(e.Alerts, a)
+	}
+
+	actionRows, err := db.DB.Query(`SELECT `+correctiveActionColumns+` FROM corrective_actions ca WHERE ca.excursion_id = ? ORDER BY ca.performed_at ASC`, e.ID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer actionRows.Close()
+
+	e.CorrectiveActions = []models.CorrectiveAction{}
+	for actionRows.Next() {
+		a, err := scanCorrectiveAction(actionRows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		e.CorrectiveActions = append(e.CorrectiveActions, a)
+	}
+
+	response.JSON(w, http.StatusOK, e)
+}
@@ -0,0 +1,603 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/xuri/excelize/v2"
+)
+
+// Valores por defecto de la exportación (configurables por entorno y por query)
+const (
+	defaultExportLocale = "es-EC"
+	exportFlushEvery    = 500    // filas entre cada flush del CSV hacia el cliente
+	exportXLSXMaxRows   = 100000 // el XLSX se arma completo antes de enviarse, así que se limita
+)
+
+// exportBuckets son las agregaciones aceptadas en ?bucket= (en segundos)
+var exportBuckets = map[string]int{"15m": 15 * 60, "1h": 60 * 60, "1d": 24 * 60 * 60}
+
+// exportColumn is a column header in both supported languages
+type exportColumn struct {
+	es string
+	en string
+}
+
+var chamberExportColumns = []exportColumn{
+	{"Cámara", "Chamber"},
+	{"Nombre", "Name"},
+	{"Contenido", "Content"},
+	{"Local", "Location"},
+	{"Temp. objetivo (°C)", "Target temp. (°C)"},
+	{"Umbral advertencia (°C)", "Warning threshold (°C)"},
+	{"Umbral crítico (°C)", "Critical threshold (°C)"},
+}
+
+var readingExportColumns = append(append([]exportColumn{}, chamberExportColumns...),
+	exportColumn{"Fecha y hora", "Timestamp"},
+	exportColumn{"Temperatura (°C)", "Temperature (°C)"},
+	exportColumn{"Temperatura cruda (°C)", "Raw temperature (°C)"},
+	exportColumn{"Estado", "Status"},
+	exportColumn{"Calidad", "Quality"},
+)
+
+var bucketExportColumns = append(append([]exportColumn{}, chamberExportColumns...),
+	exportColumn{"Inicio del intervalo", "Bucket start"},
+	exportColumn{"Mínima (°C)", "Min (°C)"},
+	exportColumn{"Promedio (°C)", "Avg (°C)"},
+	exportColumn{"Máxima (°C)", "Max (°C)"},
+	exportColumn{"Lecturas", "Readings"},
+)
+
+var alertExportColumns = append(append([]exportColumn{}, chamberExportColumns...),
+	exportColumn{"Fecha y hora", "Timestamp"},
+	exportColumn{"Alerta", "Alert"},
+	exportColumn{"Título", "Title"},
+	exportColumn{"Descripción", "Description"},
+	exportColumn{"Prioridad", "Priority"},
+	exportColumn{"Tipo", "Type"},
+	exportColumn{"Leída", "Read"},
+	exportColumn{"Costo estimado", "Estimated cost"},
+	exportColumn{"Contenido afectado", "Affected content"},
+	exportColumn{"Acción sugerida", "Suggested action"},
+	exportColumn{"Revisión de configuración", "Config revision"},
+)
+
+// exportOptions are the presentation settings of an export
+type exportOptions struct {
+	format       string // csv, xlsx
+	location     *time.Location
+	spanish      bool
+	decimalComma bool
+}
+
+// queryTimezone reads ?tz= (IANA name), defaulting to the report timezone (EXPORT_TIMEZONE)
+func queryTimezone(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return service.ReportTimezone(), nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, response.BadRequest("Unknown timezone '" + tz + "'")
+	}
+	return loc, nil
+}
+
+// exportOptionsFrom reads ?format=, ?tz= and ?locale= (defaults: csv, EXPORT_TIMEZONE, EXPORT_LOCALE)
+func exportOptionsFrom(r *http.Request) (exportOptions, error) {
+	q := r.URL.Query()
+	opts := exportOptions{format: strings.ToLower(q.Get("format"))}
+
+	switch opts.format {
+	case "":
+		opts.format = "csv"
+	case "csv", "xlsx":
+	default:
+		return opts, response.BadRequest("'format' must be csv or xlsx")
+	}
+
+	loc, err := queryTimezone(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.location = loc
+
+	locale := q.Get("locale")
+	if locale == "" {
+		locale = os.Getenv("EXPORT_LOCALE")
+	}
+	if locale == "" {
+		locale = defaultExportLocale
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	switch lang {
+	case "es":
+		// Ecuador y el resto de Hispanoamérica usan coma decimal
+		opts.spanish, opts.decimalComma = true, true
+	case "en":
+	default:
+		return opts, response.BadRequest("Unsupported locale '" + locale + "'")
+	}
+
+	return opts, nil
+}
+
+func (o exportOptions) headers(cols []exportColumn) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.en
+		if o.spanish {
+			names[i] = c.es
+		}
+	}
+	return names
+}
+
+// text formats a value for CSV cells
+func (o exportOptions) text(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		s := strconv.FormatFloat(val, 'f', 2, 64)
+		if o.decimalComma {
+			s = strings.Replace(s, ".", ",", 1)
+		}
+		return s
+	case time.Time:
+		return val.In(o.location).Format("2006-01-02 15:04:05")
+	case bool:
+		return o.yesNo(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// cell converts a value for XLSX cells, keeping numbers numeric so the
+// spreadsheet applies its own locale
+func (o exportOptions) cell(v interface{}) interface{} {
+	switch val := v.(type) {
+	case time.Time:
+		return val.In(o.location).Format("2006-01-02 15:04:05")
+	case bool:
+		return o.yesNo(val)
+	default:
+		return val
+	}
+}
+
+func (o exportOptions) yesNo(b bool) string {
+	switch {
+	case b && o.spanish:
+		return "Sí"
+	case b:
+		return "Yes"
+	default:
+		return "No"
+	}
+}
+
+// rowWriter writes an export one row at a time
+type rowWriter interface {
+	write(values []interface{}) error
+	close() error
+}
+
+type csvRowWriter struct {
+	w    *csv.Writer
+	opts exportOptions
+	out  http.ResponseWriter
+	rows int
+}
+
+func (c *csvRowWriter) write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = c.opts.text(v)
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+
+	c.rows++
+	if c.rows%exportFlushEvery == 0 {
+		c.w.Flush()
+		if f, ok := c.out.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type xlsxRowWriter struct {
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	opts   exportOptions
+	out    http.ResponseWriter
+	row    int
+}
+
+func (x *xlsxRowWriter) write(values []interface{}) error {
+	// La primera fila es el encabezado
+	if x.row > exportXLSXMaxRows {
+		return response.BadRequest(fmt.Sprintf("XLSX exports are limited to %d rows; narrow the range, use a bucket or format=csv", exportXLSXMaxRows))
+	}
+
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = x.opts.cell(v)
+	}
+
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.stream.SetRow(cell, cells)
+}
+
+func (x *xlsxRowWriter) close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.out)
+}
+
+// newRowWriter sets the download headers and writes the header row
+func newRowWriter(w http.ResponseWriter, opts exportOptions, name string, cols []exportColumn) (rowWriter, error) {
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().In(opts.location).Format("20060102_150405"), opts.format)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	header := make([]interface{}, len(cols))
+	for i, h := range opts.headers(cols) {
+		header[i] = h
+	}
+
+	var rw rowWriter
+	if opts.format == "xlsx" {
+		// excelize acumula las filas (en un archivo temporal si crecen) y arma el libro al cerrar:
+		// nada llega al cliente hasta entonces
+		f := excelize.NewFile()
+		sheet := "Datos"
+		if !opts.spanish {
+			sheet = "Data"
+		}
+		f.SetSheetName("Sheet1", sheet)
+		stream, err := f.NewStreamWriter(sheet)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		rw = &xlsxRowWriter{file: f, stream: stream, opts: opts, out: w}
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		if opts.decimalComma {
+			cw.Comma = ';' // con coma decimal, el separador habitual es el punto y coma
+		}
+		w.Write([]byte("\uFEFF")) // BOM para que Excel detecte UTF-8
+		rw = &csvRowWriter{w: cw, opts: opts, out: w}
+	}
+
+	return rw, rw.write(header)
+}
+
+// finishExport closes an export after its rows. A CSV response has already started, so its
+// errors are only logged; an XLSX one has sent nothing yet and still answers with the error
+// (e.g. the row limit).
+func finishExport(w http.ResponseWriter, rw rowWriter, err error, what string) {
+	if x, ok := rw.(*xlsxRowWriter); ok && err != nil {
+		x.file.Close()
+		w.Header().Del("Content-Disposition")
+		response.Fail(w, err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error exportando %s: %v\n", what, err)
+	}
+	if err := rw.close(); err != nil {
+		fmt.Printf("Error cerrando exportación de %s: %v\n", what, err)
+	}
+}
+
+// exportRange reads the required ?start= and ?end= of an export
+func exportRange(r *http.Request) (time.Time, time.Time, error) {
+	start, err := queryTime(r, "start")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := queryTime(r, "end")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if start == nil || end == nil {
+		return time.Time{}, time.Time{}, response.BadRequest("Missing 'start' or 'end' query parameters")
+	}
+	if end.Before(*start) {
+		return time.Time{}, time.Time{}, response.BadRequest("'end' must not be before 'start'")
+	}
+	return *start, *end, nil
+}
+
+// exportConditions builds the range, chamber and location filters shared by the exports
+func exportConditions(r *http.Request, timeColumn, sensorColumn string) ([]string, []interface{}, error) {
+	scope, err := requestScope(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	start, end, err := exportRange(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{timeColumn + " BETWEEN ? AND ?"}
+	args := []interface{}{start, end}
+
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	if chamberID := r.URL.Query().Get("chamber_id"); chamberID != "" {
+		conditions = append(conditions, sensorColumn+" = ?")
+		args = append(args, chamberID)
+	}
+	return conditions, args, nil
+}
+
+// chamberExportSelect are the chamber metadata columns (alias c) that open every export row
+const chamberExportSelect = `c.id, c.name, COALESCE(c.content, ''), COALESCE(l.name, ''), c.target_temperature, c.warning_threshold, c.critical_threshold`
+
+// streamRows writes every row of the query through rw, scanning into dest
+func streamRows(rw rowWriter, rows *sql.Rows, dest []interface{}, values func() []interface{}) error {
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := rw.write(values()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// bucketStart returns the start of the bucket of the given seconds that contains t, aligned to
+// local midnight in loc: 1d buckets are local days, like the HACCP daily summary
+func bucketStart(t time.Time, loc *time.Location, seconds int) time.Time {
+	local := t.In(loc)
+	elapsed := local.Hour()*3600 + local.Minute()*60 + local.Second()
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, elapsed/seconds*seconds, 0, loc)
+}
+
+// readingBucket accumulates the valid readings of one chamber in one bucket
+type readingBucket struct {
+	chamber  []interface{}
+	start    time.Time
+	min, max float64
+	sum      float64
+	count    int
+}
+
+func (b *readingBucket) values() []interface{} {
+	return append(b.chamber, b.start, b.min, b.sum/float64(b.count), b.max, b.count)
+}
+
+// streamBuckets aggregates rows ordered by chamber and timestamp into one row per chamber and
+// bucket. values must return the chamber columns followed by the timestamp and the temperature.
+func streamBuckets(rw rowWriter, rows *sql.Rows, dest []interface{}, values func() []interface{}, loc *time.Location, seconds int) error {
+	var current *readingBucket
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		row := values()
+		chamber, ts, temp := row[:len(row)-2], row[len(row)-2].(time.Time), row[len(row)-1].(float64)
+		start := bucketStart(ts, loc, seconds)
+
+		if current != nil && current.chamber[0] == chamber[0] && current.start.Equal(start) {
+			current.min = min(current.min, temp)
+			current.max = max(current.max, temp)
+			current.sum += temp
+			current.count++
+			continue
+		}
+		if current != nil {
+			if err := rw.write(current.values()); err != nil {
+				return err
+			}
+		}
+		current = &readingBucket{chamber: chamber, start: start, min: temp, max: temp, sum: temp, count: 1}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		return rw.write(current.values())
+	}
+	return nil
+}
+
+// ExportReadings downloads temperature readings, raw or aggregated per bucket
+// Query Params: start, end (ISO8601, required), format (csv|xlsx), bucket (raw|15m|1h|1d),
+// chamber_id, location_id, tz (IANA, default EXPORT_TIMEZONE), locale (es-EC|en, default EXPORT_LOCALE)
+func ExportReadings(w http.ResponseWriter, r *http.Request) {
+	opts, err := exportOptionsFrom(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	conditions, args, err := exportConditions(r, "tr.timestamp", "tr.sensor_id")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	seconds, bucketed := exportBuckets[bucket]
+	if bucket != "" && bucket != "raw" && !bucketed {
+		response.Fail(w, response.BadRequest("'bucket' must be raw, 15m, 1h or 1d"))
+		return
+	}
+
+	from := `
+		FROM temperature_readings tr
+		JOIN chambers c ON c.id = tr.sensor_id
+		LEFT JOIN locations l ON l.id = c.location_id
+		WHERE ` + strings.Join(conditions, " AND ")
+
+	var c struct {
+		id, name, content, location string
+		target, warning, critical   float64
+	}
+	chamber := []interface{}{&c.id, &c.name, &c.content, &c.location, &c.target, &c.warning, &c.critical}
+	chamberValues := func() []interface{} {
+		return []interface{}{c.id, c.name, c.content, c.location, c.target, c.warning, c.critical}
+	}
+
+	var query string
+	var cols []exportColumn
+	var dest []interface{}
+	var values func() []interface{}
+
+	if bucketed {
+		// Los agregados solo usan lecturas válidas. Se agrupan aquí y no en SQL para alinear
+		// los intervalos con la hora local de ?tz= (la base solo conoce la época Unix)
+		query = `
+			SELECT ` + chamberExportSelect + `, tr.timestamp, tr.temperature` + from + ` AND tr.quality = 'OK'
+			ORDER BY c.id, tr.timestamp`
+
+		var ts time.Time
+		var temp float64
+		cols = bucketExportColumns
+		dest = append(chamber, &ts, &temp)
+		values = func() []interface{} {
+			return append(chamberValues(), ts, temp)
+		}
+	} else {
+		query = `
+			SELECT ` + chamberExportSelect + `, tr.timestamp, tr.temperature, tr.raw_temperature, tr.status, tr.quality` + from + `
+			ORDER BY c.id, tr.timestamp`
+
+		var ts time.Time
+		var temp float64
+		var raw sql.NullFloat64
+		var status, quality string
+		cols = readingExportColumns
+		dest = append(chamber, &ts, &temp, &raw, &status, &quality)
+		values = func() []interface{} {
+			var rawVal interface{}
+			if raw.Valid {
+				rawVal = raw.Float64
+			}
+			return append(chamberValues(), ts, temp, rawVal, status, quality)
+		}
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	name := "lecturas"
+	if !opts.spanish {
+		name = "readings"
+	}
+	rw, err := newRowWriter(w, opts, name, cols)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if bucketed {
+		err = streamBuckets(rw, rows, dest, values, opts.location, seconds)
+	} else {
+		err = streamRows(rw, rows, dest, values)
+	}
+	finishExport(w, rw, err, "lecturas")
+}
+
+// ExportAlerts downloads the alerts of a period
+// Query Params: start, end (ISO8601, required), format (csv|xlsx), chamber_id, location_id, tz, locale
+func ExportAlerts(w http.ResponseWriter, r *http.Request) {
+	opts, err := exportOptionsFrom(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	conditions, args, err := exportConditions(r, "a.timestamp", "a.sensor_id")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `
+		SELECT ` + chamberExportSelect + `, a.timestamp, a.id, a.title, COALESCE(a.description, ''), a.priority, a.type, a.is_read, a.estimated_cost, COALESCE(a.affected_content, ''), COALESCE(a.suggested_action, ''), a.config_revision
+		FROM alerts a
+		JOIN chambers c ON c.id = a.sensor_id
+		LEFT JOIN locations l ON l.id = c.location_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY a.timestamp, a.id`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var c struct {
+		id, name, content, location string
+		target, warning, critical   float64
+	}
+	var ts time.Time
+	var alertID, title, description string
+	var priority, alertType int
+	var isRead bool
+	var estCost sql.NullFloat64
+	var affectedContent, suggestedAction string
+	var configRevision sql.NullInt64
+
+	dest := []interface{}{&c.id, &c.name, &c.content, &c.location, &c.target, &c.warning, &c.critical,
+		&ts, &alertID, &title, &description, &priority, &alertType, &isRead, &estCost, &affectedContent, &suggestedAction, &configRevision}
+	values := func() []interface{} {
+		var cost, revision interface{}
+		if estCost.Valid {
+			cost = estCost.Float64
+		}
+		if configRevision.Valid {
+			revision = configRevision.Int64
+		}
+		return []interface{}{c.id, c.name, c.content, c.location, c.target, c.warning, c.critical,
+			ts, alertID, title, description, priority, alertType, isRead, cost, affectedContent, suggestedAction, revision}
+	}
+
+	name := "alertas"
+	if !opts.spanish {
+		name = "alerts"
+	}
+	rw, err := newRowWriter(w, opts, name, alertExportColumns)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	finishExport(w, rw, streamRows(rw, rows, dest, values), "alertas")
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatalf("LoadLocation(%q): %v", name, err)
+		}
+		return loc
+	}
+	guayaquil := load("America/Guayaquil") // UTC-5
+	kolkata := load("Asia/Kolkata")        // UTC+5:30
+	newYork := load("America/New_York")    // cambia de hora el 10 de marzo de 2024
+
+	utc := func(value string) time.Time {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name    string
+		at      string
+		loc     *time.Location
+		seconds int
+		want    string
+	}{
+		// 03:00 UTC del 12 son las 22:00 del 11 en Guayaquil: pertenece al día local 11
+		{"local day before UTC midnight", "2024-12-12T03:00:00Z", guayaquil, exportBuckets["1d"], "2024-12-11T05:00:00Z"},
+		{"local day after local midnight", "2024-12-12T05:00:00Z", guayaquil, exportBuckets["1d"], "2024-12-12T05:00:00Z"},
+		{"hour", "2024-12-12T03:59:59Z", guayaquil, exportBuckets["1h"], "2024-12-12T03:00:00Z"},
+		{"15 minutes", "2024-12-12T03:44:00Z", guayaquil, exportBuckets["15m"], "2024-12-12T03:30:00Z"},
+		// Con un desfase de media hora las horas locales no coinciden con las horas UTC
+		{"half-hour offset hour", "2024-12-12T10:15:00Z", kolkata, exportBuckets["1h"], "2024-12-12T09:30:00Z"},
+		{"half-hour offset day", "2024-12-12T20:00:00Z", kolkata, exportBuckets["1d"], "2024-12-12T18:30:00Z"},
+		{"UTC", "2024-12-12T03:00:00Z", time.UTC, exportBuckets["1d"], "2024-12-12T00:00:00Z"},
+		// El día del cambio de hora dura 23 h y empieza a la medianoche local (UTC-5)
+		{"daylight saving day", "2024-03-10T22:00:00Z", newYork, exportBuckets["1d"], "2024-03-10T05:00:00Z"},
+		{"after daylight saving", "2024-03-10T15:10:00Z", newYork, exportBuckets["1h"], "2024-03-10T15:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bucketStart(utc(tt.at), tt.loc, tt.seconds)
+			if want := utc(tt.want); !got.Equal(want) {
+				t.Errorf("bucketStart(%s) = %s, want %s", tt.at, got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
@@ -2,20 +2,34 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/angello/rukito-backend/internal/db"
 	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
 	"github.com/gorilla/mux"
 )
 
-// GetChambers returns all cold chambers from the database
+// GetChambers returns the cold chambers of the user's locations
+// Query Params: location_id
 func GetChambers(w http.ResponseWriter, r *http.Request) {
-	query := `SELECT id, name, content, target_temperature, critical_threshold, warning_threshold, location, is_active, updated_at FROM chambers`
-	rows, err := db.DB.Query(query)
+	scope, err := requestScope(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
+		return
+	}
+
+	query := `SELECT id, name, content, target_temperature, critical_threshold, warning_threshold, location, COALESCE(location_id, ''), COALESCE(product_category, ''), forecast_lead_minutes, is_active, updated_at FROM chambers`
+	where, args := scope.clause("location_id")
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
 		return
 	}
 	defer rows.Close()
@@ -23,11 +37,13 @@ func GetChambers(w http.ResponseWriter, r *http.Request) {
 	var chambers []models.ColdChamber
 	for rows.Next() {
 		var c models.ColdChamber
-		err := rows.Scan(&c.ID, &c.Name, &c.Content, &c.TargetTemperature, &c.CriticalThreshold, &c.WarningThreshold, &c.Location, &c.IsActive, &c.LastUpdate)
+		var lead sql.NullInt64
+		err := rows.Scan(&c.ID, &c.Name, &c.Content, &c.TargetTemperature, &c.CriticalThreshold, &c.WarningThreshold, &c.Location, &c.LocationID, &c.ProductCategory, &lead, &c.IsActive, &c.LastUpdate)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Fail(w, err)
 			return
 		}
+		c.ForecastLeadMinutes = nullableInt(lead)
 
 		// En un sistema real, aquí buscaríamos la temperatura actual y lecturas recientes
 		// Por ahora simularemos datos básicos o dejaremos valores por defecto
@@ -38,8 +54,54 @@ func GetChambers(w http.ResponseWriter, r *http.Request) {
 		chambers = append(chambers, c)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(chambers)
+	response.JSON(w, http.StatusOK, chambers)
+}
+
+// chamberUpdateRequest is the body of PUT /chambers/{id}; omitted fields keep their value
+type chamberUpdateRequest struct {
+	Name              *string  `json:"name"`
+	Content           *string  `json:"content"`
+	TargetTemperature *float64 `json:"target_temperature"`
+	CriticalThreshold *float64 `json:"critical_threshold"`
+	WarningThreshold  *float64 `json:"warning_threshold"`
+	Location          *string  `json:"location"`
+	ProductCategory   *string  `json:"product_category"`
+	IsActive          *bool    `json:"is_active"`
+	// Minutes of warning before a predicted threshold crossing; 0 restores the default
+	ForecastLeadMinutes *int `json:"forecast_lead_minutes"`
+}
+
+// chamberCreateRequest is the body of POST /chambers
+type chamberCreateRequest struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	Content           string   `json:"content"`
+	TargetTemperature *float64 `json:"target_temperature"`
+	CriticalThreshold *float64 `json:"critical_threshold"`
+	WarningThreshold  *float64 `json:"warning_threshold"`
+	Location          string   `json:"location"`
+	LocationID        string   `json:"location_id"`
+	ProductCategory   string   `json:"product_category"`
+}
+
+// loadChamber reads a chamber by ID (sql.ErrNoRows if missing)
+func loadChamber(id string) (models.ColdChamber, error) {
+	query := `SELECT id, name, content, target_temperature, critical_threshold, warning_threshold, location, COALESCE(location_id, ''), COALESCE(product_category, ''), forecast_lead_minutes, is_active, updated_at FROM chambers WHERE id = ?`
+	row := db.DB.QueryRow(query, id)
+
+	var c models.ColdChamber
+	var lead sql.NullInt64
+	err := row.Scan(&c.ID, &c.Name, &c.Content, &c.TargetTemperature, &c.CriticalThreshold, &c.WarningThreshold, &c.Location, &c.LocationID, &c.ProductCategory, &lead, &c.IsActive, &c.LastUpdate)
+	c.ForecastLeadMinutes = nullableInt(lead)
+	return c, err
+}
+
+func nullableInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	val := int(v.Int64)
+	return &val
 }
 
 // GetChamber returns a specific chamber by ID
@@ -47,17 +109,16 @@ func GetChamber(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	query := `SELECT id, name, content, target_temperature, critical_threshold, warning_threshold, location, is_active, updated_at FROM chambers WHERE id = ?`
-	row := db.DB.QueryRow(query, id)
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
 
-	var c models.ColdChamber
-	err := row.Scan(&c.ID, &c.Name, &c.Content, &c.TargetTemperature, &c.CriticalThreshold, &c.WarningThreshold, &c.Location, &c.IsActive, &c.LastUpdate)
-	
+	c, err := loadChamber(id)
 	if err == sql.ErrNoRows {
-		http.Error(w, "Chamber not found", http.StatusNotFound)
+		response.Fail(w, response.NotFound("Chamber not found"))
 		return
 	} else if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
 		return
 	}
 
@@ -66,14 +127,221 @@ func GetChamber(w http.ResponseWriter, r *http.Request) {
 	c.Status = 0
 	c.RecentTemps = []float64{c.TargetTemperature, c.TargetTemperature}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(c)
+	forecast, err := service.ForecastChamber(id)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	c.Forecast = &forecast
+
+	response.JSON(w, http.StatusOK, c)
+}
+
+// GetChamberAnomaly returns the chamber's learned hour-of-day baseline and the anomaly score
+// of its recent readings
+func GetChamberAnomaly(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
+
+	score, err := service.ChamberAnomaly(id)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, score)
+}
+
+// GetChamberEquipment returns the compressor activity inferred for each day and its duty-cycle trend
+// Query Params: days (closed days, default 14, max 90)
+func GetChamberEquipment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
+
+	days := 14
+	if n, err := queryInt(r, "days"); err != nil {
+		response.Fail(w, err)
+		return
+	} else if n != nil {
+		if *n < 1 || *n > 90 {
+			response.Fail(w, response.BadRequest("'days' must be between 1 and 90"))
+			return
+		}
+		days = *n
+	}
+
+	health, err := service.EquipmentHealth(id, days)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, health)
+}
+
+// UpdateChamber edits the descriptive data and thresholds of a chamber
+func UpdateChamber(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
+
+	var req chamberUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	before, err := loadChamber(id)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	c := before
+	if req.Name != nil {
+		c.Name = *req.Name
+	}
+	if req.Content != nil {
+		c.Content = *req.Content
+	}
+	if req.TargetTemperature != nil {
+		c.TargetTemperature = *req.TargetTemperature
+	}
+	if req.CriticalThreshold != nil {
+		c.CriticalThreshold = *req.CriticalThreshold
+	}
+	if req.WarningThreshold != nil {
+		c.WarningThreshold = *req.WarningThreshold
+	}
+	if req.Location != nil {
+		c.Location = *req.Location
+	}
+	if req.ProductCategory != nil {
+		if *req.ProductCategory != "" && !service.ValidProductCategory(*req.ProductCategory) {
+			response.Fail(w, response.BadRequest("Unknown 'product_category'"))
+			return
+		}
+		c.ProductCategory = *req.ProductCategory
+	}
+	if req.IsActive != nil {
+		c.IsActive = *req.IsActive
+	}
+	if req.ForecastLeadMinutes != nil {
+		if *req.ForecastLeadMinutes < 0 || *req.ForecastLeadMinutes > 24*60 {
+			response.Fail(w, response.BadRequest("'forecast_lead_minutes' must be between 0 and 1440"))
+			return
+		}
+		c.ForecastLeadMinutes = req.ForecastLeadMinutes
+		if *req.ForecastLeadMinutes == 0 {
+			c.ForecastLeadMinutes = nil
+		}
+	}
+
+	query := `
+		UPDATE chambers 
+		SET name=?, content=?, target_temperature=?, critical_threshold=?, warning_threshold=?, location=?, product_category=NULLIF(?, ''), forecast_lead_minutes=?, is_active=? 
+		WHERE id=?`
+
+	_, err = db.DB.Exec(query, c.Name, c.Content, c.TargetTemperature, c.CriticalThreshold, c.WarningThreshold, c.Location, c.ProductCategory, c.ForecastLeadMinutes, c.IsActive, id)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	// Los campos dinámicos no forman parte de la auditoría
+	recordAudit(r, service.AuditChamberUpdate, "chamber", id, chamberLocation(id), before, c)
+
+	response.JSON(w, http.StatusOK, c)
+}
+
+// CreateChamber registers a chamber in one of the user's locations and
+// generates its default alert configuration from the product category template
+func CreateChamber(w http.ResponseWriter, r *http.Request) {
+	var req chamberCreateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if req.ID == "" || req.Name == "" || req.LocationID == "" || req.TargetTemperature == nil || req.CriticalThreshold == nil || req.WarningThreshold == nil {
+		response.Fail(w, response.BadRequest("Missing 'id', 'name', 'location_id', 'target_temperature', 'critical_threshold' or 'warning_threshold'"))
+		return
+	}
+	if req.ProductCategory != "" && !service.ValidProductCategory(req.ProductCategory) {
+		response.Fail(w, response.BadRequest("Unknown 'product_category'"))
+		return
+	}
+
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if !scope.contains(req.LocationID) {
+		response.Fail(w, response.Forbidden("Location not assigned to user"))
+		return
+	}
+
+	c := models.ColdChamber{
+		ID:                req.ID,
+		Name:              req.Name,
+		Content:           req.Content,
+		TargetTemperature: *req.TargetTemperature,
+		CriticalThreshold: *req.CriticalThreshold,
+		WarningThreshold:  *req.WarningThreshold,
+		Location:          req.Location,
+		LocationID:        req.LocationID,
+		ProductCategory:   req.ProductCategory,
+		IsActive:          true,
+		LastUpdate:        time.Now(),
+	}
+
+	query := `
+		INSERT INTO chambers (id, name, content, target_temperature, critical_threshold, warning_threshold, location, location_id, product_category)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`
+
+	_, err = db.DB.Exec(query, c.ID, c.Name, c.Content, c.TargetTemperature, c.CriticalThreshold, c.WarningThreshold, c.Location, c.LocationID, c.ProductCategory)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, "Chamber "+c.ID+" already exists"))
+		return
+	}
+
+	recordAudit(r, service.AuditChamberCreate, "chamber", c.ID, &c.LocationID, nil, c)
+
+	if _, _, err := ensureAlertConfig(c, requestUserID(r)); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	c.CurrentTemperature = c.TargetTemperature
+	c.RecentTemps = []float64{}
+
+	response.JSON(w, http.StatusCreated, c)
 }
 
 // GetHealth simple health check endpoint
 func GetHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	response.JSON(w, http.StatusOK, map[string]string{
 		"status":    "ok",
 		"timestamp": "2024-12-11T22:30:00Z", // Placeholder
 	})
@@ -0,0 +1,627 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// productRequest is the body of POST /products and PUT /products/{id}.
+// On PUT only the fields present are changed.
+type productRequest struct {
+	Name       *string              `json:"name"`
+	Category   *string              `json:"category"`
+	PricePerKg *float64             `json:"price_per_kg"`
+	Rules      *productRulesRequest `json:"rules"`
+}
+
+// productRulesRequest sets the product's own spoilage rules; omitted fields keep
+// their current value (the category default if never set)
+type productRulesRequest struct {
+	SafeMin            *float64 `json:"safe_min_temperature"`
+	SafeMax            *float64 `json:"safe_max_temperature"`
+	MaxExposureMinutes *float64 `json:"max_exposure_minutes"`
+	DegradationRate    *float64 `json:"degradation_rate"`
+}
+
+// ruleOverrides are a product's own rules as stored (NULL = category default)
+type ruleOverrides struct {
+	safeMin, safeMax, maxExposure, degradationRate sql.NullFloat64
+}
+
+// apply copies the rules present in the request
+func (o *ruleOverrides) apply(req *productRulesRequest) {
+	if req == nil {
+		return
+	}
+	for _, f := range []struct {
+		dst *sql.NullFloat64
+		src *float64
+	}{
+		{&o.safeMin, req.SafeMin}, {&o.safeMax, req.SafeMax}, {&o.maxExposure, req.MaxExposureMinutes}, {&o.degradationRate, req.DegradationRate},
+	} {
+		if f.src != nil {
+			*f.dst = sql.NullFloat64{Float64: *f.src, Valid: true}
+		}
+	}
+}
+
+// productCategoryRequest is the body of PUT /product-categories/{category}
+type productCategoryRequest struct {
+	ActivationEnergy *float64 `json:"activation_energy"` // kJ/mol
+}
+
+// stockMovementRequest is the body of POST /chambers/{id}/stock/in and /stock/out
+type stockMovementRequest struct {
+	ProductID  string     `json:"product_id"`
+	QuantityKg float64    `json:"quantity_kg"`
+	LotID      *string    `json:"lot_id"` // stock/out only; lots are received with POST /chambers/{id}/lots
+	MovedAt    *time.Time `json:"moved_at"`
+	Notes      *string    `json:"notes"`
+}
+
+const productColumns = `id, name, category, price_per_kg, safe_min_temperature, safe_max_temperature, max_exposure_minutes, degradation_rate, created_at, updated_at`
+
+// scanProduct returns the product with its effective rules, and its own rules as stored
+func scanProduct(row interface{ Scan(...interface{}) error }) (models.Product, ruleOverrides, error) {
+	var p models.Product
+	var o ruleOverrides
+	err := row.Scan(&p.ID, &p.Name, &p.Category, &p.PricePerKg, &o.safeMin, &o.safeMax, &o.maxExposure, &o.degradationRate, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, o, err
+	}
+	p.Rules = service.ProductRulesFor(p.Category, o.safeMin, o.safeMax, o.maxExposure, o.degradationRate)
+	return p, o, nil
+}
+
+// stockMovementColumns are the columns read by scanStockMovement (stock_movements aliased as m, products as p)
+const stockMovementColumns = `m.id, m.sensor_id, m.product_id, p.name, m.lot_id, m.type, m.quantity_kg, m.moved_at, m.notes, m.recorded_by, m.created_at`
+
+func scanStockMovement(row interface{ Scan(...interface{}) error }) (models.StockMovement, error) {
+	var m models.StockMovement
+	var lotID, notes, recordedBy sql.NullString
+
+	err := row.Scan(&m.ID, &m.SensorID, &m.ProductID, &m.ProductName, &lotID, &m.Type, &m.QuantityKg, &m.MovedAt, &notes, &recordedBy, &m.CreatedAt)
+	if err != nil {
+		return m, err
+	}
+
+	if lotID.Valid {
+		val := lotID.String
+		m.LotID = &val
+	}
+	if notes.Valid {
+		val := notes.String
+		m.Notes = &val
+	}
+	if recordedBy.Valid {
+		val := recordedBy.String
+		m.RecordedBy = &val
+	}
+	return m, nil
+}
+
+// validate checks the fields present in the request; create requires all of them
+func (req productRequest) validate(create bool) []response.FieldError {
+	var fields []response.FieldError
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" || create && req.Name == nil {
+		fields = append(fields, invalid("name", "is required"))
+	}
+	if req.Category != nil && !service.ValidProductCategory(*req.Category) || create && req.Category == nil {
+		fields = append(fields, invalid("category", "must be frozen_meat, dairy, vegetables or general"))
+	}
+	if req.PricePerKg != nil && *req.PricePerKg <= 0 || create && req.PricePerKg == nil {
+		fields = append(fields, invalid("price_per_kg", "must be greater than 0"))
+	}
+	if req.Rules != nil {
+		if req.Rules.MaxExposureMinutes != nil && *req.Rules.MaxExposureMinutes <= 0 {
+			fields = append(fields, invalid("rules.max_exposure_minutes", "must be greater than 0"))
+		}
+		if req.Rules.DegradationRate != nil && *req.Rules.DegradationRate < 0 {
+			fields = append(fields, invalid("rules.degradation_rate", "must not be negative"))
+		}
+	}
+	return fields
+}
+
+// validateRules checks the effective rules once merged with the category defaults
+func validateRules(rules models.ProductRules) []response.FieldError {
+	if rules.SafeMin != nil && *rules.SafeMin >= rules.SafeMax {
+		return []response.FieldError{invalid("rules.safe_max_temperature", "must be greater than safe_min_temperature")}
+	}
+	return nil
+}
+
+// GetProducts returns the product catalog
+// Query Params: category
+func GetProducts(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + productColumns + ` FROM products`
+	var args []interface{}
+	if category := r.URL.Query().Get("category"); category != "" {
+		query += ` WHERE category = ?`
+		args = append(args, category)
+	}
+	query += ` ORDER BY name`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		p, _, err := scanProduct(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		products = append(products, p)
+	}
+
+	response.JSON(w, http.StatusOK, products)
+}
+
+// CreateProduct adds a product to the catalog
+func CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var req productRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if fields := req.validate(true); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	var o ruleOverrides
+	o.apply(req.Rules)
+
+	p := models.Product{
+		ID:         "PRD-" + uuid.New().String()[:8],
+		Name:       strings.TrimSpace(*req.Name),
+		Category:   *req.Category,
+		PricePerKg: *req.PricePerKg,
+		Rules:      service.ProductRulesFor(*req.Category, o.safeMin, o.safeMax, o.maxExposure, o.degradationRate),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if fields := validateRules(p.Rules); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	query := `
+		INSERT INTO products (id, name, category, price_per_kg, safe_min_temperature, safe_max_temperature, max_exposure_minutes, degradation_rate)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.DB.Exec(query, p.ID, p.Name, p.Category, p.PricePerKg, o.safeMin, o.safeMax, o.maxExposure, o.degradationRate)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, "Product already exists"))
+		return
+	}
+
+	recordAudit(r, service.AuditProductCreate, "product", p.ID, nil, nil, p)
+
+	response.JSON(w, http.StatusCreated, p)
+}
+
+// UpdateProduct changes a product's name, category, price or spoilage rules. The new
+// price values the stock from now on; alerts already raised keep their cost.
+func UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req productRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if fields := req.validate(false); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	before, o, err := scanProduct(db.DB.QueryRow(`SELECT `+productColumns+` FROM products WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Product not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	p := before
+	if req.Name != nil {
+		p.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Category != nil {
+		p.Category = *req.Category
+	}
+	if req.PricePerKg != nil {
+		p.PricePerKg = *req.PricePerKg
+	}
+	o.apply(req.Rules)
+	p.Rules = service.ProductRulesFor(p.Category, o.safeMin, o.safeMax, o.maxExposure, o.degradationRate)
+	if fields := validateRules(p.Rules); len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+	p.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE products
+		SET name = ?, category = ?, price_per_kg = ?, safe_min_temperature = ?, safe_max_temperature = ?, max_exposure_minutes = ?, degradation_rate = ?
+		WHERE id = ?`
+
+	_, err = db.DB.Exec(query, p.Name, p.Category, p.PricePerKg, o.safeMin, o.safeMax, o.maxExposure, o.degradationRate, id)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, "Product already exists"))
+		return
+	}
+
+	recordAudit(r, service.AuditProductUpdate, "product", id, nil, before, p)
+
+	response.JSON(w, http.StatusOK, p)
+}
+
+// GetProductCategories returns the product categories with their activation energy
+func GetProductCategories(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.Query(`SELECT category, activation_energy, updated_at FROM product_categories ORDER BY category`)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.ProductCategory{}
+	for rows.Next() {
+		var c models.ProductCategory
+		if err := rows.Scan(&c.Category, &c.ActivationEnergy, &c.UpdatedAt); err != nil {
+			response.Fail(w, err)
+			return
+		}
+		categories = append(categories, c)
+	}
+
+	response.JSON(w, http.StatusOK, categories)
+}
+
+// UpdateProductCategory sets the activation energy used for the Mean Kinetic Temperature
+// of a category. Excursions already recorded keep the energy they were computed with.
+func UpdateProductCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	category := vars["category"]
+
+	var req productCategoryRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if req.ActivationEnergy == nil || *req.ActivationEnergy <= 0 || *req.ActivationEnergy > 1000 {
+		response.Fail(w, response.Validation([]response.FieldError{invalid("activation_energy", "must be between 0 and 1000 kJ/mol")}))
+		return
+	}
+
+	var before models.ProductCategory
+	err := db.DB.QueryRow(`SELECT category, activation_energy, updated_at FROM product_categories WHERE category = ?`, category).
+		Scan(&before.Category, &before.ActivationEnergy, &before.UpdatedAt)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Product category not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	c := before
+	c.ActivationEnergy = *req.ActivationEnergy
+	c.UpdatedAt = time.Now()
+
+	if _, err := db.DB.Exec(`UPDATE product_categories SET activation_energy = ? WHERE category = ?`, c.ActivationEnergy, category); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditCategoryUpdate, "product_category", category, nil, before, c)
+
+	response.JSON(w, http.StatusOK, c)
+}
+
+// GetChamberInventory returns the contents of a chamber and their value
+// Query Params: at (ISO8601, default now) to see the contents at a past moment
+func GetChamberInventory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
+
+	at := time.Now()
+	if t, err := queryTime(r, "at"); err != nil {
+		response.Fail(w, err)
+		return
+	} else if t != nil {
+		at = *t
+	}
+
+	inv, err := service.ChamberInventory(id, at)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, inv)
+}
+
+// GetSpoilageRisk evaluates the chamber's contents against each product's spoilage
+// rules over the last 24 hours of readings, with the recommended disposition
+// Query Params: at (ISO8601, default now)
+func GetSpoilageRisk(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
+
+	at := time.Now()
+	if t, err := queryTime(r, "at"); err != nil {
+		response.Fail(w, err)
+		return
+	} else if t != nil {
+		at = *t
+	}
+
+	assessment, err := service.AssessSpoilage(id, at)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, assessment)
+}
+
+// GetStockMovements returns the stock movements of a chamber, newest first
+// Query Params: product_id, lot_id, start, end (ISO8601, on moved_at), limit (default 100)
+func GetStockMovements(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !checkChamberAccess(w, r, id) {
+		return
+	}
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	conditions := []string{`m.sensor_id = ?`}
+	args := []interface{}{id}
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		conditions = append(conditions, `m.product_id = ?`)
+		args = append(args, productID)
+	}
+	if lotID := r.URL.Query().Get("lot_id"); lotID != "" {
+		conditions = append(conditions, `m.lot_id = ?`)
+		args = append(args, lotID)
+	}
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "m.moved_at "+op+" ?")
+			args = append(args, *t)
+		}
+	}
+
+	query := `
+		SELECT ` + stockMovementColumns + `
+		FROM stock_movements m
+		JOIN products p ON p.id = m.product_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY m.moved_at DESC, m.created_at DESC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		m, err := scanStockMovement(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		movements = append(movements, m)
+	}
+
+	response.JSON(w, http.StatusOK, movements)
+}
+
+// StockIn records product entering a chamber
+func StockIn(w http.ResponseWriter, r *http.Request) {
+	recordStockMovement(w, r, models.StockIn)
+}
+
+// StockOut records product leaving a chamber. It is rejected if the chamber
+// did not hold that much of the product at moved_at or does not hold it now.
+// Quarantined lots cannot be taken out: with lot_id the lot must be usable and
+// hold the quantity, without it the quarantined kg do not count as stock.
+func StockOut(w http.ResponseWriter, r *http.Request) {
+	recordStockMovement(w, r, models.StockOut)
+}
+
+func recordStockMovement(w http.ResponseWriter, r *http.Request, movementType string) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	var req stockMovementRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var fields []response.FieldError
+	if req.ProductID == "" && req.LotID == nil {
+		fields = append(fields, invalid("product_id", "is required"))
+	}
+	if req.LotID != nil && movementType == models.StockIn {
+		fields = append(fields, invalid("lot_id", "lots are received with POST /chambers/{id}/lots"))
+	}
+	if req.QuantityKg <= 0 {
+		fields = append(fields, invalid("quantity_kg", "must be greater than 0"))
+	}
+	if req.MovedAt != nil && req.MovedAt.After(time.Now().Add(5*time.Minute)) {
+		fields = append(fields, invalid("moved_at", "must not be in the future"))
+	}
+	if len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	m := models.StockMovement{
+		ID:         "MOV-" + uuid.New().String()[:8],
+		SensorID:   sensorID,
+		ProductID:  req.ProductID,
+		LotID:      req.LotID,
+		Type:       movementType,
+		QuantityKg: req.QuantityKg,
+		MovedAt:    time.Now(),
+		Notes:      req.Notes,
+		RecordedBy: requestUserID(r),
+		CreatedAt:  time.Now(),
+	}
+	if req.MovedAt != nil {
+		m.MovedAt = *req.MovedAt
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Bloquear la cámara serializa los movimientos concurrentes sobre su stock
+	var locked string
+	err = tx.QueryRow(`SELECT id FROM chambers WHERE id = ? FOR UPDATE`, sensorID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var lotStatus string
+	if m.LotID != nil {
+		var lotSensor, lotProduct string
+		err := tx.QueryRow(`SELECT sensor_id, product_id, status FROM lots WHERE id = ?`, *m.LotID).Scan(&lotSensor, &lotProduct, &lotStatus)
+		if err == sql.ErrNoRows || err == nil && lotSensor != sensorID {
+			response.Fail(w, response.NotFound("Lot not found"))
+			return
+		} else if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if m.ProductID != "" && m.ProductID != lotProduct {
+			response.Fail(w, response.Validation([]response.FieldError{invalid("lot_id", "belongs to another product")}))
+			return
+		}
+		m.ProductID = lotProduct
+		if lotStatus == models.LotQuarantined || lotStatus == models.LotDiscarded {
+			response.Fail(w, response.Conflict(fmt.Sprintf("Lot %s is %s", *m.LotID, lotStatus)))
+			return
+		}
+	}
+
+	err = tx.QueryRow(`SELECT name FROM products WHERE id = ?`, m.ProductID).Scan(&m.ProductName)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Product not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if movementType == models.StockOut {
+		// Lo que está en cuarentena sigue en la cámara pero no se puede retirar
+		quarantined, err := service.QuarantinedKg(tx, sensorID, m.ProductID)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if m.LotID != nil {
+			remaining, err := service.LotBalance(tx, *m.LotID)
+			if err != nil {
+				response.Fail(w, err)
+				return
+			}
+			if remaining < m.QuantityKg {
+				response.Fail(w, response.Conflict(fmt.Sprintf("Only %.3f kg left in lot %s", remaining, *m.LotID)))
+				return
+			}
+		}
+
+		checkpoints := []time.Time{m.MovedAt}
+		if now := time.Now(); now.After(m.MovedAt) {
+			checkpoints = append(checkpoints, now)
+		}
+		for _, at := range checkpoints {
+			balance, err := service.StockBalance(tx, sensorID, m.ProductID, at)
+			if err != nil {
+				response.Fail(w, err)
+				return
+			}
+			if balance -= quarantined; balance < m.QuantityKg {
+				response.Fail(w, response.Conflict(fmt.Sprintf("Only %.3f kg of %s usable at %s", balance, m.ProductName, at.Format(time.RFC3339))))
+				return
+			}
+		}
+	}
+
+	query := `
+		INSERT INTO stock_movements (id, sensor_id, product_id, lot_id, type, quantity_kg, moved_at, notes, recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if _, err := tx.Exec(query, m.ID, m.SensorID, m.ProductID, m.LotID, m.Type, m.QuantityKg, m.MovedAt, m.Notes, m.RecordedBy); err != nil {
+		response.Fail(w, dbWriteError(err, ""))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditStockMovement, "stock_movement", m.ID, chamberLocation(sensorID), nil, m)
+
+	response.JSON(w, http.StatusCreated, m)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type createLocationRequest struct {
+	OrganizationID string  `json:"organization_id"`
+	Name           string  `json:"name"`
+	Address        *string `json:"address"`
+}
+
+type assignLocationsRequest struct {
+	LocationIDs []string `json:"location_ids"`
+}
+
+// GetLocations returns the locations assigned to the user (all of them for owners)
+func GetLocations(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `SELECT id, organization_id, name, address, created_at FROM locations`
+	where, args := scope.clause("id")
+	if where != "" {
+		query += ` WHERE ` + where
+	}
+	query += ` ORDER BY name`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var locations []models.Location
+	for rows.Next() {
+		var l models.Location
+		var address sql.NullString
+
+		if err := rows.Scan(&l.ID, &l.OrganizationID, &l.Name, &address, &l.CreatedAt); err != nil {
+			response.Fail(w, err)
+			return
+		}
+
+		if address.Valid {
+			val := address.String
+			l.Address = &val
+		}
+
+		locations = append(locations, l)
+	}
+
+	response.JSON(w, http.StatusOK, locations)
+}
+
+// CreateLocation registers a new location within an organization
+func CreateLocation(w http.ResponseWriter, r *http.Request) {
+	var req createLocationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if req.OrganizationID == "" || req.Name == "" {
+		response.Fail(w, response.BadRequest("Missing 'organization_id' or 'name'"))
+		return
+	}
+
+	l := models.Location{
+		ID:             "LOC-" + uuid.New().String()[:8],
+		OrganizationID: req.OrganizationID,
+		Name:           req.Name,
+		Address:        req.Address,
+		CreatedAt:      time.Now(),
+	}
+
+	_, err := db.DB.Exec(`INSERT INTO locations (id, organization_id, name, address) VALUES (?, ?, ?, ?)`,
+		l.ID, l.OrganizationID, l.Name, l.Address)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, "Location already exists"))
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, l)
+}
+
+// SetUserLocations replaces the locations assigned to a user.
+// Managers may only assign locations they are assigned to themselves, and only to
+// users whose current locations are all within their own.
+func SetUserLocations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["id"]
+
+	var req assignLocationsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	for _, id := range req.LocationIDs {
+		if !scope.contains(id) {
+			response.Fail(w, response.Forbidden("Location not assigned to user: "+id))
+			return
+		}
+	}
+
+	var role string
+	err = db.DB.QueryRow(`SELECT role FROM users WHERE id = ?`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("User not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if role == auth.RoleOwner && auth.FromContext(r.Context()).Role != auth.RoleOwner {
+		response.Fail(w, response.Forbidden("Insufficient permissions"))
+		return
+	}
+
+	previous, err := userLocations(userID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	// Igual que GetUsers: un usuario de otro local no se revela
+	for _, id := range previous {
+		if !scope.contains(id) {
+			response.Fail(w, response.NotFound("User not found"))
+			return
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Solo se reemplazan las asignaciones dentro del alcance de quien edita
+	deleteQuery := `DELETE FROM user_locations WHERE user_id = ?`
+	deleteArgs := []interface{}{userID}
+	if where, scopeArgs := scope.clause("location_id"); where != "" {
+		deleteQuery += ` AND ` + where
+		deleteArgs = append(deleteArgs, scopeArgs...)
+	}
+	if _, err := tx.Exec(deleteQuery, deleteArgs...); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	for _, id := range req.LocationIDs {
+		if _, err := tx.Exec(`INSERT INTO user_locations (user_id, location_id) VALUES (?, ?)`, userID, id); err != nil {
+			response.Fail(w, dbWriteError(err, "Location "+id+" assigned twice"))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	ids, err := userLocations(userID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditUserLocations, "user", userID, nil,
+		map[string]interface{}{"location_ids": previous}, map[string]interface{}{"location_ids": ids})
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":      userID,
+		"location_ids": ids,
+	})
+}
@@ -0,0 +1,490 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// lotRequest is the body of POST /chambers/{id}/lots
+type lotRequest struct {
+	ProductID  string     `json:"product_id"`
+	LotCode    *string    `json:"lot_code"`
+	Supplier   string     `json:"supplier"`
+	ReceivedAt *time.Time `json:"received_at"`
+	QuantityKg float64    `json:"quantity_kg"`
+	Notes      *string    `json:"notes"`
+}
+
+// lotResolveRequest is the body of POST /lots/{id}/resolve
+type lotResolveRequest struct {
+	Decision      string `json:"decision"` // release, discard
+	Justification string `json:"justification"`
+}
+
+// lotColumns are the columns read by scanLot (lots aliased as l, products as p)
+const lotColumns = `l.id, l.sensor_id, l.product_id, p.name, l.lot_code, l.supplier, l.received_at, l.quantity_kg,
+	COALESCE((SELECT SUM(CASE WHEN m.type = 'out' THEN -m.quantity_kg ELSE m.quantity_kg END) FROM stock_movements m WHERE m.lot_id = l.id), 0),
+	l.status, l.quarantined_at, l.quarantine_excursion_id, l.quarantine_reason, l.resolved_at, l.resolved_by, l.resolution, l.notes, l.recorded_by, l.created_at`
+
+func scanLot(row interface{ Scan(...interface{}) error }) (models.Lot, error) {
+	var l models.Lot
+	var lotCode, excursionID, reason, resolvedBy, resolution, notes, recordedBy sql.NullString
+	var quarantinedAt, resolvedAt sql.NullTime
+
+	err := row.Scan(&l.ID, &l.SensorID, &l.ProductID, &l.ProductName, &lotCode, &l.Supplier, &l.ReceivedAt, &l.QuantityKg, &l.RemainingKg,
+		&l.Status, &quarantinedAt, &excursionID, &reason, &resolvedAt, &resolvedBy, &resolution, &notes, &recordedBy, &l.CreatedAt)
+	if err != nil {
+		return l, err
+	}
+
+	for _, f := range []struct {
+		src sql.NullString
+		dst **string
+	}{
+		{lotCode, &l.LotCode}, {excursionID, &l.QuarantineExcursionID}, {reason, &l.QuarantineReason},
+		{resolvedBy, &l.ResolvedBy}, {resolution, &l.Resolution}, {notes, &l.Notes}, {recordedBy, &l.RecordedBy},
+	} {
+		if f.src.Valid {
+			val := f.src.String
+			*f.dst = &val
+		}
+	}
+	if quarantinedAt.Valid {
+		val := quarantinedAt.Time
+		l.QuarantinedAt = &val
+	}
+	if resolvedAt.Valid {
+		val := resolvedAt.Time
+		l.ResolvedAt = &val
+	}
+	return l, nil
+}
+
+// loadLot returns a lot if the user can see its chamber, writing the error otherwise
+func loadLot(w http.ResponseWriter, r *http.Request, id string) (models.Lot, bool) {
+	l, err := scanLot(db.DB.QueryRow(`SELECT `+lotColumns+` FROM lots l JOIN products p ON p.id = l.product_id WHERE l.id = ?`, id))
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Lot not found"))
+		return l, false
+	} else if err != nil {
+		response.Fail(w, err)
+		return l, false
+	}
+	if !checkChamberAccess(w, r, l.SensorID) {
+		return l, false
+	}
+	return l, true
+}
+
+// GetLots returns the lots of the user's locations, newest first
+// Query Params: chamber_id, product_id, status (available|quarantined|released|discarded), location_id, limit (default 100)
+func GetLots(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var conditions []string
+	var args []interface{}
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		conditions = append(conditions, where)
+		args = append(args, scopeArgs...)
+	}
+	if chamberID := r.URL.Query().Get("chamber_id"); chamberID != "" {
+		conditions = append(conditions, `l.sensor_id = ?`)
+		args = append(args, chamberID)
+	}
+	if productID := r.URL.Query().Get("product_id"); productID != "" {
+		conditions = append(conditions, `l.product_id = ?`)
+		args = append(args, productID)
+	}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case models.LotAvailable, models.LotQuarantined, models.LotReleased, models.LotDiscarded:
+		conditions = append(conditions, `l.status = ?`)
+		args = append(args, status)
+	default:
+		response.Fail(w, response.BadRequest("'status' must be available, quarantined, released or discarded"))
+		return
+	}
+
+	query := `
+		SELECT ` + lotColumns + `
+		FROM lots l
+		JOIN products p ON p.id = l.product_id
+		JOIN chambers c ON c.id = l.sensor_id`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += `
+		ORDER BY l.received_at DESC, l.id DESC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	lots := []models.Lot{}
+	for rows.Next() {
+		l, err := scanLot(rows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		lots = append(lots, l)
+	}
+
+	response.JSON(w, http.StatusOK, lots)
+}
+
+// GetLot returns a single lot
+func GetLot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	l, ok := loadLot(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	response.JSON(w, http.StatusOK, l)
+}
+
+// CreateLot receives a lot into a chamber, recording its stock-in movement
+func CreateLot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sensorID := vars["id"]
+
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	var req lotRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var fields []response.FieldError
+	if req.ProductID == "" {
+		fields = append(fields, invalid("product_id", "is required"))
+	}
+	if strings.TrimSpace(req.Supplier) == "" {
+		fields = append(fields, invalid("supplier", "is required"))
+	}
+	if req.QuantityKg <= 0 {
+		fields = append(fields, invalid("quantity_kg", "must be greater than 0"))
+	}
+	if req.ReceivedAt != nil && req.ReceivedAt.After(time.Now().Add(5*time.Minute)) {
+		fields = append(fields, invalid("received_at", "must not be in the future"))
+	}
+	if len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	l := models.Lot{
+		ID:          "LOT-" + uuid.New().String()[:8],
+		SensorID:    sensorID,
+		ProductID:   req.ProductID,
+		LotCode:     req.LotCode,
+		Supplier:    strings.TrimSpace(req.Supplier),
+		ReceivedAt:  time.Now(),
+		QuantityKg:  req.QuantityKg,
+		RemainingKg: req.QuantityKg,
+		Status:      models.LotAvailable,
+		Notes:       req.Notes,
+		RecordedBy:  requestUserID(r),
+		CreatedAt:   time.Now(),
+	}
+	if req.ReceivedAt != nil {
+		l.ReceivedAt = *req.ReceivedAt
+	}
+
+	err := db.DB.QueryRow(`SELECT name FROM products WHERE id = ?`, l.ProductID).Scan(&l.ProductName)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Product not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO lots (id, sensor_id, product_id, lot_code, supplier, received_at, quantity_kg, status, notes, recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = tx.Exec(query, l.ID, l.SensorID, l.ProductID, l.LotCode, l.Supplier, l.ReceivedAt, l.QuantityKg, l.Status, l.Notes, l.RecordedBy)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, ""))
+		return
+	}
+
+	// La entrada del lote es su primer movimiento de stock
+	_, err = tx.Exec(`
+		INSERT INTO stock_movements (id, sensor_id, product_id, lot_id, type, quantity_kg, moved_at, notes, recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		"MOV-"+uuid.New().String()[:8], l.SensorID, l.ProductID, l.ID, models.StockIn, l.QuantityKg, l.ReceivedAt, "Recepción de lote de "+l.Supplier, l.RecordedBy)
+	if err != nil {
+		response.Fail(w, dbWriteError(err, ""))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, service.AuditLotCreate, "lot", l.ID, chamberLocation(sensorID), nil, l)
+
+	response.JSON(w, http.StatusCreated, l)
+}
+
+// ResolveLot releases or discards a quarantined lot. A discard takes its remaining
+// stock out of the chamber; the justification is kept with the lot.
+func ResolveLot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req lotResolveRequest
+	if err := decodeJSON(r, &req); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	var fields []response.FieldError
+	if req.Decision != "release" && req.Decision != "discard" {
+		fields = append(fields, invalid("decision", "must be release or discard"))
+	}
+	if strings.TrimSpace(req.Justification) == "" {
+		fields = append(fields, invalid("justification", "is required"))
+	}
+	if len(fields) > 0 {
+		response.Fail(w, response.Validation(fields))
+		return
+	}
+
+	before, ok := loadLot(w, r, id)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Bloquear el lote evita resolverlo dos veces o retirar stock mientras se descarta
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM lots WHERE id = ? FOR UPDATE`, id).Scan(&status); err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if status != models.LotQuarantined {
+		response.Fail(w, response.Conflict(fmt.Sprintf("Lot is %s, only quarantined lots can be resolved", status)))
+		return
+	}
+
+	l := before
+	now := time.Now()
+	justification := strings.TrimSpace(req.Justification)
+	l.Status = models.LotReleased
+	action := service.AuditLotRelease
+	if req.Decision == "discard" {
+		l.Status = models.LotDiscarded
+		action = service.AuditLotDiscard
+	}
+	l.ResolvedAt = &now
+	l.ResolvedBy = requestUserID(r)
+	l.Resolution = &justification
+
+	_, err = tx.Exec(`UPDATE lots SET status = ?, resolved_at = ?, resolved_by = ?, resolution = ? WHERE id = ?`,
+		l.Status, l.ResolvedAt, l.ResolvedBy, l.Resolution, id)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if l.Status == models.LotDiscarded {
+		remaining, err := service.LotBalance(tx, id)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if remaining > 0 {
+			_, err = tx.Exec(`
+				INSERT INTO stock_movements (id, sensor_id, product_id, lot_id, type, quantity_kg, moved_at, notes, recorded_by)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				"MOV-"+uuid.New().String()[:8], l.SensorID, l.ProductID, l.ID, models.StockOut, remaining, now, "Descarte de lote: "+justification, l.ResolvedBy)
+			if err != nil {
+				response.Fail(w, dbWriteError(err, ""))
+				return
+			}
+		}
+		l.RemainingKg = 0
+	}
+	if err := tx.Commit(); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	recordAudit(r, action, "lot", id, chamberLocation(l.SensorID), before, l)
+
+	response.JSON(w, http.StatusOK, l)
+}
+
+// GetLotTraceability returns the temperature history of a lot's chamber from its
+// reception until it was discarded, depleted or now, with the excursions it went through
+// Query Params: bucket (15m|1h|1d, default 1h)
+func GetLotTraceability(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	l, ok := loadLot(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = "1h"
+	}
+	seconds, ok := exportBuckets[bucket]
+	if !ok {
+		response.Fail(w, response.BadRequest("'bucket' must be 15m, 1h or 1d"))
+		return
+	}
+
+	t := models.LotTraceability{Lot: l, From: l.ReceivedAt, Until: time.Now(), History: []models.LotHistoryPoint{}}
+
+	var category string
+	var o ruleOverrides
+	err := db.DB.QueryRow(`
+		SELECT category, safe_min_temperature, safe_max_temperature, max_exposure_minutes, degradation_rate
+		FROM products WHERE id = ?`, l.ProductID).Scan(&category, &o.safeMin, &o.safeMax, &o.maxExposure, &o.degradationRate)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	t.Rules = service.ProductRulesFor(category, o.safeMin, o.safeMax, o.maxExposure, o.degradationRate)
+
+	movementRows, err := db.DB.Query(`
+		SELECT `+stockMovementColumns+`
+		FROM stock_movements m
+		JOIN products p ON p.id = m.product_id
+		WHERE m.lot_id = ?
+		ORDER BY m.moved_at, m.created_at`, l.ID)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer movementRows.Close()
+
+	t.Movements = []models.StockMovement{}
+	for movementRows.Next() {
+		m, err := scanStockMovement(movementRows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		t.Movements = append(t.Movements, m)
+	}
+
+	// El lote deja la cámara al descartarse o con su último retiro
+	switch {
+	case l.Status == models.LotDiscarded && l.ResolvedAt != nil:
+		t.Until = *l.ResolvedAt
+	case l.RemainingKg <= 0 && len(t.Movements) > 0:
+		t.Until = t.Movements[len(t.Movements)-1].MovedAt
+	}
+
+	var minT, avgT, maxT sql.NullFloat64
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*), MIN(temperature), AVG(temperature), MAX(temperature)
+		FROM temperature_readings
+		WHERE sensor_id = ? AND quality = 'OK' AND timestamp BETWEEN ? AND ?`, l.SensorID, t.From, t.Until).Scan(&t.Readings, &minT, &avgT, &maxT)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	for _, f := range []struct {
+		src sql.NullFloat64
+		dst **float64
+	}{{minT, &t.Min}, {avgT, &t.Avg}, {maxT, &t.Max}} {
+		if f.src.Valid {
+			val := f.src.Float64
+			*f.dst = &val
+		}
+	}
+
+	historyRows, err := db.DB.Query(`
+		SELECT FROM_UNIXTIME(FLOOR(UNIX_TIMESTAMP(timestamp) / ?) * ?) AS bucket_start,
+			MIN(temperature), AVG(temperature), MAX(temperature), COUNT(*)
+		FROM temperature_readings
+		WHERE sensor_id = ? AND quality = 'OK' AND timestamp BETWEEN ? AND ?
+		GROUP BY bucket_start
+		ORDER BY bucket_start`, seconds, seconds, l.SensorID, t.From, t.Until)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer historyRows.Close()
+
+	for historyRows.Next() {
+		var p models.LotHistoryPoint
+		if err := historyRows.Scan(&p.At, &p.Min, &p.Avg, &p.Max, &p.Readings); err != nil {
+			response.Fail(w, err)
+			return
+		}
+		t.History = append(t.History, p)
+	}
+
+	excursionRows, err := db.DB.Query(`
+		SELECT `+excursionColumns+`
+		FROM excursions e
+		WHERE e.sensor_id = ? AND e.started_at <= ? AND (e.ended_at IS NULL OR e.ended_at >= ?)
+		ORDER BY e.started_at`, l.SensorID, t.Until, t.From)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer excursionRows.Close()
+
+	t.Excursions = []models.Excursion{}
+	for excursionRows.Next() {
+		e, err := scanExcursion(excursionRows)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		t.Excursions = append(t.Excursions, e)
+	}
+
+	response.JSON(w, http.StatusOK, t)
+}
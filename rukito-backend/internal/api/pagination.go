@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/response"
+)
+
+// Headers de paginación (el cuerpo de las listas sigue siendo un array)
+const (
+	headerTotalCount = "X-Total-Count"
+	headerNextCursor = "X-Next-Cursor"
+)
+
+// pageCursor points at the last row of a page ordered by (timestamp DESC, id DESC)
+type pageCursor struct {
+	timestamp time.Time
+	id        string
+}
+
+func encodeCursor(ts time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(ts.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+// queryCursor parses the opaque ?cursor= returned by a previous page (nil when absent)
+func queryCursor(r *http.Request) (*pageCursor, error) {
+	v := r.URL.Query().Get("cursor")
+	if v == "" {
+		return nil, nil
+	}
+
+	invalid := response.BadRequest("Invalid 'cursor'")
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, invalid
+	}
+	tsStr, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, invalid
+	}
+	ts, err := time.Parse(time.RFC3339Nano, tsStr)
+	if err != nil {
+		return nil, invalid
+	}
+	return &pageCursor{timestamp: ts, id: id}, nil
+}
+
+// clause returns the condition selecting the rows after the cursor
+func (c *pageCursor) clause(tsColumn, idColumn string) (string, []interface{}) {
+	return "(" + tsColumn + " < ? OR (" + tsColumn + " = ? AND " + idColumn + " < ?))", []interface{}{c.timestamp, c.timestamp, c.id}
+}
+
+// writePageHeaders sets the total count and, if there are more rows, the next cursor
+func writePageHeaders(w http.ResponseWriter, total int, next string) {
+	w.Header().Set(headerTotalCount, strconv.Itoa(total))
+	if next != "" {
+		w.Header().Set(headerNextCursor, next)
+	}
+}
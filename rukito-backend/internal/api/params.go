@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// maxListLimit is the largest ?limit= accepted by list endpoints
+const maxListLimit = 1000
+
+// idPattern matches the identifiers used across the schema (VARCHAR(50))
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,49}$`)
+
+// ValidatePathParams rejects requests whose path variables are not valid
+// identifiers, before they reach any handler or query
+func ValidatePathParams(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range mux.Vars(r) {
+			if !idPattern.MatchString(value) {
+				response.Fail(w, response.BadRequest("Invalid path parameter '"+name+"'"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// queryLimit parses ?limit=, returning def when absent
+func queryLimit(r *http.Request, def int) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		return 0, response.BadRequest("'limit' must be an integer between 1 and " + strconv.Itoa(maxListLimit))
+	}
+	return limit, nil
+}
+
+// queryInt parses an optional integer query parameter (nil when absent)
+func queryInt(r *http.Request, name string) (*int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, response.BadRequest("'" + name + "' must be an integer")
+	}
+	return &n, nil
+}
+
+// queryBool parses an optional boolean query parameter (false when absent)
+func queryBool(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, response.BadRequest("'" + name + "' must be true or false")
+	}
+	return b, nil
+}
+
+// queryTime parses an optional ISO8601 query parameter (nil when absent)
+func queryTime(r *http.Request, name string) (*time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, response.BadRequest("Invalid date format for '" + name + "'. Use ISO8601 (e.g. 2024-12-01T00:00:00Z)")
+	}
+	return &t, nil
+}
@@ -1,62 +1,118 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/angello/rukito-backend/internal/db"
 	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
 	"github.com/gorilla/mux"
 )
 
-// GetReadings returns recent readings for a chamber
-// Query Params: limit (default 100)
+// GetReadings returns the readings of a chamber, newest first
+// Query Params: limit (default 100), cursor, start, end (ISO8601), status, quality
 func GetReadings(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sensorID := vars["id"]
 
-	limitStr := r.URL.Query().Get("limit")
-	limit := 100
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
+	if !checkChamberAccess(w, r, sensorID) {
+		return
+	}
+
+	limit, err := queryLimit(r, 100)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	cursor, err := queryCursor(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	conditions := []string{`sensor_id = ?`}
+	args := []interface{}{sensorID}
+
+	for param, op := range map[string]string{"start": ">=", "end": "<="} {
+		t, err := queryTime(r, param)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		if t != nil {
+			conditions = append(conditions, "timestamp "+op+" ?")
+			args = append(args, *t)
+		}
+	}
+	for _, f := range []string{"status", "quality"} {
+		if v := r.URL.Query().Get(f); v != "" {
+			conditions = append(conditions, f+" = ?")
+			args = append(args, v)
 		}
 	}
 
+	var total int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM temperature_readings WHERE `+strings.Join(conditions, " AND "), args...).Scan(&total); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	if cursor != nil {
+		where, cursorArgs := cursor.clause("timestamp", "id")
+		conditions = append(conditions, where)
+		args = append(args, cursorArgs...)
+	}
+
 	query := `
-		SELECT id, sensor_id, temperature, rate_of_change, status, timestamp 
+		SELECT id, sensor_id, temperature, raw_temperature, rate_of_change, status, quality, timestamp 
 		FROM temperature_readings 
-		WHERE sensor_id = ? 
-		ORDER BY timestamp DESC 
+		WHERE ` + strings.Join(conditions, " AND ") + ` 
+		ORDER BY timestamp DESC, id DESC 
 		LIMIT ?`
+	args = append(args, limit+1) // una fila extra indica si hay página siguiente
 
-	rows, err := db.DB.Query(query, sensorID, limit)
+	rows, err := db.DB.Query(query, args...)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
 		return
 	}
 	defer rows.Close()
 
-	var readings []models.TemperatureReading
+	readings := []models.TemperatureReading{}
 	for rows.Next() {
 		var tr models.TemperatureReading
 		// Note: The struct has TargetTemp, MinTemp, MaxTemp which are not in the readings table
 		// based on the SQL script. We might need to join with chambers table or leave them 0/null
 		// For now, we will fill what we have in the DB.
 		// The API Spec response shows them. Ideally, we JOIN chambers to get targets.
-		
-		err := rows.Scan(&tr.ID, &tr.SensorID, &tr.Temperature, &tr.RateOfChange, &tr.Status, &tr.Timestamp)
+
+		var rawTemp sql.NullFloat64
+
+		err := rows.Scan(&tr.ID, &tr.SensorID, &tr.Temperature, &rawTemp, &tr.RateOfChange, &tr.Status, &tr.Quality, &tr.Timestamp)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Fail(w, err)
 			return
 		}
+
+		if rawTemp.Valid {
+			val := rawTemp.Float64
+			tr.RawTemperature = &val
+		}
 		readings = append(readings, tr)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(readings)
+	next := ""
+	if len(readings) > limit {
+		readings = readings[:limit]
+		last := readings[limit-1]
+		next = encodeCursor(last.Timestamp, strconv.Itoa(last.ID))
+	}
+
+	writePageHeaders(w, total, next)
+	response.JSON(w, http.StatusOK, readings)
 }
 
 // GetReadingHistory returns historical readings for a date range
@@ -65,32 +121,38 @@ func GetReadingHistory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sensorID := vars["id"]
 
-	startStr := r.URL.Query().Get("start")
-	endStr := r.URL.Query().Get("end")
-
-	if startStr == "" || endStr == "" {
-		http.Error(w, "Missing 'start' or 'end' query parameters", http.StatusBadRequest)
+	if !checkChamberAccess(w, r, sensorID) {
 		return
 	}
 
-	// Validate time format (RFC3339 matches ISO8601 for this purpose)
-	_, errStart := time.Parse(time.RFC3339, startStr)
-	_, errEnd := time.Parse(time.RFC3339, endStr)
-
-	if errStart != nil || errEnd != nil {
-		http.Error(w, "Invalid date format. Use ISO8601 (e.g. 2024-12-01T00:00:00Z)", http.StatusBadRequest)
+	start, err := queryTime(r, "start")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	end, err := queryTime(r, "end")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if start == nil || end == nil {
+		response.Fail(w, response.BadRequest("Missing 'start' or 'end' query parameters"))
+		return
+	}
+	if end.Before(*start) {
+		response.Fail(w, response.BadRequest("'end' must not be before 'start'"))
 		return
 	}
 
 	query := `
-		SELECT id, sensor_id, temperature, rate_of_change, status, timestamp 
+		SELECT id, sensor_id, temperature, raw_temperature, rate_of_change, status, quality, timestamp 
 		FROM temperature_readings 
 		WHERE sensor_id = ? AND timestamp BETWEEN ? AND ?
 		ORDER BY timestamp ASC`
 
-	rows, err := db.DB.Query(query, sensorID, startStr, endStr)
+	rows, err := db.DB.Query(query, sensorID, *start, *end)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Fail(w, err)
 		return
 	}
 	defer rows.Close()
@@ -98,14 +160,20 @@ func GetReadingHistory(w http.ResponseWriter, r *http.Request) {
 	var readings []models.TemperatureReading
 	for rows.Next() {
 		var tr models.TemperatureReading
-		err := rows.Scan(&tr.ID, &tr.SensorID, &tr.Temperature, &tr.RateOfChange, &tr.Status, &tr.Timestamp)
+		var rawTemp sql.NullFloat64
+
+		err := rows.Scan(&tr.ID, &tr.SensorID, &tr.Temperature, &rawTemp, &tr.RateOfChange, &tr.Status, &tr.Quality, &tr.Timestamp)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			response.Fail(w, err)
 			return
 		}
+
+		if rawTemp.Valid {
+			val := rawTemp.Float64
+			tr.RawTemperature = &val
+		}
 		readings = append(readings, tr)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(readings)
+	response.JSON(w, http.StatusOK, readings)
 }
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// GetReplayRuns returns the replay runs with readings from the caller's locations, newest first
+// Query Params: location_id
+func GetReplayRuns(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `SELECT rr.id, rr.source, rr.speed, rr.total_points, rr.started_at, rr.finished_at FROM replay_runs rr`
+	var args []interface{}
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		query += `
+		WHERE EXISTS (
+			SELECT 1 FROM replay_readings rd
+			JOIN chambers c ON c.id = rd.sensor_id
+			WHERE rd.run_id = rr.id AND ` + where + `)`
+		args = scopeArgs
+	}
+	query += ` ORDER BY rr.started_at DESC`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var runs []models.ReplayRun
+	for rows.Next() {
+		var run models.ReplayRun
+		var finishedAt sql.NullTime
+
+		err := rows.Scan(&run.ID, &run.Source, &run.Speed, &run.TotalPoints, &run.StartedAt, &finishedAt)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+
+		if finishedAt.Valid {
+			val := finishedAt.Time
+			run.FinishedAt = &val
+		}
+
+		runs = append(runs, run)
+	}
+
+	response.JSON(w, http.StatusOK, runs)
+}
+
+// GetReplayAlerts returns the alerts a replay run would have raised,
+// so they can be compared against the original alerts table
+// Query Params: location_id
+func GetReplayAlerts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	runID := vars["id"]
+
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	query := `
+		SELECT ra.id, ra.title, ra.description, ra.priority, ra.type, ra.sensor_id, ra.estimated_cost, ra.affected_content, ra.suggested_action, ra.config_revision, ra.timestamp 
+		FROM replay_alerts ra 
+		JOIN chambers c ON c.id = ra.sensor_id 
+		WHERE ra.run_id = ?`
+	args := []interface{}{runID}
+
+	if where, scopeArgs := scope.clause("c.location_id"); where != "" {
+		query += ` AND ` + where
+		args = append(args, scopeArgs...)
+	}
+	query += ` ORDER BY ra.timestamp ASC`
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	defer rows.Close()
+
+	var alerts []models.Alert
+	for rows.Next() {
+		var a models.Alert
+		var estCost sql.NullFloat64
+		var affectedContent, suggestedAction sql.NullString
+		var configRevision sql.NullInt64
+
+		err := rows.Scan(&a.ID, &a.Title, &a.Description, &a.Priority, &a.Type, &a.SensorID, &estCost, &affectedContent, &suggestedAction, &configRevision, &a.Timestamp)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+
+		if estCost.Valid {
+			val := estCost.Float64
+			a.EstimatedCost = &val
+		}
+		if affectedContent.Valid {
+			val := affectedContent.String
+			a.AffectedContent = &val
+		}
+		if suggestedAction.Valid {
+			val := suggestedAction.String
+			a.SuggestedAction = &val
+		}
+		if configRevision.Valid {
+			val := int(configRevision.Int64)
+			a.ConfigRevision = &val
+		}
+
+		alerts = append(alerts, a)
+	}
+
+	response.JSON(w, http.StatusOK, alerts)
+}
@@ -1,38 +1,79 @@
 package api
 
 import (
+	"bytes"
+	"database/sql"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/response"
+	"github.com/angello/rukito-backend/internal/service"
 	"github.com/gorilla/mux"
 )
 
 // GetReport acts as a proxy/gateway to the Python Analytics service
+// Query Params: minutes (KPI window, default 30), start, end (ISO8601, both or neither) for the
+// thermal metrics (MKT, degree-minutes), default the KPI window
 func GetReport(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	chamberID := vars["id"]
 
+	if !checkChamberAccess(w, r, chamberID) {
+		return
+	}
+
+	params := url.Values{}
+	minutes, err := queryInt(r, "minutes")
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if minutes != nil {
+		if *minutes < 1 {
+			response.Fail(w, response.BadRequest("'minutes' must be greater than 0"))
+			return
+		}
+		params.Set("minutes", strconv.Itoa(*minutes))
+	}
+	if r.URL.Query().Get("start") != "" || r.URL.Query().Get("end") != "" {
+		start, end, err := exportRange(r)
+		if err != nil {
+			response.Fail(w, err)
+			return
+		}
+		// La base guarda los timestamps en UTC sin zona, igual que los lee el servicio de análisis
+		params.Set("start", start.UTC().Format("2006-01-02T15:04:05"))
+		params.Set("end", end.UTC().Format("2006-01-02T15:04:05"))
+	}
+
 	pythonURL := os.Getenv("PYTHON_SERVICE_URL")
 	if pythonURL == "" {
 		pythonURL = "http://localhost:8000"
 	}
 
 	targetURL := fmt.Sprintf("%s/analyze/report/%s", pythonURL, chamberID)
+	if len(params) > 0 {
+		targetURL += "?" + params.Encode()
+	}
 
 	fmt.Printf("Go Backend: Requesting report from Python service at %s\n", targetURL)
 
 	resp, err := http.Get(targetURL)
 	if err != nil {
-		http.Error(w, "Failed to connect to Analytics service: "+err.Error(), http.StatusServiceUnavailable)
+		response.Fail(w, response.Unavailable("Failed to connect to Analytics service"))
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("Analytics service error: %s", string(body)), resp.StatusCode)
+		response.Fail(w, response.BadGateway(fmt.Sprintf("Analytics service returned %d", resp.StatusCode), fmt.Errorf("%s", body)))
 		return
 	}
 
@@ -40,22 +81,85 @@ func GetReport(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, resp.Body)
 }
 
-// GetStatistics acts as a proxy for global statistics from Python service
+// GetStatistics acts as a proxy for statistics from Python service,
+// restricted to the user's locations
+// Query Params: location_id
 func GetStatistics(w http.ResponseWriter, r *http.Request) {
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
 	pythonURL := os.Getenv("PYTHON_SERVICE_URL")
 	if pythonURL == "" {
 		pythonURL = "http://localhost:8000"
 	}
 
 	targetURL := fmt.Sprintf("%s/analyze/statistics", pythonURL)
+	if !scope.all {
+		targetURL += "?location_ids=" + url.QueryEscape(strings.Join(scope.ids, ","))
+	}
 
 	resp, err := http.Get(targetURL)
 	if err != nil {
-		http.Error(w, "Failed to connect to Analytics service", http.StatusServiceUnavailable)
+		response.Fail(w, response.Unavailable("Failed to connect to Analytics service"))
 		return
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		response.Fail(w, response.BadGateway(fmt.Sprintf("Analytics service returned %d", resp.StatusCode), fmt.Errorf("%s", body)))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	io.Copy(w, resp.Body)
-}
\ No newline at end of file
+}
+// GetHACCPReportPDF generates the signed temperature log (HACCP) of a chamber
+// Query Params: start, end (ISO8601, required), tz (IANA, default EXPORT_TIMEZONE)
+func GetHACCPReportPDF(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chamberID := vars["id"]
+
+	if !checkChamberAccess(w, r, chamberID) {
+		return
+	}
+
+	start, end, err := exportRange(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	tz, err := queryTimezone(r)
+	if err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	report, err := service.BuildHACCPReport(chamberID, start, end, tz)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return
+	} else if err != nil {
+		response.Fail(w, err)
+		return
+	}
+	if claims := auth.FromContext(r.Context()); claims != nil {
+		report.GeneratedBy = claims.Username
+	}
+
+	// Se genera completo en memoria para poder responder con un error JSON si falla
+	var buf bytes.Buffer
+	if err := report.WritePDF(&buf); err != nil {
+		response.Fail(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("haccp_%s_%s_%s.pdf", chamberID, start.In(tz).Format("20060102"), end.In(tz).Format("20060102"))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
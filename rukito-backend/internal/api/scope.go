@@ -0,0 +1,134 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/response"
+)
+
+var errLocationForbidden = response.Forbidden("Location not assigned to user")
+
+// locationScope is the set of locations a request may see.
+// all=true means no restriction (owner without ?location_id= filter).
+type locationScope struct {
+	all bool
+	ids []string
+}
+
+// clause returns a SQL condition restricting column to the scope, or "" if unrestricted
+func (s locationScope) clause(column string) (string, []interface{}) {
+	if s.all {
+		return "", nil
+	}
+	if len(s.ids) == 0 {
+		return "1 = 0", nil
+	}
+
+	args := make([]interface{}, len(s.ids))
+	for i, id := range s.ids {
+		args[i] = id
+	}
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(s.ids)), ", ") + ")", args
+}
+
+func (s locationScope) contains(locationID string) bool {
+	if s.all {
+		return true
+	}
+	for _, id := range s.ids {
+		if id == locationID {
+			return true
+		}
+	}
+	return false
+}
+
+// userLocations returns the locations assigned to a user
+func userLocations(userID string) ([]string, error) {
+	rows, err := db.DB.Query(`SELECT location_id FROM user_locations WHERE user_id = ? ORDER BY location_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// requestScope resolves the locations visible to the authenticated user,
+// narrowed by the optional ?location_id= query parameter
+func requestScope(r *http.Request) (locationScope, error) {
+	claims := auth.FromContext(r.Context())
+	filter := r.URL.Query().Get("location_id")
+
+	var scope locationScope
+	if claims != nil && claims.Role == auth.RoleOwner {
+		scope.all = true
+	} else if claims != nil {
+		ids, err := userLocations(claims.UserID)
+		if err != nil {
+			return scope, err
+		}
+		scope.ids = ids
+	}
+
+	if filter != "" {
+		if !scope.contains(filter) {
+			return scope, errLocationForbidden
+		}
+		scope = locationScope{ids: []string{filter}}
+	}
+
+	return scope, nil
+}
+
+// checkChamberAccess writes a 404 and returns false if the chamber does not exist
+// or belongs to a location the user cannot see (so other locations are not revealed)
+func checkChamberAccess(w http.ResponseWriter, r *http.Request, chamberID string) bool {
+	claims := auth.FromContext(r.Context())
+	if claims != nil && claims.Role == auth.RoleOwner {
+		return true
+	}
+
+	var locationID sql.NullString
+	err := db.DB.QueryRow(`SELECT location_id FROM chambers WHERE id = ?`, chamberID).Scan(&locationID)
+	if err == sql.ErrNoRows {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return false
+	} else if err != nil {
+		response.Fail(w, err)
+		return false
+	}
+
+	scope, err := requestScope(r)
+	if err != nil {
+		response.Fail(w, err)
+		return false
+	}
+	if !locationID.Valid || !scope.contains(locationID.String) {
+		response.Fail(w, response.NotFound("Chamber not found"))
+		return false
+	}
+	return true
+}
+
+// chamberLocation returns the location of a chamber, or nil if unknown
+func chamberLocation(chamberID string) *string {
+	var locationID sql.NullString
+	if err := db.DB.QueryRow(`SELECT location_id FROM chambers WHERE id = ?`, chamberID).Scan(&locationID); err != nil || !locationID.Valid {
+		return nil
+	}
+	val := locationID.String
+	return &val
+}
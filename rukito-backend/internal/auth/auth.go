@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles de usuario, de menor a mayor privilegio
+const (
+	RoleReadOnly = "readonly"
+	RoleStaff    = "staff"
+	RoleManager  = "manager"
+	RoleOwner    = "owner"
+)
+
+var roleRank = map[string]int{
+	RoleReadOnly: 0,
+	RoleStaff:    1,
+	RoleManager:  2,
+	RoleOwner:    3,
+}
+
+// ValidRole indica si el rol existe
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole indica si role tiene al menos los privilegios de required
+func HasRole(role, required string) bool {
+	have, ok := roleRank[role]
+	if !ok {
+		return false
+	}
+	return have >= roleRank[required]
+}
+
+// Tipos de token emitidos
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+// Claims es el contenido de los JWT emitidos por el backend
+type Claims struct {
+	UserID    string `json:"uid"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	TokenType string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+var (
+	secret     []byte
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 7 * 24 * time.Hour
+)
+
+// Init carga la configuración de autenticación desde el entorno.
+// JWT_SECRET debería estar definido; si no, se genera uno aleatorio
+// y los tokens dejan de ser válidos al reiniciar el servidor. Devuelve error si no
+// se pudo generar ese secreto: firmar con una clave vacía o predecible no es aceptable.
+func Init() error {
+	if s := os.Getenv("JWT_SECRET"); s != "" {
+		secret = []byte(s)
+	} else {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return fmt.Errorf("generando JWT_SECRET temporal: %w", err)
+		}
+		secret = []byte(hex.EncodeToString(buf))
+		fmt.Println("⚠️  JWT_SECRET no definido: usando un secreto temporal")
+	}
+
+	if m, err := strconv.Atoi(os.Getenv("JWT_ACCESS_TTL_MINUTES")); err == nil && m > 0 {
+		accessTTL = time.Duration(m) * time.Minute
+	}
+	if h, err := strconv.Atoi(os.Getenv("JWT_REFRESH_TTL_HOURS")); err == nil && h > 0 {
+		refreshTTL = time.Duration(h) * time.Hour
+	}
+	return nil
+}
+
+// AccessTTL devuelve la duración de un token de acceso
+func AccessTTL() time.Duration {
+	return accessTTL
+}
+
+// IssueToken firma un token del tipo indicado para el usuario
+func IssueToken(userID, username, role, tokenType string) (string, error) {
+	ttl := accessTTL
+	if tokenType == TokenRefresh {
+		ttl = refreshTTL
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Issuer:    "rukito-backend",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// ParseToken valida la firma, expiración y tipo de un token
+func ParseToken(tokenStr, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer("rukito-backend"))
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != tokenType {
+		return nil, errors.New("token type mismatch")
+	}
+	return claims, nil
+}
+
+// HashPassword genera el hash bcrypt de una contraseña
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword compara una contraseña con su hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/angello/rukito-backend/internal/response"
+)
+
+type contextKey string
+
+const claimsKey contextKey = "claims"
+
+// Authenticate exige un token de acceso válido en el header Authorization: Bearer <token>
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		tokenStr, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenStr == "" {
+			response.Fail(w, response.Unauthorized("Missing bearer token"))
+			return
+		}
+
+		claims, err := ParseToken(tokenStr, TokenAccess)
+		if err != nil {
+			response.Fail(w, response.Unauthorized("Invalid or expired token"))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+	})
+}
+
+// RequireRole envuelve un handler para que solo lo ejecuten usuarios con al menos ese rol.
+// Debe usarse detrás de Authenticate.
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := FromContext(r.Context())
+		if claims == nil {
+			response.Fail(w, response.Unauthorized("Missing bearer token"))
+			return
+		}
+		if !HasRole(claims.Role, role) {
+			response.Fail(w, response.Forbidden("Insufficient permissions"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// FromContext devuelve los claims del usuario autenticado, o nil
+func FromContext(ctx context.Context) *Claims {
+	claims, _ := ctx.Value(claimsKey).(*Claims)
+	return claims
+}
@@ -1,47 +1,195 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Prioridades de alerta (mismo orden que AlertPriority en la app)
+const (
+	AlertPriorityP1 = iota
+	AlertPriorityP2
+	AlertPriorityP3
+)
+
+// Tipos de alerta (mismo orden que AlertType en la app)
+const (
+	AlertTypeTemperatureCritical = iota
+	AlertTypeTemperatureWarning
+	AlertTypeDoorOpen
+	AlertTypePowerFailure
+	AlertTypeMaintenanceRequired
+	AlertTypeNormalOperation
+	AlertTypeSMSNotification
+)
 
 type ColdChamber struct {
-	ID                 string    `json:"id"`
-	Name               string    `json:"name"`
-	Content            string    `json:"content"`
-	CurrentTemperature float64   `json:"current_temperature"`
-	TargetTemperature  float64   `json:"target_temperature"`
-	CriticalThreshold  float64   `json:"critical_threshold"`
-	WarningThreshold   float64   `json:"warning_threshold"`
-	RateOfChange       float64   `json:"rate_of_change"`
-	Status             int       `json:"status"` // 0=online, 1=warning, 2=offline
-	LastUpdate         time.Time `json:"last_update"`
-	RecentTemps        []float64 `json:"recent_temperatures"`
-	IsActive           bool      `json:"is_active"`
-	Location           string    `json:"location"`
+	ID                  string    `json:"id"`
+	Name                string    `json:"name"`
+	Content             string    `json:"content"`
+	CurrentTemperature  float64   `json:"current_temperature"`
+	TargetTemperature   float64   `json:"target_temperature"`
+	CriticalThreshold   float64   `json:"critical_threshold"`
+	WarningThreshold    float64   `json:"warning_threshold"`
+	RateOfChange        float64   `json:"rate_of_change"`
+	Status              int       `json:"status"` // 0=online, 1=warning, 2=offline
+	LastUpdate          time.Time `json:"last_update"`
+	RecentTemps         []float64 `json:"recent_temperatures"`
+	IsActive            bool      `json:"is_active"`
+	Location            string    `json:"location"`
+	LocationID          string    `json:"location_id"`
+	ProductCategory     string    `json:"product_category"`      // ver ProductCategory*; vacío = se deduce del contenido
+	ForecastLeadMinutes *int      `json:"forecast_lead_minutes"` // nil = FORECAST_LEAD_MINUTES
+	Forecast            *Forecast `json:"forecast,omitempty"`    // solo en el detalle
+}
+
+// Modelos de pronóstico de temperatura
+const (
+	ForecastLinear       = "linear"
+	ForecastExponential  = "exponential" // acercamiento exponencial a una asíntota
+	ForecastStable       = "stable"
+	ForecastInsufficient = "insufficient_data"
+)
+
+// Forecast estimates when a chamber will cross its thresholds if its recent trend continues
+type Forecast struct {
+	SensorID          string    `json:"sensor_id"`
+	At                time.Time `json:"at"` // última lectura usada
+	Model             string    `json:"model"`
+	Temperature       float64   `json:"temperature"`
+	SlopePerMinute    float64   `json:"slope_per_minute"`
+	Asymptote         *float64  `json:"asymptote"` // solo en el modelo exponencial
+	WarningThreshold  float64   `json:"warning_threshold"`
+	CriticalThreshold float64   `json:"critical_threshold"`
+	MinutesToWarning  *float64  `json:"minutes_to_warning"`  // 0 = ya superado; nil = no se alcanza con la tendencia
+	MinutesToCritical *float64  `json:"minutes_to_critical"` // 0 = ya superado; nil = no se alcanza con la tendencia
+	Readings          int       `json:"readings"`
+}
+
+// HourBaseline is a chamber's usual temperature at one hour of the day, learned from history
+type HourBaseline struct {
+	Hour    int     `json:"hour"` // hora local (EXPORT_TIMEZONE)
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"std_dev"`
+	Samples int     `json:"samples"` // 0 = sin historia a esa hora
+}
+
+// AnomalyScore compares a chamber's recent readings with its learned hour-of-day baseline
+type AnomalyScore struct {
+	SensorID    string         `json:"sensor_id"`
+	At          *time.Time     `json:"at"` // última lectura puntuada; nil si no hay historia suficiente
+	Temperature *float64       `json:"temperature"`
+	Expected    *float64       `json:"expected"` // media del perfil a esa hora
+	StdDev      *float64       `json:"std_dev"`
+	ZScore      *float64       `json:"z_score"`
+	EWMA        float64        `json:"ewma"` // z-score suavizado (constante de tiempo de 30 min)
+	Limit       float64        `json:"limit"`
+	Anomalous   bool           `json:"anomalous"`
+	Explanation *string        `json:"explanation"`
+	Readings    int            `json:"readings"`
+	Baseline    []HourBaseline `json:"baseline"`
+}
+
+// Origen de un ciclo de descongelamiento
+const (
+	DefrostScheduled = "scheduled"
+	DefrostDetected  = "detected" // firma recurrente sin programación
+)
+
+// Estados de un ciclo de descongelamiento
+const (
+	DefrostInProgress = "in_progress"
+	DefrostRecovered  = "recovered"
+	DefrostProlonged  = "prolonged" // no volvió bajo el umbral de advertencia a tiempo
+)
+
+// DefrostSchedule is a recurring daily defrost of a chamber
+type DefrostSchedule struct {
+	ID              string    `json:"id"`
+	SensorID        string    `json:"sensor_id"`
+	StartTime       string    `json:"start_time"` // HH:MM, hora local (EXPORT_TIMEZONE)
+	DurationMinutes int       `json:"duration_minutes"`
+	RecoveryMinutes int       `json:"recovery_minutes"` // tiempo tolerado para volver bajo el umbral de advertencia
+	MaxTemperature  *float64  `json:"max_temperature"`  // sobre este valor se alerta igual; nil = umbral crítico + 10
+	Active          bool      `json:"active"`
+	Notes           *string   `json:"notes"`
+	RecordedBy      *string   `json:"recorded_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// DefrostCycle is a defrost recognized by the pipeline, scheduled or detected
+type DefrostCycle struct {
+	ID              string     `json:"id"`
+	SensorID        string     `json:"sensor_id"`
+	Source          string     `json:"source"` // scheduled, detected
+	ScheduleID      *string    `json:"schedule_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	HeatingUntil    time.Time  `json:"heating_until"`
+	RecoverBy       time.Time  `json:"recover_by"`
+	EndedAt         *time.Time `json:"ended_at"`
+	PeakTemperature float64    `json:"peak_temperature"`
+	Status          string     `json:"status"` // in_progress, recovered, prolonged
 }
 
+// EquipmentDay is the compressor activity of a chamber during one local day, inferred from
+// its temperature sawtooth
+type EquipmentDay struct {
+	Day             string   `json:"day"` // YYYY-MM-DD, día local (EXPORT_TIMEZONE)
+	CycleCount      int      `json:"cycle_count"`
+	DutyCycle       *float64 `json:"duty_cycle"`       // fracción del tiempo con el compresor encendido
+	PullDownRate    *float64 `json:"pull_down_rate"`   // °C/min mientras enfría
+	RecoveryMinutes *float64 `json:"recovery_minutes"` // desde el pico sobre la advertencia hasta volver bajo ella
+	Recoveries      int      `json:"recoveries"`
+	CoveredMinutes  float64  `json:"covered_minutes"` // minutos con lecturas, sin huecos
+	Readings        int      `json:"readings"`
+}
+
+// EquipmentHealth is the daily compressor activity of a chamber and its duty-cycle trend
+type EquipmentHealth struct {
+	SensorID       string         `json:"sensor_id"`
+	Days           []EquipmentDay `json:"days"`             // días cerrados, del más antiguo al más reciente
+	Today          *EquipmentDay  `json:"today"`            // día en curso, parcial
+	DutyCycleTrend *float64       `json:"duty_cycle_trend"` // variación por día; nil con menos de 5 días
+	TrendRising    bool           `json:"trend_rising"`
+}
+
+// Categorías de producto (plantillas de configuración de alertas)
+const (
+	ProductCategoryFrozenMeat = "frozen_meat"
+	ProductCategoryDairy      = "dairy"
+	ProductCategoryVegetables = "vegetables"
+	ProductCategoryGeneral    = "general"
+)
+
 type TemperatureReading struct {
 	ID           int       `json:"id"`
 	SensorID     string    `json:"sensor_id"`
 	Temperature  float64   `json:"temperature"`
+	RawTemperature *float64 `json:"raw_temperature"` // valor antes de la calibración
 	TargetTemp   float64   `json:"target_temperature"`
 	MinTemp      float64   `json:"min_temperature"`
 	MaxTemp      float64   `json:"max_temperature"`
 	RateOfChange float64   `json:"rate_of_change"`
 	Timestamp    time.Time `json:"timestamp"`
-	Status       string    `json:"status"` // CRÍTICO, ADVERTENCIA, NORMAL
+	Status       string    `json:"status"`  // CRÍTICO, ADVERTENCIA, NORMAL, SOSPECHOSO
+	Quality      string    `json:"quality"` // OK, SENTINEL, OUT_OF_RANGE, SPIKE, STUCK
 }
 
 type Alert struct {
-	ID              string     `json:"id"`
-	Title           string     `json:"title"`
-	Description     string     `json:"description"`
-	Priority        int        `json:"priority"` // 0=P1, 1=P2, 2=P3
-	Type            int        `json:"type"`     // Enum de tipos
-	SensorID        string     `json:"sensor_id"`
-	Timestamp       time.Time  `json:"timestamp"`
-	IsRead          bool       `json:"is_read"`
-	EstimatedCost   *float64   `json:"estimated_cost"`
-	AffectedContent *string    `json:"affected_content"`
-	SuggestedAction *string    `json:"suggested_action"`
+	ID                  string    `json:"id"`
+	Title               string    `json:"title"`
+	Description         string    `json:"description"`
+	Priority            int       `json:"priority"` // 0=P1, 1=P2, 2=P3
+	Type                int       `json:"type"`     // Enum de tipos
+	SensorID            string    `json:"sensor_id"`
+	Timestamp           time.Time `json:"timestamp"`
+	IsRead              bool      `json:"is_read"`
+	EstimatedCost       *float64  `json:"estimated_cost"`
+	AffectedContent     *string   `json:"affected_content"`
+	SuggestedAction     *string   `json:"suggested_action"`
+	ConfigRevision      *int      `json:"config_revision"` // revisión de alert_configs cuyos umbrales la dispararon
+	ExcursionID         *string   `json:"excursion_id"`    // excursión abierta al disparar
+	HasCorrectiveAction bool      `json:"has_corrective_action"`
 }
 
 type AlertConfig struct {
@@ -50,10 +198,322 @@ type AlertConfig struct {
 	MaxTemp               float64   `json:"max_temperature"`
 	MinTemp               float64   `json:"min_temperature"`
 	RateOfChangeThreshold float64   `json:"rate_of_change_threshold"`
-	Priority              int       `json:"priority"` // 0=low, 1=med, 2=high
+	Priority              int       `json:"priority"` // 0=P1 (más alta), 1=P2, 2=P3
 	IsEnabled             bool      `json:"is_enabled"`
 	NotificationChannels  []string  `json:"notification_channels"`
 	Recipients            []string  `json:"recipients"`
+	Revision              int       `json:"revision"`
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 }
+
+// AlertConfigRevision is an immutable snapshot of an alert configuration.
+// RolledBackFrom is set when the revision was created by restoring an older one.
+type AlertConfigRevision struct {
+	SensorID              string    `json:"sensor_id"`
+	Revision              int       `json:"revision"`
+	MaxTemp               float64   `json:"max_temperature"`
+	MinTemp               float64   `json:"min_temperature"`
+	RateOfChangeThreshold float64   `json:"rate_of_change_threshold"`
+	Priority              int       `json:"priority"`
+	IsEnabled             bool      `json:"is_enabled"`
+	NotificationChannels  []string  `json:"notification_channels"`
+	Recipients            []string  `json:"recipients"`
+	CreatedBy             *string   `json:"created_by"`
+	RolledBackFrom        *int      `json:"rolled_back_from"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// AlertConfigDiff lists the settings that differ between two revisions
+type AlertConfigDiff struct {
+	SensorID string                 `json:"sensor_id"`
+	From     int                    `json:"from"`
+	To       int                    `json:"to"`
+	Changes  map[string]FieldChange `json:"changes"`
+}
+
+type ReplayRun struct {
+	ID          string     `json:"id"`
+	Source      string     `json:"source"`
+	Speed       float64    `json:"speed"` // 0 = máxima velocidad
+	TotalPoints int        `json:"total_points"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+type SensorCalibration struct {
+	ID             string    `json:"id"`
+	SensorID       string    `json:"sensor_id"`
+	CalibratedAt   time.Time `json:"calibrated_at"`
+	ReferenceValue float64   `json:"reference_value"`
+	MeasuredValue  float64   `json:"measured_value"`
+	Offset         float64   `json:"offset"`
+	Gain           float64   `json:"gain"`
+	Technician     string    `json:"technician"`
+	Notes          *string   `json:"notes"`
+	NextDueAt      time.Time `json:"next_due_at"`
+}
+
+// Excursion es un período continuo con la cámara fuera de su rango seguro
+type Excursion struct {
+	ID                  string             `json:"id"`
+	SensorID            string             `json:"sensor_id"`
+	Direction           string             `json:"direction"` // high, low
+	Threshold           float64            `json:"threshold"` // límite cruzado
+	StartedAt           time.Time          `json:"started_at"`
+	EndedAt             *time.Time         `json:"ended_at"` // nil mientras sigue abierta
+	LastReadingAt       time.Time          `json:"last_reading_at"`
+	DurationMinutes     float64            `json:"duration_minutes"`
+	PeakTemperature     float64            `json:"peak_temperature"`
+	DegreeMinutes       float64            `json:"degree_minutes"`    // °C·min fuera del límite
+	MKT                 *float64           `json:"mkt"`               // temperatura cinética media durante la excursión
+	ActivationEnergy    *float64           `json:"activation_energy"` // kJ/mol usada para la MKT
+	ReadingCount        int                `json:"reading_count"`
+	AlertCount          int                `json:"alert_count"`
+	HasCorrectiveAction bool               `json:"has_corrective_action"`
+	Alerts              []Alert            `json:"alerts,omitempty"`             // solo en el detalle
+	CorrectiveActions   []CorrectiveAction `json:"corrective_actions,omitempty"` // solo en el detalle
+}
+
+// Destino del producto tras una acción correctiva
+const (
+	DispositionKept      = "kept"
+	DispositionMoved     = "moved"
+	DispositionDiscarded = "discarded"
+)
+
+// CorrectiveAction documenta qué se hizo ante una excursión o alerta (HACCP)
+type CorrectiveAction struct {
+	ID             string     `json:"id"`
+	SensorID       string     `json:"sensor_id"`
+	AlertID        *string    `json:"alert_id"`
+	ExcursionID    *string    `json:"excursion_id"`
+	ExcursionStart *time.Time `json:"excursion_start"`
+	Action         string     `json:"action"`
+	Disposition    string     `json:"disposition"` // kept, moved, discarded
+	PerformedBy    string     `json:"performed_by"`
+	PerformedAt    time.Time  `json:"performed_at"`
+	Notes          *string    `json:"notes"`
+	RecordedBy     *string    `json:"recorded_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ProductCategory holds the settings shared by every product of a category
+type ProductCategory struct {
+	Category         string    `json:"category"`
+	ActivationEnergy float64   `json:"activation_energy"` // kJ/mol, para la temperatura cinética media
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Product is a catalog item that can be stored in a chamber
+type Product struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Category   string       `json:"category"` // ver ProductCategory*
+	PricePerKg float64      `json:"price_per_kg"`
+	Rules      ProductRules `json:"rules"` // reglas efectivas (propias o de la categoría)
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// ProductRules describe how much a product tolerates outside its safe range
+type ProductRules struct {
+	SafeMin            *float64 `json:"safe_min_temperature"` // nil = sin límite inferior
+	SafeMax            float64  `json:"safe_max_temperature"`
+	MaxExposureMinutes float64  `json:"max_exposure_minutes"` // exposición acumulada tolerada fuera del rango
+	DegradationRate    float64  `json:"degradation_rate"`     // fracción de vida útil perdida por °C·h fuera del rango
+	Source             string   `json:"source"`               // product (tiene valores propios) o category
+}
+
+// Tipos de movimiento de stock
+const (
+	StockIn  = "in"
+	StockOut = "out"
+)
+
+// StockMovement is an entry or exit of product in a chamber
+type StockMovement struct {
+	ID          string    `json:"id"`
+	SensorID    string    `json:"sensor_id"`
+	ProductID   string    `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	LotID       *string   `json:"lot_id"`
+	Type        string    `json:"type"`        // in, out
+	QuantityKg  float64   `json:"quantity_kg"` // siempre positiva; el tipo da el sentido
+	MovedAt     time.Time `json:"moved_at"`
+	Notes       *string   `json:"notes"`
+	RecordedBy  *string   `json:"recorded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Estados de un lote
+const (
+	LotAvailable   = "available"
+	LotQuarantined = "quarantined" // bloqueado hasta liberarlo o descartarlo
+	LotReleased    = "released"    // liberado tras una cuarentena; se puede usar
+	LotDiscarded   = "discarded"
+)
+
+// Lot is a batch of product received into a chamber
+type Lot struct {
+	ID                    string     `json:"id"`
+	SensorID              string     `json:"sensor_id"`
+	ProductID             string     `json:"product_id"`
+	ProductName           string     `json:"product_name"`
+	LotCode               *string    `json:"lot_code"` // código del proveedor
+	Supplier              string     `json:"supplier"`
+	ReceivedAt            time.Time  `json:"received_at"`
+	QuantityKg            float64    `json:"quantity_kg"`  // recibido
+	RemainingKg           float64    `json:"remaining_kg"` // según sus movimientos de stock
+	Status                string     `json:"status"`       // available, quarantined, released, discarded
+	QuarantinedAt         *time.Time `json:"quarantined_at"`
+	QuarantineExcursionID *string    `json:"quarantine_excursion_id"`
+	QuarantineReason      *string    `json:"quarantine_reason"`
+	ResolvedAt            *time.Time `json:"resolved_at"`
+	ResolvedBy            *string    `json:"resolved_by"`
+	Resolution            *string    `json:"resolution"` // justificación de la liberación o el descarte
+	Notes                 *string    `json:"notes"`
+	RecordedBy            *string    `json:"recorded_by"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// LotHistoryPoint aggregates the chamber's readings over one interval of a lot's stay
+type LotHistoryPoint struct {
+	At       time.Time `json:"at"`
+	Min      float64   `json:"min"`
+	Avg      float64   `json:"avg"`
+	Max      float64   `json:"max"`
+	Readings int       `json:"readings"`
+}
+
+// LotTraceability is the temperature history of a lot while it was in its chamber
+type LotTraceability struct {
+	Lot        Lot               `json:"lot"`
+	Rules      ProductRules      `json:"rules"`
+	From       time.Time         `json:"from"`
+	Until      time.Time         `json:"until"` // descarte, agotamiento o ahora
+	Readings   int               `json:"readings"`
+	Min        *float64          `json:"min"`
+	Avg        *float64          `json:"avg"`
+	Max        *float64          `json:"max"`
+	History    []LotHistoryPoint `json:"history"`
+	Excursions []Excursion       `json:"excursions"`
+	Movements  []StockMovement   `json:"movements"`
+}
+
+// StockItem is the quantity of one product in a chamber and its value
+type StockItem struct {
+	ProductID  string  `json:"product_id"`
+	Name       string  `json:"name"`
+	Category   string  `json:"category"`
+	QuantityKg float64 `json:"quantity_kg"`
+	PricePerKg float64 `json:"price_per_kg"`
+	Value      float64 `json:"value"`
+}
+
+// ChamberInventory is the contents of a chamber at a point in time
+type ChamberInventory struct {
+	SensorID   string      `json:"sensor_id"`
+	At         time.Time   `json:"at"`
+	Items      []StockItem `json:"items"`
+	TotalKg    float64     `json:"total_kg"`
+	TotalValue float64     `json:"total_value"`
+}
+
+// ProductRisk is the spoilage assessment of one product in a chamber
+type ProductRisk struct {
+	ProductID       *string      `json:"product_id"` // nil = contenido declarado de una cámara sin inventario
+	Name            string       `json:"name"`
+	Category        string       `json:"category"`
+	QuantityKg      float64      `json:"quantity_kg"`
+	Value           float64      `json:"value"`
+	Rules           ProductRules `json:"rules"`
+	ExposureMinutes float64      `json:"exposure_minutes"` // tiempo fuera del rango seguro del producto
+	DegreeHours     float64      `json:"degree_hours"`     // °C·h fuera del rango seguro
+	RiskScore       float64      `json:"risk_score"`       // 0 = intacto, 1 = vida útil agotada
+	Disposition     string       `json:"disposition"`      // kept, moved, discarded
+}
+
+// SpoilageAssessment evaluates a chamber's contents against their product rules
+type SpoilageAssessment struct {
+	SensorID        string        `json:"sensor_id"`
+	WindowStart     time.Time     `json:"window_start"`
+	At              time.Time     `json:"at"`
+	Products        []ProductRisk `json:"products"`
+	RiskScore       float64       `json:"risk_score"`    // el mayor de los productos
+	Disposition     string        `json:"disposition"`   // la más severa de los productos
+	ValueAtRisk     float64       `json:"value_at_risk"` // Σ valor × riesgo
+	SuggestedAction string        `json:"suggested_action"`
+}
+
+type User struct {
+	ID           string     `json:"id"`
+	Username     string     `json:"username"`
+	FullName     string     `json:"full_name"`
+	Role         string     `json:"role"` // owner, manager, staff, readonly
+	LocationIDs  []string   `json:"location_ids"`
+	IsActive     bool       `json:"is_active"`
+	PasswordHash string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+}
+
+type Device struct {
+	ID           string     `json:"id"`
+	ChamberID    string     `json:"chamber_id"` // única cámara para la que el dispositivo puede reportar
+	Name         string     `json:"name"`
+	KeyRotatedAt time.Time  `json:"key_rotated_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// DeviceCredentials se devuelve solo al crear o rotar: la API key no vuelve a mostrarse
+type DeviceCredentials struct {
+	Device
+	APIKey string `json:"api_key"`
+}
+
+type DeviceRejection struct {
+	ID         int       `json:"id"`
+	DeviceID   string    `json:"device_id"`
+	SensorID   string    `json:"sensor_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Location struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Name           string    `json:"name"`
+	Address        *string   `json:"address"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FieldChange es el valor anterior y nuevo de un campo modificado
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type AuditEntry struct {
+	ID            int                    `json:"id"`
+	ActorID       *string                `json:"actor_id"` // nil para acciones sin usuario (ej. login fallido)
+	ActorUsername string                 `json:"actor_username"`
+	Action        string                 `json:"action"`
+	EntityType    string                 `json:"entity_type"`
+	EntityID      string                 `json:"entity_id"`
+	LocationID    *string                `json:"location_id"`
+	Before        json.RawMessage        `json:"before"`
+	After         json.RawMessage        `json:"after"`
+	Changes       map[string]FieldChange `json:"changes"`
+	RemoteAddr    string                 `json:"remote_addr"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
@@ -0,0 +1,186 @@
+// Package response writes the JSON bodies shared by every API handler:
+// successful payloads and the {error, details} error shape of the API specification.
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Códigos de error estables; los clientes deben usarlos en lugar del mensaje
+const (
+	CodeBadRequest   = "bad_request"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeUnavailable  = "service_unavailable"
+	CodeBadGateway   = "bad_gateway"
+	CodeInternal     = "internal_error"
+)
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an API error mapped to an HTTP status. Details are shown to the
+// client, so they must never contain internal errors (SQL, stack traces).
+type Error struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"error"`
+	Details string       `json:"details,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+
+	cause error // error original, solo para el log
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Code + ": " + e.cause.Error()
+	}
+	return e.Code + ": " + e.Details
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// BadRequest reports a malformed request (body, path or query parameters)
+func BadRequest(details string) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "Petición inválida", Details: details}
+}
+
+// Validation reports every invalid field of a well-formed request
+func Validation(fields []FieldError) *Error {
+	e := &Error{Status: http.StatusBadRequest, Code: CodeValidation, Message: "Datos inválidos", Fields: fields}
+	if len(fields) > 0 {
+		e.Details = fields[0].Field + ": " + fields[0].Message
+	}
+	return e
+}
+
+func Unauthorized(details string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "No autenticado", Details: details}
+}
+
+func Forbidden(details string) *Error {
+	return &Error{Status: http.StatusForbidden, Code: CodeForbidden, Message: "Permisos insuficientes", Details: details}
+}
+
+func NotFound(details string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Recurso no encontrado", Details: details}
+}
+
+func Conflict(details string) *Error {
+	return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "Conflicto con el estado actual", Details: details}
+}
+
+func Unavailable(details string) *Error {
+	return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: "Servicio no disponible", Details: details}
+}
+
+func BadGateway(details string, cause error) *Error {
+	return &Error{Status: http.StatusBadGateway, Code: CodeBadGateway, Message: "Error en servicio externo", Details: details, cause: cause}
+}
+
+// Internal hides err from the client; it is only logged
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Error interno del servidor", cause: err}
+}
+
+// Fail writes err as a JSON error body. Errors that are not *Error are
+// treated as internal errors.
+func Fail(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		apiErr = Internal(err)
+	}
+	if apiErr.cause != nil {
+		fmt.Printf("Error %d (%s): %v\n", apiErr.Status, apiErr.Code, apiErr.cause)
+	}
+	JSON(w, apiErr.Status, apiErr)
+}
+
+// JSON writes v with the given status. Nil slices, at any depth (struct fields,
+// pointers, maps, interfaces), are written as [] so clients always receive an
+// array where the API specification documents a list.
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	if v != nil {
+		v = emptySlices(reflect.ValueOf(v)).Interface()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// emptySlices devuelve una copia de v en la que cada slice nil es un slice vacío.
+// v no se modifica; los campos no exportados (que no se serializan) se copian tal cual
+// y []byte se respeta, porque JSON lo codifica como string.
+func emptySlices(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		if v.IsNil() {
+			return reflect.MakeSlice(v.Type(), 0, 0)
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(emptySlices(v.Index(i)))
+		}
+		return out
+
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(emptySlices(v.Index(i)))
+		}
+		return out
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(emptySlices(v.Elem()))
+		return out
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(emptySlices(v.Elem()))
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), emptySlices(iter.Value()))
+		}
+		return out
+
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(emptySlices(v.Field(i)))
+			}
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,59 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type link struct {
+	IDs []string `json:"ids"`
+}
+
+type payload struct {
+	Name    string                 `json:"name"`
+	Tags    []string               `json:"tags"`
+	Links   []link                 `json:"links"`
+	Parent  *link                  `json:"parent"`
+	Changes map[string]interface{} `json:"changes"`
+	Raw     []byte                 `json:"raw"`
+	Hidden  []string               `json:"hidden,omitempty"`
+}
+
+func TestJSONEmptySlices(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"nil top-level slice", []string(nil), `[]`},
+		{"nil value", nil, `null`},
+		{"nested struct fields", payload{Name: "a"},
+			`{"name":"a","tags":[],"links":[],"parent":null,"changes":null,"raw":null}`},
+		{"slices inside slices and pointers", payload{Links: []link{{}}, Parent: &link{}},
+			`{"name":"","tags":[],"links":[{"ids":[]}],"parent":{"ids":[]},"changes":null,"raw":null}`},
+		{"map values", map[string]interface{}{"before": []string(nil), "after": link{}},
+			`{"after":{"ids":[]},"before":[]}`},
+		{"omitempty stays omitted", payload{Hidden: nil, Changes: map[string]interface{}{}},
+			`{"name":"","tags":[],"links":[],"parent":null,"changes":{},"raw":null}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			JSON(rec, http.StatusOK, tt.in)
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("JSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONDoesNotModifyInput(t *testing.T) {
+	in := &payload{Links: []link{{}}}
+	JSON(httptest.NewRecorder(), http.StatusOK, in)
+	if in.Tags != nil || in.Links[0].IDs != nil {
+		t.Errorf("JSON() modified its input: %+v", in)
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// Parámetros de la detección estadística de anomalías
+const (
+	anomalyHistory      = 14 * 24 * time.Hour // historia sobre la que se aprende el perfil por hora del día
+	anomalyProfileEvery = time.Hour           // cada cuánto (en tiempo de las lecturas) se reaprende el perfil
+	anomalyMinSamples   = 60                  // lecturas mínimas de una hora del día para confiar en su perfil
+	anomalyMinStdDev    = 0.3                 // °C; evita z-scores enormes en horas casi constantes
+	anomalyTimeConstant = 30 * time.Minute    // memoria del EWMA, mayor que un ciclo del compresor
+	anomalyLimit        = 1.5                 // σ del perfil que el EWMA debe superar
+	anomalyPersist      = 15 * time.Minute    // tiempo fuera del límite antes de avisar
+	anomalyAlertEvery   = time.Hour
+)
+
+// hourProfile es el perfil estacional de una cámara: media y desviación por hora local del día
+type hourProfile struct {
+	hours    [24]models.HourBaseline
+	loadedAt time.Time // instante (de las lecturas) para el que se aprendió
+}
+
+// baseline devuelve el perfil de la hora de at, si tiene historia suficiente
+func (p *hourProfile) baseline(at time.Time) (models.HourBaseline, bool) {
+	b := p.hours[at.In(ReportTimezone()).Hour()]
+	return b, b.Samples >= anomalyMinSamples
+}
+
+// learnProfile aprende el perfil de las anomalyHistory previas a at, sin las lecturas que
+// cayeron dentro de una excursión (una falla pasada no debe volverse "lo habitual").
+// La agregación es por día y hora UTC y se combina por hora local en Go, para que el
+// cambio de horario no mezcle horas.
+func learnProfile(sensorID string, at time.Time) (*hourProfile, error) {
+	rows, err := db.DB.Query(`
+		SELECT DATE(r.timestamp), HOUR(r.timestamp), COUNT(*), SUM(r.temperature), SUM(r.temperature * r.temperature)
+		FROM temperature_readings r
+		WHERE r.sensor_id = ? AND r.quality = 'OK' AND r.timestamp >= ? AND r.timestamp < ?
+			AND NOT EXISTS (
+				SELECT 1 FROM excursions e
+				WHERE e.sensor_id = r.sensor_id AND r.timestamp >= e.started_at AND (e.ended_at IS NULL OR r.timestamp <= e.ended_at)
+			)
+		GROUP BY DATE(r.timestamp), HOUR(r.timestamp)`, sensorID, at.Add(-anomalyHistory), at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tz := ReportTimezone()
+	var counts, sums, squares [24]float64
+	for rows.Next() {
+		var day time.Time
+		var hour int
+		var count, sum, square float64
+		if err := rows.Scan(&day, &hour, &count, &sum, &square); err != nil {
+			return nil, err
+		}
+		local := day.Add(time.Duration(hour) * time.Hour).In(tz).Hour()
+		counts[local] += count
+		sums[local] += sum
+		squares[local] += square
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p := &hourProfile{loadedAt: at}
+	for h := range p.hours {
+		p.hours[h].Hour = h
+		if counts[h] == 0 {
+			continue
+		}
+		mean := sums[h] / counts[h]
+		variance := math.Max(squares[h]/counts[h]-mean*mean, 0)
+		p.hours[h].Mean = math.Round(mean*100) / 100
+		p.hours[h].StdDev = math.Round(math.Sqrt(variance)*100) / 100
+		p.hours[h].Samples = int(counts[h])
+	}
+	return p, nil
+}
+
+// anomalyState es el EWMA del z-score de una cámara. El factor de suavizado depende del
+// intervalo entre lecturas, así la memoria es anomalyTimeConstant aunque cambie la frecuencia.
+type anomalyState struct {
+	ewma     float64
+	started  time.Time // primera lectura puntuada desde el último reinicio
+	last     time.Time
+	outside  time.Time // desde cuándo el EWMA está fuera del límite; cero si está dentro
+	lastTemp float64
+	lastZ    float64
+	expected models.HourBaseline
+}
+
+// score incorpora una lectura; false si la hora no tiene perfil suficiente
+func (s *anomalyState) score(at time.Time, temp float64, profile *hourProfile) bool {
+	base, ok := profile.baseline(at)
+	if !ok {
+		return false
+	}
+	z := (temp - base.Mean) / math.Max(base.StdDev, anomalyMinStdDev)
+
+	// Tras un hueco largo el suavizado anterior ya no describe la cámara
+	gap := at.Sub(s.last)
+	if s.last.IsZero() || gap > anomalyTimeConstant {
+		s.ewma = z
+		s.started = at
+		s.outside = time.Time{}
+	} else {
+		alpha := 1 - math.Exp(-gap.Minutes()/anomalyTimeConstant.Minutes())
+		s.ewma += alpha * (z - s.ewma)
+	}
+	s.last = at
+	s.lastTemp = temp
+	s.lastZ = z
+	s.expected = base
+
+	// Hasta cubrir una constante de tiempo el EWMA depende demasiado de la primera lectura
+	if at.Sub(s.started) >= anomalyTimeConstant && math.Abs(s.ewma) > anomalyLimit {
+		if s.outside.IsZero() {
+			s.outside = at
+		}
+	} else {
+		s.outside = time.Time{}
+	}
+	return true
+}
+
+// anomalous indica si el EWMA lleva al menos anomalyPersist fuera del límite
+func (s *anomalyState) anomalous() bool {
+	return !s.outside.IsZero() && s.last.Sub(s.outside) >= anomalyPersist
+}
+
+// explanation describe la anomalía en términos operativos
+func (s *anomalyState) explanation() string {
+	direction, causes := "por encima", "un compresor que tarda más en recuperar tras las aperturas, una puerta mal cerrada o carga ingresada caliente"
+	if s.ewma < 0 {
+		direction, causes = "por debajo", "un termostato desajustado, hielo en el evaporador o una sonda desplazada"
+	}
+	return fmt.Sprintf("Con %.1f°C, la cámara se mantiene %s de lo habitual a las %02d:00 (%.1f ± %.1f°C) desde hace %.0f min "+
+		"(promedio suavizado de %+.1fσ, límite %.1fσ). Puede indicar %s",
+		s.lastTemp, direction, s.expected.Hour, s.expected.Mean, s.expected.StdDev,
+		s.last.Sub(s.outside).Minutes(), s.ewma, anomalyLimit, causes)
+}
+
+// ChamberAnomaly puntúa las lecturas válidas recientes de una cámara contra su perfil.
+// Devuelve sql.ErrNoRows si la cámara no existe.
+func ChamberAnomaly(sensorID string) (models.AnomalyScore, error) {
+	result := models.AnomalyScore{SensorID: sensorID, Limit: anomalyLimit}
+
+	var exists bool
+	if err := db.DB.QueryRow(`SELECT TRUE FROM chambers WHERE id = ?`, sensorID).Scan(&exists); err != nil {
+		return result, err
+	}
+
+	// Igual que el pronóstico, se ancla en la última lectura y no en el reloj
+	var lastAt sql.NullTime
+	err := db.DB.QueryRow(`SELECT MAX(timestamp) FROM temperature_readings WHERE sensor_id = ? AND quality = 'OK'`, sensorID).Scan(&lastAt)
+	if err != nil {
+		return result, err
+	}
+	at := time.Now()
+	if lastAt.Valid {
+		at = lastAt.Time
+	}
+
+	profile, err := learnProfile(sensorID, at)
+	if err != nil {
+		return result, err
+	}
+	result.Baseline = profile.hours[:]
+	if !lastAt.Valid {
+		return result, nil
+	}
+
+	// Se recorren unas constantes de tiempo para que el EWMA llegue a régimen
+	points, err := liveSink.riskPoints(sensorID, at.Add(-3*anomalyTimeConstant), at)
+	if err != nil {
+		return result, err
+	}
+	var state anomalyState
+	for _, p := range points {
+		if state.score(p.at, p.temp, profile) {
+			result.Readings++
+		}
+	}
+	if result.Readings == 0 {
+		return result, nil
+	}
+
+	result.At = &state.last
+	result.Temperature = &state.lastTemp
+	result.Expected = &state.expected.Mean
+	result.StdDev = &state.expected.StdDev
+	z := math.Round(state.lastZ*100) / 100
+	result.ZScore = &z
+	result.EWMA = math.Round(state.ewma*100) / 100
+	result.Anomalous = state.anomalous()
+	if result.Anomalous {
+		explanation := state.explanation()
+		result.Explanation = &explanation
+	}
+	return result, nil
+}
+
+// anomalyDetector puntúa cada lectura del pipeline contra el perfil de su cámara y avisa
+// (maintenanceRequired) cuando el comportamiento se aparta de lo habitual sin cruzar umbrales
+type anomalyDetector struct {
+	bands     *bandCache
+	profiles  map[string]*hourProfile
+	states    map[string]*anomalyState
+	lastAlert map[string]time.Time
+}
+
+func newAnomalyDetector(bands *bandCache) *anomalyDetector {
+	return &anomalyDetector{
+		bands:     bands,
+		profiles:  make(map[string]*hourProfile),
+		states:    make(map[string]*anomalyState),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// profile devuelve el perfil vigente para la lectura, reaprendiéndolo cada anomalyProfileEvery
+func (a *anomalyDetector) profile(dp DataPoint) *hourProfile {
+	p, ok := a.profiles[dp.SensorID]
+	if ok {
+		age := dp.Timestamp.Sub(p.loadedAt)
+		if age >= 0 && age < anomalyProfileEvery {
+			return p
+		}
+	}
+
+	fresh, err := learnProfile(dp.SensorID, dp.Timestamp)
+	if err != nil {
+		fmt.Printf("Error aprendiendo el perfil de %s: %v\n", dp.SensorID, err)
+		if ok {
+			return p
+		}
+		// Se reintenta en el próximo intervalo y no en cada lectura
+		fresh = &hourProfile{loadedAt: dp.Timestamp}
+	}
+	a.profiles[dp.SensorID] = fresh
+	return fresh
+}
+
+// alertDue indica si corresponde avisar de la anomalía de una cámara en at (como máximo una vez
+// cada anomalyAlertEvery) y en ese caso registra el aviso
+func (a *anomalyDetector) alertDue(sensorID string, at time.Time) bool {
+	if last, ok := a.lastAlert[sensorID]; ok && at.Sub(last) < anomalyAlertEvery {
+		return false
+	}
+	a.lastAlert[sensorID] = at
+	return true
+}
+
+// observe procesa una lectura válida (ya calibrada y en orden)
+func (a *anomalyDetector) observe(dp DataPoint, sink dataSink) {
+	band, ok := a.bands.get(dp.SensorID)
+	if !ok {
+		return
+	}
+
+	state, ok := a.states[dp.SensorID]
+	if !ok {
+		state = &anomalyState{}
+		a.states[dp.SensorID] = state
+	}
+	if !state.score(dp.Timestamp, dp.Temperature, a.profile(dp)) || !state.anomalous() {
+		return
+	}
+
+	// Fuera del rango seguro ya avisan las alertas de umbral y las excursiones
+	if dp.Temperature > band.high || (band.low != nil && dp.Temperature < *band.low) {
+		return
+	}
+
+	if !a.alertDue(dp.SensorID, dp.Timestamp) {
+		return
+	}
+	raiseAlert(dp, sink, models.AlertPriorityP3, models.AlertTypeMaintenanceRequired,
+		fmt.Sprintf("COMPORTAMIENTO ANÓMALO: %s", dp.SensorID), state.explanation(), alertImpact{}, band.revision)
+}
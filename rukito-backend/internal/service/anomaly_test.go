@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// flatProfile es un perfil de -20 ± 0.5°C a toda hora
+func flatProfile() *hourProfile {
+	p := &hourProfile{}
+	for h := range p.hours {
+		p.hours[h] = models.HourBaseline{Hour: h, Mean: -20, StdDev: 0.5, Samples: anomalyMinSamples}
+	}
+	return p
+}
+
+func TestAnomalyStepChange(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	profile := flatProfile()
+
+	// Una hora en -20°C y luego un escalón a -18°C (z = 4), una lectura por minuto.
+	// Tras k lecturas del escalón el EWMA vale 4·(1 - e^(-k/30)): supera 1.5σ en k = 15
+	// (minuto 74) y la anomalía se confirma anomalyPersist después (minuto 89). En la hora
+	// siguiente sigue anómala, pero se avisa una sola vez.
+	const stepAt, outsideAt, alertAt = 60, 74, 89
+
+	var state anomalyState
+	detector := newAnomalyDetector(nil)
+	var alerts []int
+	for minute := 0; minute < alertAt+int(anomalyAlertEvery.Minutes()); minute++ {
+		temp := -20.0
+		if minute >= stepAt {
+			temp = -18
+		}
+		at := start.Add(time.Duration(minute) * time.Minute)
+		if !state.score(at, temp, profile) {
+			t.Fatalf("minute %d: score() = false with a full profile", minute)
+		}
+
+		if outside := !state.outside.IsZero(); outside != (minute >= outsideAt) {
+			t.Errorf("minute %d: outside the limit = %v (EWMA %.3f), want %v", minute, outside, state.ewma, minute >= outsideAt)
+		}
+		if state.anomalous() != (minute >= alertAt) {
+			t.Errorf("minute %d: anomalous() = %v, want %v", minute, state.anomalous(), minute >= alertAt)
+		}
+		if state.anomalous() && detector.alertDue("CF-1", at) {
+			alerts = append(alerts, minute)
+		}
+	}
+
+	if len(alerts) != 1 || alerts[0] != alertAt {
+		t.Errorf("alerts at minutes %v, want exactly one at %d", alerts, alertAt)
+	}
+}
+
+func TestAnomalyState(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("no profile", func(t *testing.T) {
+		var state anomalyState
+		if state.score(start, -20, &hourProfile{}) {
+			t.Error("score() = true for an hour without history")
+		}
+	})
+
+	t.Run("warm-up", func(t *testing.T) {
+		// Fuera del límite desde la primera lectura, pero el EWMA no cuenta hasta cubrir anomalyTimeConstant
+		var state anomalyState
+		for minute := 0; minute < 30; minute++ {
+			state.score(start.Add(time.Duration(minute)*time.Minute), -15, flatProfile())
+			if !state.outside.IsZero() {
+				t.Fatalf("minute %d: outside the limit during the warm-up", minute)
+			}
+		}
+	})
+
+	t.Run("gap restarts", func(t *testing.T) {
+		var state anomalyState
+		profile := flatProfile()
+		for minute := 0; minute <= 60; minute++ {
+			state.score(start.Add(time.Duration(minute)*time.Minute), -15, profile)
+		}
+		if !state.anomalous() {
+			t.Fatal("anomalous() = false after an hour at z = 10")
+		}
+		// Tras un hueco mayor que anomalyTimeConstant se parte de cero
+		state.score(start.Add(2*time.Hour), -15, profile)
+		if state.anomalous() || !state.outside.IsZero() {
+			t.Error("a gap did not restart the EWMA")
+		}
+	})
+
+	t.Run("below the profile", func(t *testing.T) {
+		var state anomalyState
+		profile := flatProfile()
+		for minute := 0; minute <= 60; minute++ {
+			state.score(start.Add(time.Duration(minute)*time.Minute), -23, profile)
+		}
+		if !state.anomalous() || state.ewma >= 0 {
+			t.Errorf("anomalous() = %v with EWMA %.2f, want an anomaly below the profile", state.anomalous(), state.ewma)
+		}
+	})
+}
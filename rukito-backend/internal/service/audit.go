@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// Acciones registradas en audit_log
+const (
+	AuditConfigUpdate     = "config.update"
+	AuditConfigRollback   = "config.rollback"
+	AuditConfigDefault    = "config.default"
+	AuditAlertAck         = "alert.acknowledge"
+	AuditAlertResolve     = "alert.resolve"
+	AuditChamberCreate    = "chamber.create"
+	AuditChamberUpdate    = "chamber.update"
+	AuditLogin            = "auth.login"
+	AuditLoginFailed      = "auth.login_failed"
+	AuditUserCreate       = "user.create"
+	AuditUserLocations    = "user.locations"
+	AuditCalibration      = "calibration.create"
+	AuditDeviceCreate     = "device.create"
+	AuditDeviceRotateKey  = "device.rotate_key"
+	AuditDeviceRevoke     = "device.revoke"
+	AuditCorrectiveAction = "corrective_action.create"
+	AuditProductCreate    = "product.create"
+	AuditProductUpdate    = "product.update"
+	AuditCategoryUpdate   = "product_category.update"
+	AuditStockMovement    = "stock.movement"
+	AuditLotCreate        = "lot.create"
+	AuditLotQuarantine    = "lot.quarantine"
+	AuditLotRelease       = "lot.release"
+	AuditLotDiscard       = "lot.discard"
+	AuditDefrostCreate    = "defrost_schedule.create"
+	AuditDefrostUpdate    = "defrost_schedule.update"
+)
+
+// RecordAudit agrega una entrada al log de auditoría (solo inserción, nunca se modifica).
+// before/after pueden ser cualquier valor serializable; los cambios se calculan
+// comparando sus campos de primer nivel.
+func RecordAudit(entry models.AuditEntry, before, after interface{}) {
+	entry.Before = toRawJSON(before)
+	entry.After = toRawJSON(after)
+	entry.Changes = DiffFields(before, after)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	changesJSON, _ := json.Marshal(entry.Changes)
+
+	query := `
+		INSERT INTO audit_log (actor_id, actor_username, action, entity_type, entity_id, location_id, before_data, after_data, changes, remote_addr, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.DB.Exec(query, entry.ActorID, entry.ActorUsername, entry.Action, entry.EntityType, entry.EntityID, entry.LocationID,
+		nullableJSON(entry.Before), nullableJSON(entry.After), changesJSON, entry.RemoteAddr, entry.CreatedAt)
+	if err != nil {
+		fmt.Printf("Error registrando auditoría (%s %s): %v\n", entry.Action, entry.EntityID, err)
+	}
+}
+
+func toRawJSON(v interface{}) json.RawMessage {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func nullableJSON(data json.RawMessage) interface{} {
+	if data == nil {
+		return nil
+	}
+	return []byte(data)
+}
+
+// DiffFields compara los campos JSON de primer nivel de before y after
+func DiffFields(before, after interface{}) map[string]models.FieldChange {
+	b := toFieldMap(before)
+	a := toFieldMap(after)
+
+	changes := make(map[string]models.FieldChange)
+	for k, av := range a {
+		bv, ok := b[k]
+		if !ok || !reflect.DeepEqual(av, bv) {
+			changes[k] = models.FieldChange{From: bv, To: av}
+		}
+	}
+	for k, bv := range b {
+		if _, ok := a[k]; !ok {
+			changes[k] = models.FieldChange{From: bv, To: nil}
+		}
+	}
+	return changes
+}
+
+func toFieldMap(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	data := toRawJSON(v)
+	if data == nil {
+		return m
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return map[string]interface{}{"value": v}
+	}
+	return m
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// calibration es una corrección de una sonda desde calibratedAt: corregido = crudo*gain + offset
+type calibration struct {
+	calibratedAt time.Time
+	offset       float64
+	gain         float64
+}
+
+// calibrator cachea el historial de calibraciones de cada sensor (en orden) y lo refresca
+// periódicamente para que una calibración nueva aplique sin reiniciar el servidor
+type calibrator struct {
+	history  map[string][]calibration
+	loadedAt time.Time
+	ttl      time.Duration
+}
+
+func newCalibrator() *calibrator {
+	return &calibrator{ttl: time.Minute}
+}
+
+func (c *calibrator) refresh() {
+	query := `
+		SELECT sensor_id, calibrated_at, offset, gain
+		FROM sensor_calibrations
+		ORDER BY sensor_id, calibrated_at`
+
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		fmt.Printf("Error cargando calibraciones: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	history := make(map[string][]calibration)
+	for rows.Next() {
+		var id string
+		var cal calibration
+		if err := rows.Scan(&id, &cal.calibratedAt, &cal.offset, &cal.gain); err != nil {
+			fmt.Printf("Error cargando calibraciones: %v\n", err)
+			return
+		}
+		history[id] = append(history[id], cal)
+	}
+
+	c.history = history
+	c.loadedAt = time.Now()
+}
+
+// apply devuelve la temperatura corregida con la calibración vigente en at, así un replay de
+// lecturas antiguas usa la corrección de entonces. Sin calibración previa devuelve el valor crudo.
+func (c *calibrator) apply(sensorID string, raw float64, at time.Time) float64 {
+	if c.history == nil || time.Since(c.loadedAt) > c.ttl {
+		c.refresh()
+	}
+
+	history := c.history[sensorID]
+	i := sort.Search(len(history), func(i int) bool { return history[i].calibratedAt.After(at) })
+	if i == 0 {
+		return raw
+	}
+	cal := history[i-1]
+	return raw*cal.gain + cal.offset
+}
+
+// CalibrationInterval es el tiempo máximo entre calibraciones (CALIBRATION_INTERVAL_DAYS, default 90 = trimestral)
+func CalibrationInterval() time.Duration {
+	days := 90
+	if d, err := strconv.Atoi(os.Getenv("CALIBRATION_INTERVAL_DAYS")); err == nil && d > 0 {
+		days = d
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartCalibrationMonitor revisa cada hora qué sondas tienen la calibración vencida
+// y genera un recordatorio (maintenanceRequired) como máximo una vez al día por sensor
+func StartCalibrationMonitor() {
+	go func() {
+		lastReminder := make(map[string]time.Time)
+
+		checkOverdueCalibrations(lastReminder)
+		ticker := time.NewTicker(time.Hour)
+		for range ticker.C {
+			checkOverdueCalibrations(lastReminder)
+		}
+	}()
+}
+
+// checkOverdueCalibrations avisa de las sondas cuya última calibración venció: en su
+// next_due_at si se registró, o CalibrationInterval después de calibrarse
+func checkOverdueCalibrations(lastReminder map[string]time.Time) {
+	query := `
+		SELECT c.id, MAX(sc.calibrated_at), MAX(sc.next_due_at)
+		FROM chambers c
+		LEFT JOIN sensor_calibrations sc ON sc.sensor_id = c.id
+			AND sc.calibrated_at = (SELECT MAX(calibrated_at) FROM sensor_calibrations WHERE sensor_id = c.id)
+		WHERE c.is_active = TRUE
+		GROUP BY c.id`
+
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		fmt.Printf("Error revisando calibraciones: %v\n", err)
+		return
+	}
+
+	type overdue struct {
+		sensorID string
+		desc     string
+	}
+	var pending []overdue
+
+	now := time.Now()
+	interval := CalibrationInterval()
+	for rows.Next() {
+		var sensorID string
+		var lastAt, nextDueAt sql.NullTime
+		if err := rows.Scan(&sensorID, &lastAt, &nextDueAt); err != nil {
+			fmt.Printf("Error revisando calibraciones: %v\n", err)
+			break
+		}
+
+		if last, ok := lastReminder[sensorID]; ok && now.Sub(last) < 24*time.Hour {
+			continue
+		}
+
+		if !lastAt.Valid {
+			pending = append(pending, overdue{sensorID, "La sonda no tiene ninguna calibración registrada"})
+			continue
+		}
+		due := lastAt.Time.Add(interval)
+		if nextDueAt.Valid {
+			due = nextDueAt.Time
+		}
+		if now.After(due) {
+			pending = append(pending, overdue{sensorID, fmt.Sprintf("Última calibración el %s; vencida desde el %s",
+				lastAt.Time.Format("2006-01-02"), due.Format("2006-01-02"))})
+		}
+	}
+	rows.Close()
+
+	for _, o := range pending {
+		dp := DataPoint{SensorID: o.sensorID, Timestamp: now}
+		title := fmt.Sprintf("CALIBRACIÓN VENCIDA: %s", o.sensorID)
+		raiseAlert(dp, liveSink, models.AlertPriorityP3, models.AlertTypeMaintenanceRequired, title, o.desc, alertImpact{}, nil)
+		lastReminder[o.sensorID] = now
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCalibratorApply(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 8, 0, 0, 0, time.UTC) }
+
+	c := newCalibrator()
+	c.history = map[string][]calibration{
+		"CF-1": {
+			{calibratedAt: day(time.January, 10), offset: 0.5, gain: 1},
+			{calibratedAt: day(time.February, 10), offset: -1, gain: 1.02},
+		},
+	}
+	c.loadedAt = time.Now() // historial precargado: no se consulta la base
+
+	// En orden mezclado, como llegan un replay o lecturas atrasadas: cada una usa la calibración
+	// vigente en su propio timestamp y no la más reciente
+	tests := []struct {
+		name     string
+		sensorID string
+		at       time.Time
+		raw      float64
+		want     float64
+	}{
+		{"after both", "CF-1", day(time.March, 1), -20, -20*1.02 - 1},
+		{"before the first", "CF-1", day(time.January, 1), -20, -20},
+		{"between", "CF-1", day(time.January, 20), -20, -19.5},
+		{"at the first", "CF-1", day(time.January, 10), -20, -19.5},
+		{"just before the second", "CF-1", day(time.February, 10).Add(-time.Second), -20, -19.5},
+		{"at the second", "CF-1", day(time.February, 10), -20, -20*1.02 - 1},
+		{"late reading between", "CF-1", day(time.February, 1), 4, 4.5},
+		{"sensor without calibrations", "CF-2", day(time.March, 1), 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.apply(tt.sensorID, tt.raw, tt.at); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("apply(%s, %v, %s) = %v, want %v", tt.sensorID, tt.raw, tt.at.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Valores basura típicos de sondas reales (ej. DS18B20: -127 = desconectado, 85 = reset)
+var garbageTemperatures = []float64{-127.0, 85.0}
+
+// chaosConfig define la probabilidad (0-1) de cada falla por lectura
+type chaosConfig struct {
+	dropRate      float64 // paquete perdido
+	duplicateRate float64 // misma lectura enviada dos veces
+	reorderRate   float64 // lectura retenida y entregada después de la siguiente
+	stuckRate     float64 // la sonda se congela en un valor
+	garbageRate   float64 // valor imposible
+	stuckReadings int     // cuántas lecturas dura un sensor congelado
+}
+
+func (c chaosConfig) enabled() bool {
+	return c.dropRate > 0 || c.duplicateRate > 0 || c.reorderRate > 0 || c.stuckRate > 0 || c.garbageRate > 0
+}
+
+// loadChaosConfig lee la capa de fallas desde CHAOS_*_RATE; todo en 0 la desactiva
+func loadChaosConfig() chaosConfig {
+	cfg := chaosConfig{
+		dropRate:      chaosRate("CHAOS_DROP_RATE"),
+		duplicateRate: chaosRate("CHAOS_DUPLICATE_RATE"),
+		reorderRate:   chaosRate("CHAOS_REORDER_RATE"),
+		stuckRate:     chaosRate("CHAOS_STUCK_RATE"),
+		garbageRate:   chaosRate("CHAOS_GARBAGE_RATE"),
+		stuckReadings: 20,
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("CHAOS_STUCK_READINGS")); err == nil && n > 0 {
+		cfg.stuckReadings = n
+	}
+
+	return cfg
+}
+
+func chaosRate(key string) float64 {
+	rate, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+	if rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// stuckSensor guarda el valor congelado de una sonda y las lecturas que le quedan
+type stuckSensor struct {
+	temp      float64
+	remaining int
+}
+
+// withChaos intercala la capa de inyección de fallas entre un simulador y el procesador:
+// devuelve el canal donde debe escribir el simulador. Si no hay fallas configuradas devuelve
+// el mismo canal. Las lecturas de dispositivos reales nunca pasan por aquí.
+func withChaos(out chan<- DataPoint) chan<- DataPoint {
+	cfg := loadChaosConfig()
+	if !cfg.enabled() {
+		return out
+	}
+
+	fmt.Printf("💥 CAPA DE FALLAS ACTIVADA: drop=%.2f dup=%.2f reorder=%.2f stuck=%.2f garbage=%.2f\n",
+		cfg.dropRate, cfg.duplicateRate, cfg.reorderRate, cfg.stuckRate, cfg.garbageRate)
+
+	in := make(chan DataPoint, cap(out))
+	go injectFaults(cfg, rand.New(rand.NewSource(time.Now().UnixNano())), in, out)
+	return in
+}
+
+// injectFaults copia in en out aplicando las fallas con los sorteos de rng. No cierra out:
+// el canal en vivo también recibe las lecturas de red.
+func injectFaults(cfg chaosConfig, rng *rand.Rand, in <-chan DataPoint, out chan<- DataPoint) {
+	stuck := make(map[string]*stuckSensor)
+	held := make(map[string]DataPoint)
+
+	for dp := range in {
+		// 1. Sonda congelada: repite el mismo valor con timestamps nuevos
+		if s, ok := stuck[dp.SensorID]; ok {
+			dp.Temperature = s.temp
+			s.remaining--
+			if s.remaining <= 0 {
+				delete(stuck, dp.SensorID)
+			}
+		} else if rng.Float64() < cfg.stuckRate {
+			stuck[dp.SensorID] = &stuckSensor{temp: dp.Temperature, remaining: cfg.stuckReadings}
+		}
+
+		// 2. Paquete perdido
+		if rng.Float64() < cfg.dropRate {
+			continue
+		}
+
+		// 3. Valor basura
+		if rng.Float64() < cfg.garbageRate {
+			dp.Temperature = garbageTemperatures[rng.Intn(len(garbageTemperatures))]
+		}
+
+		// 4. Desorden: retener esta lectura hasta que llegue la siguiente del mismo sensor
+		if prev, ok := held[dp.SensorID]; ok {
+			delete(held, dp.SensorID)
+			out <- dp
+			out <- prev
+			continue
+		}
+		if rng.Float64() < cfg.reorderRate {
+			held[dp.SensorID] = dp
+			continue
+		}
+
+		out <- dp
+
+		// 5. Duplicado
+		if rng.Float64() < cfg.duplicateRate {
+			out <- dp
+		}
+	}
+
+	// Liberar lo retenido al cerrar el flujo
+	for _, dp := range held {
+		out <- dp
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// runFaults pasa n lecturas de un sensor por injectFaults con una semilla fija
+func runFaults(cfg chaosConfig, n int) []DataPoint {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	in := make(chan DataPoint, n)
+	for i := 0; i < n; i++ {
+		in <- DataPoint{SensorID: "CF-1", Temperature: -20 + float64(i)*0.001, Timestamp: start.Add(time.Duration(i) * 5 * time.Second)}
+	}
+	close(in)
+
+	out := make(chan DataPoint, 3*n)
+	injectFaults(cfg, rand.New(rand.NewSource(42)), in, out)
+	close(out)
+
+	var got []DataPoint
+	for dp := range out {
+		got = append(got, dp)
+	}
+	return got
+}
+
+func TestInjectFaultsRates(t *testing.T) {
+	const n = 10000
+
+	garbage := func(dps []DataPoint) float64 {
+		count := 0
+		for _, dp := range dps {
+			if dp.Temperature == -127 || dp.Temperature == 85 {
+				count++
+			}
+		}
+		return float64(count)
+	}
+	reordered := func(dps []DataPoint) float64 {
+		count := 0
+		for i := 1; i < len(dps); i++ {
+			if dps[i].Timestamp.Before(dps[i-1].Timestamp) {
+				count++
+			}
+		}
+		return float64(count)
+	}
+	duplicated := func(dps []DataPoint) float64 {
+		count := 0
+		for i := 1; i < len(dps); i++ {
+			if dps[i] == dps[i-1] {
+				count++
+			}
+		}
+		return float64(count)
+	}
+	stuck := func(dps []DataPoint) float64 {
+		count := 0
+		for i := 1; i < len(dps); i++ {
+			if dps[i].Temperature == dps[i-1].Temperature && dps[i].Timestamp.After(dps[i-1].Timestamp) {
+				count++
+			}
+		}
+		return float64(count)
+	}
+	total := func(dps []DataPoint) float64 { return float64(len(dps)) }
+
+	tests := []struct {
+		name    string
+		cfg     chaosConfig
+		measure func([]DataPoint) float64
+		want    float64
+	}{
+		{"no faults", chaosConfig{}, total, n},
+		{"drop", chaosConfig{dropRate: 0.1}, total, n * 0.9},
+		{"duplicate", chaosConfig{duplicateRate: 0.2}, duplicated, n * 0.2},
+		{"garbage", chaosConfig{garbageRate: 0.05}, garbage, n * 0.05},
+		// una lectura retenida no puede retener la siguiente: p / (1 + p)
+		{"reorder", chaosConfig{reorderRate: 0.1}, reordered, n * 0.1 / 1.1},
+		// cada congelamiento repite el valor en las stuckReadings lecturas siguientes
+		{"stuck", chaosConfig{stuckRate: 0.01, stuckReadings: 20}, stuck, n * 0.01 * 20 / (1 + 0.01*20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.measure(runFaults(tt.cfg, n))
+			if math.Abs(got-tt.want) > 0.15*tt.want {
+				t.Errorf("got %.0f, want %.0f ± 15%%", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectFaultsKeepsReadings(t *testing.T) {
+	// Sin pérdidas ni duplicados, el desorden solo cambia el orden: salen todas las lecturas
+	got := runFaults(chaosConfig{reorderRate: 0.3}, 1000)
+	if len(got) != 1000 {
+		t.Fatalf("got %d readings, want 1000", len(got))
+	}
+	seen := make(map[time.Time]bool)
+	for _, dp := range got {
+		seen[dp.Timestamp] = true
+	}
+	if len(seen) != 1000 {
+		t.Errorf("got %d distinct readings, want 1000", len(seen))
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"math"
+	"strings"
+
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// configTemplate define la configuración de alertas por defecto de una categoría de producto.
+// Los umbrales se expresan como desvíos respecto a la temperatura objetivo de la cámara.
+type configTemplate struct {
+	maxAbove     float64 // max_temperature = objetivo + maxAbove
+	minBelow     float64 // min_temperature = objetivo - minBelow
+	rateOfChange float64 // °C/min
+	priority     int     // 0=P1 (más alta), 1=P2, 2=P3
+}
+
+var configTemplates = map[string]configTemplate{
+	models.ProductCategoryFrozenMeat: {maxAbove: 3, minBelow: 10, rateOfChange: 0.5, priority: models.AlertPriorityP1},
+	models.ProductCategoryDairy:      {maxAbove: 2, minBelow: 4, rateOfChange: 0.3, priority: models.AlertPriorityP1},
+	models.ProductCategoryVegetables: {maxAbove: 4, minBelow: 2, rateOfChange: 1.0, priority: models.AlertPriorityP2},
+	models.ProductCategoryGeneral:    {maxAbove: 5, minBelow: 5, rateOfChange: 1.0, priority: models.AlertPriorityP2},
+}
+
+// palabras clave para deducir la categoría desde el contenido de cámaras sin categoría explícita
+var categoryKeywords = []struct {
+	category string
+	keywords []string
+}{
+	{models.ProductCategoryFrozenMeat, []string{"carne", "pollo", "pescado", "mariscos", "congelad"}},
+	{models.ProductCategoryDairy, []string{"lácteo", "lacteo", "leche", "queso", "yogur", "mantequilla"}},
+	{models.ProductCategoryVegetables, []string{"vegetal", "verdura", "hortaliza", "fruta"}},
+}
+
+// ValidProductCategory indica si la categoría tiene plantilla
+func ValidProductCategory(category string) bool {
+	_, ok := configTemplates[category]
+	return ok
+}
+
+// ProductCategoryFor devuelve la categoría de la cámara, deduciéndola de su contenido si no está registrada
+func ProductCategoryFor(chamber models.ColdChamber) string {
+	if ValidProductCategory(chamber.ProductCategory) {
+		return chamber.ProductCategory
+	}
+
+	content := strings.ToLower(chamber.Content)
+	for _, c := range categoryKeywords {
+		for _, kw := range c.keywords {
+			if strings.Contains(content, kw) {
+				return c.category
+			}
+		}
+	}
+	return models.ProductCategoryGeneral
+}
+
+// DefaultAlertConfig genera la configuración por defecto de una cámara a partir de la
+// plantilla de su categoría y su temperatura objetivo, acotada al rango físico de la cámara
+func DefaultAlertConfig(chamber models.ColdChamber) models.AlertConfig {
+	t := configTemplates[ProductCategoryFor(chamber)]
+	low, high := PhysicalRange(chamber.TargetTemperature)
+
+	return models.AlertConfig{
+		SensorID:              chamber.ID,
+		MaxTemp:               math.Min(chamber.TargetTemperature+t.maxAbove, high),
+		MinTemp:               math.Max(chamber.TargetTemperature-t.minBelow, low),
+		RateOfChangeThreshold: t.rateOfChange,
+		Priority:              t.priority,
+		IsEnabled:             true,
+		NotificationChannels:  []string{"push"},
+		Recipients:            []string{},
+	}
+}
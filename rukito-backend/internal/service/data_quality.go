@@ -0,0 +1,181 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// Códigos de calidad guardados en temperature_readings.quality
+const (
+	QualityOK         = "OK"
+	QualitySentinel   = "SENTINEL"     // valor reservado de la sonda (ej. -127°C)
+	QualityOutOfRange = "OUT_OF_RANGE" // físicamente imposible para el tipo de cámara
+	QualitySpike      = "SPIKE"        // salto aislado no confirmado por la lectura siguiente
+	QualityStuck      = "STUCK"        // la sonda repite el mismo valor demasiado tiempo
+)
+
+// Valores que las sondas reportan cuando fallan, no temperaturas reales
+var sentinelTemperatures = []float64{-127.0, 85.0, -999.0, 999.0}
+
+// physicalRange son los límites físicos aceptables según el tipo de cámara
+type physicalRange struct {
+	min float64
+	max float64
+}
+
+var (
+	freezerRange      = physicalRange{min: -45.0, max: 15.0} // congeladores (objetivo < 0°C)
+	refrigeratorRange = physicalRange{min: -15.0, max: 25.0} // refrigeradores (objetivo >= 0°C)
+	unknownRange      = physicalRange{min: -50.0, max: 50.0} // cámara sin registro
+)
+
+// probeState es lo que el validador recuerda de cada sonda
+type probeState struct {
+	lastGood     *DataPoint
+	pendingSpike *DataPoint
+	stuckValue   float64
+	stuckSince   time.Time
+	stuckFlagged bool
+}
+
+// qualityValidator revisa cada lectura antes de evaluarla contra umbrales
+type qualityValidator struct {
+	ranges          map[string]physicalRange
+	rangesLoadedAt  time.Time
+	rangesTTL       time.Duration // igual que bandCache: un cambio de temperatura objetivo aplica sin reiniciar
+	probes          map[string]*probeState
+	maxSpikeRate    float64       // °C/min por encima del cual un salto es sospechoso
+	spikeTolerance  float64       // °C para considerar que la lectura siguiente confirma el salto
+	stuckAfter      time.Duration // tiempo con el mismo valor para considerar la sonda congelada
+	stuckResolution float64       // °C de diferencia que cuentan como "mismo valor"
+}
+
+func newQualityValidator() *qualityValidator {
+	v := &qualityValidator{
+		ranges:          make(map[string]physicalRange),
+		rangesTTL:       time.Minute,
+		probes:          make(map[string]*probeState),
+		maxSpikeRate:    5.0,
+		spikeTolerance:  1.0,
+		stuckAfter:      30 * time.Minute,
+		stuckResolution: 0.001,
+	}
+
+	if rate, err := strconv.ParseFloat(os.Getenv("QUALITY_MAX_SPIKE_RATE"), 64); err == nil && rate > 0 {
+		v.maxSpikeRate = rate
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("QUALITY_STUCK_MINUTES")); err == nil && minutes > 0 {
+		v.stuckAfter = time.Duration(minutes) * time.Minute
+	}
+
+	return v
+}
+
+// rangeFor devuelve (y cachea) los límites físicos de la cámara según su temperatura objetivo
+func (v *qualityValidator) rangeFor(sensorID string) physicalRange {
+	if time.Since(v.rangesLoadedAt) > v.rangesTTL {
+		v.ranges = make(map[string]physicalRange)
+		v.rangesLoadedAt = time.Now()
+	}
+	if r, ok := v.ranges[sensorID]; ok {
+		return r
+	}
+
+	r := unknownRange
+	var target float64
+	err := db.DB.QueryRow(`SELECT target_temperature FROM chambers WHERE id = ?`, sensorID).Scan(&target)
+	if err == nil {
+		r = rangeForTarget(target)
+	}
+
+	v.ranges[sensorID] = r
+	return r
+}
+
+func rangeForTarget(target float64) physicalRange {
+	if target < 0 {
+		return freezerRange
+	}
+	return refrigeratorRange
+}
+
+// PhysicalRange devuelve los límites físicos aceptables para una cámara con esa temperatura objetivo
+func PhysicalRange(target float64) (float64, float64) {
+	r := rangeForTarget(target)
+	return r.min, r.max
+}
+
+// check clasifica la lectura. Si la sonda parece defectuosa devuelve además
+// una descripción para la alerta de mantenimiento (vacía si no hace falta alertar).
+// Una lectura fuera de orden solo pasa por las reglas sin estado (centinela y rango físico):
+// no debe mover la referencia de sonda congelada ni de picos.
+func (v *qualityValidator) check(dp DataPoint, outOfOrder bool) (string, string) {
+	// 1. Valores centinela
+	for _, s := range sentinelTemperatures {
+		if dp.Temperature == s {
+			return QualitySentinel, fmt.Sprintf("La sonda reportó el valor centinela %.1f°C (posible desconexión)", dp.Temperature)
+		}
+	}
+
+	// 2. Rango físico por tipo de cámara
+	r := v.rangeFor(dp.SensorID)
+	if math.IsNaN(dp.Temperature) || dp.Temperature < r.min || dp.Temperature > r.max {
+		return QualityOutOfRange, fmt.Sprintf("Lectura de %.1f°C fuera del rango físico [%.0f, %.0f]°C", dp.Temperature, r.min, r.max)
+	}
+
+	if outOfOrder {
+		return QualityOK, ""
+	}
+	p, ok := v.probes[dp.SensorID]
+	if !ok {
+		p = &probeState{}
+		v.probes[dp.SensorID] = p
+	}
+
+	// 3. Sonda congelada: mismo valor durante demasiado tiempo
+	if p.stuckSince.IsZero() || math.Abs(dp.Temperature-p.stuckValue) > v.stuckResolution {
+		p.stuckValue = dp.Temperature
+		p.stuckSince = dp.Timestamp
+		p.stuckFlagged = false
+	} else if dp.Timestamp.Sub(p.stuckSince) >= v.stuckAfter {
+		reason := ""
+		if !p.stuckFlagged {
+			p.stuckFlagged = true
+			reason = fmt.Sprintf("La sonda reporta %.2f°C sin variación desde %s", dp.Temperature, p.stuckSince.Format("15:04"))
+		}
+		return QualityStuck, reason
+	}
+
+	// 4. Picos: un salto demasiado rápido queda pendiente hasta que la siguiente lectura lo confirme
+	if p.pendingSpike != nil {
+		spike := *p.pendingSpike
+		p.pendingSpike = nil
+		if math.Abs(dp.Temperature-spike.Temperature) <= v.spikeTolerance {
+			p.lastGood = &dp
+			return QualityOK, ""
+		}
+	}
+
+	if p.lastGood != nil {
+		minutes := dp.Timestamp.Sub(p.lastGood.Timestamp).Minutes()
+		if minutes > 0 && math.Abs(dp.Temperature-p.lastGood.Temperature)/minutes > v.maxSpikeRate {
+			p.pendingSpike = &dp
+			return QualitySpike, ""
+		}
+	}
+
+	p.lastGood = &dp
+	return QualityOK, ""
+}
+
+// raiseMaintenanceAlert crea una alerta de baja prioridad indicando que la sonda requiere revisión
+func raiseMaintenanceAlert(dp DataPoint, sink dataSink, reason string) {
+	title := fmt.Sprintf("MANTENIMIENTO: Sonda %s", dp.SensorID)
+	raiseAlert(dp, sink, models.AlertPriorityP3, models.AlertTypeMaintenanceRequired, title, reason, alertImpact{}, nil)
+}
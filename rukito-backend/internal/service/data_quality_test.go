@@ -0,0 +1,105 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQualityValidatorCheck(t *testing.T) {
+	type step struct {
+		at         time.Duration // desde el inicio de la serie
+		temp       float64
+		outOfOrder bool
+		quality    string
+		alert      bool // devuelve una descripción para la alerta de mantenimiento
+	}
+	m := func(minutes float64) time.Duration { return time.Duration(minutes * float64(time.Minute)) }
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"sentinels", []step{
+			{m(0), -127, false, QualitySentinel, true},
+			{m(1), 85, false, QualitySentinel, true},
+			{m(2), -999, false, QualitySentinel, true},
+			{m(3), -20, false, QualityOK, false},
+		}},
+		// Congelador: [-45, 15]°C, límites incluidos
+		{"physical range", []step{
+			{m(0), -45, false, QualityOK, false},
+			{m(20), -45.1, false, QualityOutOfRange, true},
+			{m(21), 15.1, false, QualityOutOfRange, true},
+			{m(22), math.NaN(), false, QualityOutOfRange, true},
+			{m(200), 15, false, QualityOK, false},
+		}},
+		// 15°C en un minuto supera 5°C/min; la lectura siguiente vuelve y no lo confirma
+		{"isolated spike", []step{
+			{m(0), -20, false, QualityOK, false},
+			{m(1), -5, false, QualitySpike, false},
+			{m(2), -20, false, QualityOK, false},
+			{m(3), -19.5, false, QualityOK, false},
+		}},
+		// La lectura siguiente está a menos de 1°C del salto: era real
+		{"confirmed jump", []step{
+			{m(0), -20, false, QualityOK, false},
+			{m(1), -5, false, QualitySpike, false},
+			{m(2), -5.8, false, QualityOK, false},
+			{m(3), -5.5, false, QualityOK, false},
+		}},
+		{"fast but under the rate", []step{
+			{m(0), -20, false, QualityOK, false},
+			{m(1), -15.5, false, QualityOK, false},
+		}},
+		// Sin variación (menos de 0.001°C) durante 30 min: se marca desde el minuto 30 y se alerta una vez
+		{"stuck window", []step{
+			{m(0), -20, false, QualityOK, false},
+			{m(10), -20.0005, false, QualityOK, false},
+			{m(29) + 59*time.Second, -20, false, QualityOK, false},
+			{m(30), -20, false, QualityStuck, true},
+			{m(35), -20, false, QualityStuck, false},
+			{m(40), -19.9, false, QualityOK, false},
+			{m(69), -19.9, false, QualityOK, false},
+			{m(70), -19.9, false, QualityStuck, true},
+		}},
+		// Una variación reinicia la ventana
+		{"variation restarts the window", []step{
+			{m(0), -20, false, QualityOK, false},
+			{m(20), -19.99, false, QualityOK, false},
+			{m(40), -19.99, false, QualityOK, false},
+			{m(50), -19.99, false, QualityStuck, true},
+		}},
+		// Fuera de orden solo aplican centinela y rango: ni cuenta como salto ni mueve las referencias
+		{"out of order", []step{
+			{m(0), -20, false, QualityOK, false},
+			{m(10), -20, false, QualityOK, false},
+			{m(5), -5, true, QualityOK, false},
+			{m(3), -127, true, QualitySentinel, true},
+			{m(4), 40, true, QualityOutOfRange, true},
+			{m(11), -20, false, QualityOK, false},
+			{m(30), -20, false, QualityStuck, true},
+		}},
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newQualityValidator()
+			// Rango de congelador precargado para no consultar la base
+			v.ranges["CF-1"] = freezerRange
+			v.rangesLoadedAt = time.Now()
+
+			for i, s := range tt.steps {
+				dp := DataPoint{SensorID: "CF-1", Temperature: s.temp, Timestamp: start.Add(s.at)}
+				quality, reason := v.check(dp, s.outOfOrder)
+				if quality != s.quality {
+					t.Errorf("step %d (%v, %.4f): quality = %s, want %s", i, s.at, s.temp, quality, s.quality)
+				}
+				if (reason != "") != s.alert {
+					t.Errorf("step %d (%v, %.4f): reason = %q, want alert %v", i, s.at, s.temp, reason, s.alert)
+				}
+			}
+		})
+	}
+}
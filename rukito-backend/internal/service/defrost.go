@@ -0,0 +1,379 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// Parámetros del reconocimiento de ciclos de descongelamiento
+const (
+	defrostOnsetWindow     = 5 * time.Minute  // ventana en la que se busca la subida brusca
+	defrostOnsetRise       = 1.5              // °C de subida dentro de la ventana, partiendo del rango normal
+	defrostRecurrenceDays  = 3                // días anteriores en los que se busca la misma firma
+	defrostRecurrenceMin   = 2                // días con la firma para reconocer un ciclo no programado
+	defrostRecurrenceSlack = 20 * time.Minute // tolerancia de horario entre un día y otro
+	defrostRecurrenceEvery = 30 * time.Minute // tras una firma no recurrente no se vuelve a consultar la historia
+	defrostDetectedHeating = 30 * time.Minute
+	defrostDetectedRecover = 30 * time.Minute
+	defrostCeilingMargin   = 10.0 // °C sobre el umbral crítico que se toleran si el ciclo no define max_temperature
+)
+
+// defrostSchedule es un ciclo programado tal como lo usa el pipeline
+type defrostSchedule struct {
+	id             string
+	start          time.Duration // desde la medianoche local
+	duration       time.Duration
+	recovery       time.Duration
+	maxTemperature *float64
+}
+
+// occurrence devuelve el inicio de la ocurrencia que contiene at, si at cae dentro de una
+func (s defrostSchedule) occurrence(at time.Time) (time.Time, bool) {
+	local := at.In(ReportTimezone())
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()).Add(s.start)
+	if start.After(local) {
+		start = start.AddDate(0, 0, -1) // un ciclo que empezó antes de la medianoche
+	}
+	return start, local.Sub(start) < s.duration
+}
+
+// defrostScheduleCache cachea los ciclos programados activos, igual que bandCache
+type defrostScheduleCache struct {
+	current  map[string][]defrostSchedule
+	loadedAt time.Time
+	ttl      time.Duration
+}
+
+func (c *defrostScheduleCache) refresh() {
+	rows, err := db.DB.Query(`
+		SELECT id, sensor_id, start_time, duration_minutes, recovery_minutes, max_temperature
+		FROM defrost_schedules
+		WHERE active = TRUE`)
+	if err != nil {
+		fmt.Printf("Error cargando ciclos de descongelamiento: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	current := make(map[string][]defrostSchedule)
+	for rows.Next() {
+		var s defrostSchedule
+		var sensorID, startTime string
+		var duration, recovery int
+		var maxTemperature sql.NullFloat64
+		if err := rows.Scan(&s.id, &sensorID, &startTime, &duration, &recovery, &maxTemperature); err != nil {
+			fmt.Printf("Error cargando ciclos de descongelamiento: %v\n", err)
+			return
+		}
+		start, err := ParseDefrostStart(startTime)
+		if err != nil {
+			fmt.Printf("Ciclo de descongelamiento %s con hora inválida '%s'\n", s.id, startTime)
+			continue
+		}
+		s.start = start
+		s.duration = time.Duration(duration) * time.Minute
+		s.recovery = time.Duration(recovery) * time.Minute
+		if maxTemperature.Valid {
+			val := maxTemperature.Float64
+			s.maxTemperature = &val
+		}
+		current[sensorID] = append(current[sensorID], s)
+	}
+
+	c.current = current
+	c.loadedAt = time.Now()
+}
+
+func (c *defrostScheduleCache) get(sensorID string) []defrostSchedule {
+	if c.current == nil || time.Since(c.loadedAt) > c.ttl {
+		c.refresh()
+	}
+	return c.current[sensorID]
+}
+
+// ParseDefrostStart convierte una hora local "HH:MM" (o "HH:MM:SS", como la devuelve MySQL)
+// en el tiempo transcurrido desde la medianoche
+func ParseDefrostStart(value string) (time.Duration, error) {
+	layout := "15:04"
+	if strings.Count(value, ":") == 2 {
+		layout = "15:04:05"
+	}
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+}
+
+// activeDefrost es el estado en memoria de un ciclo en curso
+type activeDefrost struct {
+	id           string
+	sensorID     string
+	source       string
+	scheduleID   *string
+	startedAt    time.Time
+	heatingUntil time.Time // fin previsto del calentamiento
+	recoverBy    time.Time // límite para volver bajo el umbral de advertencia
+	ceiling      float64   // sobre esta temperatura se alerta igual
+	peak         float64
+	endedAt      *time.Time
+	status       string
+}
+
+// hasDefrostRise indica si points (en orden) contienen la firma de un descongelamiento:
+// una subida de al menos defrostOnsetRise dentro de defrostOnsetWindow que parte del rango normal
+func hasDefrostRise(points []riskPoint, warning float64) bool {
+	for j := range points {
+		for i := j - 1; i >= 0 && points[j].at.Sub(points[i].at) <= defrostOnsetWindow; i-- {
+			if points[i].temp <= warning && points[j].temp-points[i].temp >= defrostOnsetRise {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// defrostTracker reconoce los ciclos de descongelamiento, programados o detectados por su
+// firma recurrente, y decide cuándo se suspenden las alertas de umbral. Un ciclo termina
+// cuando la cámara vuelve bajo el umbral de advertencia; si no lo logra a tiempo se avisa.
+type defrostTracker struct {
+	bands       *bandCache
+	schedules   *defrostScheduleCache
+	active      map[string]*activeDefrost
+	resumed     map[string]bool
+	recent      map[string][]riskPoint // ventana de defrostOnsetWindow para la firma
+	occurrences map[string]time.Time   // última ocurrencia iniciada por ciclo programado
+	lastCheck   map[string]time.Time   // última consulta de recurrencia por cámara
+
+	// Lecturas de días anteriores y creación de alertas (reemplazables en las pruebas)
+	history func(sink dataSink, sensorID string, from, to time.Time) ([]riskPoint, error)
+	raise   func(dp DataPoint, sink dataSink, priority, alertType int, title, desc string, impact alertImpact, configRevision *int)
+}
+
+func newDefrostTracker(bands *bandCache) *defrostTracker {
+	return &defrostTracker{
+		bands:       bands,
+		schedules:   &defrostScheduleCache{ttl: time.Minute},
+		active:      make(map[string]*activeDefrost),
+		resumed:     make(map[string]bool),
+		recent:      make(map[string][]riskPoint),
+		occurrences: make(map[string]time.Time),
+		lastCheck:   make(map[string]time.Time),
+		history:     dataSink.riskPoints,
+		raise:       raiseAlert,
+	}
+}
+
+// observe procesa una lectura válida (ya calibrada y en orden) y devuelve si sus alertas
+// de umbral deben suspenderse
+func (d *defrostTracker) observe(dp DataPoint, sink dataSink) bool {
+	band, ok := d.bands.get(dp.SensorID)
+	if !ok {
+		return false
+	}
+
+	// Tras un reinicio se retoma el ciclo que quedó en curso
+	if !d.resumed[dp.SensorID] {
+		d.resumed[dp.SensorID] = true
+		if c := sink.loadActiveDefrost(dp.SensorID, band); c != nil {
+			d.active[dp.SensorID] = c
+		}
+	}
+
+	points := append(d.recent[dp.SensorID], riskPoint{at: dp.Timestamp, temp: dp.Temperature})
+	cutoff := dp.Timestamp.Add(-defrostOnsetWindow)
+	i := 0
+	for i < len(points) && points[i].at.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		points = append([]riskPoint(nil), points[i:]...)
+	}
+	d.recent[dp.SensorID] = points
+
+	c := d.active[dp.SensorID]
+	if c == nil {
+		c = d.start(dp, band, points, sink)
+		if c == nil {
+			return false
+		}
+	}
+
+	c.peak = math.Max(c.peak, dp.Temperature)
+	switch {
+	case dp.Temperature <= band.warning && (c.peak > band.warning || !dp.Timestamp.Before(c.heatingUntil)):
+		d.finish(c, dp.Timestamp, models.DefrostRecovered, sink)
+		return false
+	case dp.Timestamp.After(c.recoverBy):
+		d.finish(c, dp.Timestamp, models.DefrostProlonged, sink)
+		d.alertProlonged(c, dp, band, sink)
+		return false
+	}
+	return dp.Temperature <= c.ceiling
+}
+
+// suppressing indica si una lectura atrasada cae dentro de un ciclo en curso
+func (d *defrostTracker) suppressing(dp DataPoint) bool {
+	c := d.active[dp.SensorID]
+	return c != nil && !dp.Timestamp.Before(c.startedAt) && dp.Temperature <= c.ceiling
+}
+
+// start abre un ciclo si la lectura cae en uno programado o si la cámara muestra la firma
+// de un descongelamiento que se repite a la misma hora en los días anteriores
+func (d *defrostTracker) start(dp DataPoint, band safeBand, points []riskPoint, sink dataSink) *activeDefrost {
+	c := &activeDefrost{
+		id:       "DEF-" + uuid.New().String()[:8],
+		sensorID: dp.SensorID,
+		peak:     dp.Temperature,
+		status:   models.DefrostInProgress,
+		ceiling:  band.high + defrostCeilingMargin,
+	}
+
+	for _, s := range d.schedules.get(dp.SensorID) {
+		occurrence, within := s.occurrence(dp.Timestamp)
+		if !within || d.occurrences[s.id].Equal(occurrence) {
+			continue
+		}
+		d.occurrences[s.id] = occurrence
+		scheduleID := s.id
+		c.source = models.DefrostScheduled
+		c.scheduleID = &scheduleID
+		c.startedAt = occurrence
+		c.heatingUntil = occurrence.Add(s.duration)
+		c.recoverBy = c.heatingUntil.Add(s.recovery)
+		if s.maxTemperature != nil {
+			c.ceiling = *s.maxTemperature
+		}
+		break
+	}
+
+	if c.source == "" {
+		low := points[0]
+		for _, p := range points {
+			if p.temp < low.temp {
+				low = p
+			}
+		}
+		if low.temp > band.warning || dp.Temperature-low.temp < defrostOnsetRise {
+			return nil
+		}
+		if last, ok := d.lastCheck[dp.SensorID]; ok && dp.Timestamp.Sub(last) < defrostRecurrenceEvery {
+			return nil
+		}
+		d.lastCheck[dp.SensorID] = dp.Timestamp
+		if !d.recurrent(dp.SensorID, low.at, band.warning, sink) {
+			return nil
+		}
+		c.source = models.DefrostDetected
+		c.startedAt = low.at
+		c.heatingUntil = low.at.Add(defrostDetectedHeating)
+		c.recoverBy = c.heatingUntil.Add(defrostDetectedRecover)
+	}
+
+	d.active[dp.SensorID] = c
+	d.save(c, sink)
+	return c
+}
+
+// recurrent busca la misma firma alrededor de la misma hora en los días anteriores
+func (d *defrostTracker) recurrent(sensorID string, onset time.Time, warning float64, sink dataSink) bool {
+	found := 0
+	for day := 1; day <= defrostRecurrenceDays; day++ {
+		at := onset.AddDate(0, 0, -day)
+		points, err := d.history(sink, sensorID, at.Add(-defrostRecurrenceSlack-defrostOnsetWindow), at.Add(defrostRecurrenceSlack+defrostOnsetWindow))
+		if err != nil {
+			fmt.Printf("Error buscando descongelamientos anteriores de %s: %v\n", sensorID, err)
+			return false
+		}
+		if hasDefrostRise(points, warning) {
+			found++
+		}
+	}
+	return found >= defrostRecurrenceMin
+}
+
+func (d *defrostTracker) finish(c *activeDefrost, at time.Time, status string, sink dataSink) {
+	c.endedAt = &at
+	c.status = status
+	delete(d.active, c.sensorID)
+	d.save(c, sink)
+}
+
+func (d *defrostTracker) save(c *activeDefrost, sink dataSink) {
+	if err := sink.saveDefrost(c); err != nil {
+		fmt.Printf("Error DB: %v\n", err)
+	}
+}
+
+// alertProlonged avisa que la cámara no se recuperó a tiempo; desde ese momento vuelven
+// a aplicar las alertas de umbral
+func (d *defrostTracker) alertProlonged(c *activeDefrost, dp DataPoint, band safeBand, sink dataSink) {
+	priority, alertType := models.AlertPriorityP2, models.AlertTypeTemperatureWarning
+	if dp.Temperature > band.high {
+		priority, alertType = models.AlertPriorityP1, models.AlertTypeTemperatureCritical
+	}
+	action := "Revisar el fin del descongelamiento, el ventilador del evaporador y el compresor"
+	d.raise(dp, sink, priority, alertType,
+		fmt.Sprintf("RECUPERACIÓN LENTA TRAS DESCONGELAMIENTO: %s", dp.SensorID),
+		fmt.Sprintf("Con %.1f°C sigue sobre el umbral de advertencia (%.1f°C) %.0f min después del inicio del descongelamiento (pico %.1f°C)",
+			dp.Temperature, band.warning, dp.Timestamp.Sub(c.startedAt).Minutes(), c.peak),
+		alertImpact{suggestedAction: &action}, band.revision)
+}
+
+// saveDefrost persiste un ciclo; los replays no registran ciclos
+func (s dataSink) saveDefrost(c *activeDefrost) error {
+	if s.runID != "" {
+		return nil
+	}
+
+	query := `
+		INSERT INTO defrost_cycles (id, sensor_id, source, schedule_id, started_at, heating_until, recover_by, ended_at, peak_temperature, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE ended_at = VALUES(ended_at), peak_temperature = VALUES(peak_temperature), status = VALUES(status)`
+	_, err := db.DB.Exec(query, c.id, c.sensorID, c.source, c.scheduleID, c.startedAt, c.heatingUntil, c.recoverBy, c.endedAt, c.peak, c.status)
+	return err
+}
+
+// loadActiveDefrost devuelve el ciclo en curso de un sensor, si existe. Sin máximo propio
+// del programa, el techo sale del rango seguro vigente de la cámara.
+func (s dataSink) loadActiveDefrost(sensorID string, band safeBand) *activeDefrost {
+	if s.runID != "" {
+		return nil
+	}
+
+	c := &activeDefrost{sensorID: sensorID}
+	var scheduleID sql.NullString
+	var maxTemperature sql.NullFloat64
+	err := db.DB.QueryRow(`
+		SELECT d.id, d.source, d.schedule_id, d.started_at, d.heating_until, d.recover_by, d.peak_temperature, d.status,
+			ds.max_temperature
+		FROM defrost_cycles d
+		LEFT JOIN defrost_schedules ds ON ds.id = d.schedule_id
+		WHERE d.sensor_id = ? AND d.ended_at IS NULL
+		ORDER BY d.started_at DESC
+		LIMIT 1`, sensorID).Scan(&c.id, &c.source, &scheduleID, &c.startedAt, &c.heatingUntil, &c.recoverBy, &c.peak, &c.status,
+		&maxTemperature)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error cargando descongelamiento en curso: %v\n", err)
+		}
+		return nil
+	}
+
+	if scheduleID.Valid {
+		val := scheduleID.String
+		c.scheduleID = &val
+	}
+	c.ceiling = band.high + defrostCeilingMargin
+	if maxTemperature.Valid {
+		c.ceiling = maxTemperature.Float64
+	}
+	return c
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// defrostShape es un descongelamiento que empieza a las 03:00 (hora de reportes): sube a
+// 0.6°C/min de -20 a -8°C en 20 min, se mantiene 10 min y baja a 1.2°C/min hasta -20°C a las
+// 03:40 (bajo la advertencia de -18°C desde las 03:39). Fuera de él la cámara está en -20°C.
+func defrostShape(at time.Time) float64 {
+	local := at.In(ReportTimezone())
+	m := local.Sub(time.Date(local.Year(), local.Month(), local.Day(), 3, 0, 0, 0, local.Location())).Minutes()
+	switch {
+	case m < 0 || m > 40:
+		return -20
+	case m <= 20:
+		return -20 + 0.6*m
+	case m <= 30:
+		return -8
+	default:
+		return -8 - 1.2*(m-30)
+	}
+}
+
+// defrostDay es el día de la prueba; los descongelamientos anteriores se buscan en los días previos
+var defrostDay = time.Date(2024, 3, 10, 0, 0, 0, 0, ReportTimezone())
+
+func TestHasDefrostRise(t *testing.T) {
+	at := func(minute int) time.Time { return defrostDay.Add(time.Duration(minute) * time.Minute) }
+
+	tests := []struct {
+		name   string
+		points []riskPoint
+		want   bool
+	}{
+		{"no readings", nil, false},
+		{"flat", []riskPoint{{at(0), -20}, {at(1), -20}, {at(2), -20}}, false},
+		{"rise within the window", []riskPoint{{at(0), -20}, {at(2), -19}, {at(5), -18.5}}, true},
+		{"rise too slow", []riskPoint{{at(0), -20}, {at(3), -19}, {at(6), -18.5}}, false},
+		{"rise too small", []riskPoint{{at(0), -20}, {at(5), -18.6}}, false},
+		// Una subida que parte de sobre la advertencia no es la firma: la cámara ya estaba caliente
+		{"starts above the warning", []riskPoint{{at(0), -17}, {at(2), -14}}, false},
+		{"defrost", sampleDefrost(defrostDay.Add(2*time.Hour+40*time.Minute), defrostDay.Add(3*time.Hour+25*time.Minute), defrostShape), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasDefrostRise(tt.points, -18); got != tt.want {
+				t.Errorf("hasDefrostRise() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sampleDefrost muestrea shape cada minuto entre from y to
+func sampleDefrost(from, to time.Time, shape func(time.Time) float64) []riskPoint {
+	var points []riskPoint
+	for at := from; !at.After(to); at = at.Add(time.Minute) {
+		points = append(points, riskPoint{at: at, temp: shape(at)})
+	}
+	return points
+}
+
+// testDefrostTracker arma un tracker sin base: banda y programas precargados, historia que
+// repite defrostShape en los días previos indicados y alertas registradas en alerts
+func testDefrostTracker(schedules []defrostSchedule, previousDays map[int]bool) (*defrostTracker, *int, *[]int) {
+	bands := newBandCache()
+	bands.current = map[string]safeBand{"CF-1": {high: -15, warning: -18, alertsEnabled: true}}
+	bands.loadedAt = time.Now()
+
+	d := newDefrostTracker(bands)
+	d.schedules.current = map[string][]defrostSchedule{"CF-1": schedules}
+	d.schedules.loadedAt = time.Now()
+
+	queries := 0
+	d.history = func(_ dataSink, _ string, from, to time.Time) ([]riskPoint, error) {
+		queries++
+		return sampleDefrost(from, to, func(at time.Time) float64 {
+			if previousDays[int(defrostDay.Sub(at).Hours()/24)+1] {
+				return defrostShape(at)
+			}
+			return -20
+		}), nil
+	}
+
+	var alerts []int
+	d.raise = func(_ DataPoint, _ dataSink, priority, _ int, _, _ string, _ alertImpact, _ *int) {
+		alerts = append(alerts, priority)
+	}
+	return d, &queries, &alerts
+}
+
+func TestDefrostTracker(t *testing.T) {
+	clock := func(hour, minute int) time.Time {
+		return defrostDay.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	// Sin lecturas de replay en la base: un sink de replay no guarda ni retoma ciclos
+	sink := dataSink{runID: "test"}
+
+	maxTemperature := -10.0
+	scheduled := defrostSchedule{id: "DS-1", start: 3 * time.Hour, duration: 20 * time.Minute, recovery: 20 * time.Minute}
+	capped := scheduled
+	capped.maxTemperature = &maxTemperature
+
+	// Se calienta igual que defrostShape pero queda en -10°C hasta las 04:30
+	stuckWarm := func(at time.Time) float64 {
+		if at.After(clock(3, 20)) && at.Before(clock(4, 30)) {
+			return -10
+		}
+		return defrostShape(at)
+	}
+
+	tests := []struct {
+		name         string
+		schedules    []defrostSchedule
+		previousDays map[int]bool
+		shape        func(time.Time) float64
+		suppressFrom time.Time // primera lectura suspendida; cero si ninguna
+		suppressTo   time.Time // última lectura suspendida
+		above        float64   // sobre esta temperatura no se suspende aunque haya ciclo
+		status       string    // estado del ciclo al terminar la serie
+		alerts       []int
+		queries      int
+	}{
+		// La firma (1.5°C en 5 min) aparece a las 03:03 y se repitió ayer y anteayer
+		{"recurrent signature", nil, map[int]bool{1: true, 2: true}, defrostShape,
+			clock(3, 3), clock(3, 38), 100, models.DefrostRecovered, nil, 3},
+		// Solo ayer: no alcanza defrostRecurrenceMin y no se vuelve a consultar en 30 min
+		{"not recurrent", nil, map[int]bool{1: true}, defrostShape,
+			time.Time{}, time.Time{}, 100, "", nil, 3},
+		{"no signature the previous days", nil, nil, defrostShape,
+			time.Time{}, time.Time{}, 100, "", nil, 3},
+		// Programado: se suspende desde el inicio del programa, sin consultar la historia
+		{"scheduled", []defrostSchedule{scheduled}, nil, defrostShape,
+			clock(3, 0), clock(3, 38), 100, models.DefrostRecovered, nil, 0},
+		// Con max_temperature -10°C las lecturas más calientes alertan igual
+		{"scheduled ceiling", []defrostSchedule{capped}, nil, defrostShape,
+			clock(3, 0), clock(3, 38), -10, models.DefrostRecovered, nil, 0},
+		// Sin volver bajo la advertencia antes de recover_by (03:40) se avisa una vez, con -10°C
+		// sobre el crítico (P1), y vuelven las alertas de umbral
+		{"prolonged recovery", []defrostSchedule{scheduled}, nil, stuckWarm,
+			clock(3, 0), clock(3, 40), 100, models.DefrostProlonged, []int{models.AlertPriorityP1}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, queries, alerts := testDefrostTracker(tt.schedules, tt.previousDays)
+
+			var last *activeDefrost
+			for at := clock(2, 30); !at.After(clock(5, 0)); at = at.Add(time.Minute) {
+				dp := DataPoint{SensorID: "CF-1", Temperature: tt.shape(at), Timestamp: at}
+				got := d.observe(dp, sink)
+				if c := d.active["CF-1"]; c != nil {
+					last = c
+				}
+
+				want := !tt.suppressFrom.IsZero() && !at.Before(tt.suppressFrom) && !at.After(tt.suppressTo) && dp.Temperature <= tt.above
+				if got != want {
+					t.Errorf("%s (%.1f°C): suppressed = %v, want %v", at.Format("15:04"), dp.Temperature, got, want)
+				}
+			}
+
+			if d.active["CF-1"] != nil {
+				t.Error("the cycle is still active at 05:00")
+			}
+			status := ""
+			if last != nil {
+				status = last.status
+			}
+			if status != tt.status {
+				t.Errorf("status = %q, want %q", status, tt.status)
+			}
+			if len(*alerts) != len(tt.alerts) || (len(tt.alerts) > 0 && (*alerts)[0] != tt.alerts[0]) {
+				t.Errorf("alerts = %v, want %v", *alerts, tt.alerts)
+			}
+			if *queries != tt.queries {
+				t.Errorf("history queries = %d, want %d", *queries, tt.queries)
+			}
+		})
+	}
+}
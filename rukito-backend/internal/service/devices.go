@@ -0,0 +1,106 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+var (
+	ErrDeviceUnknown  = errors.New("unknown device")
+	ErrDeviceRevoked  = errors.New("device revoked")
+	ErrDeviceBadKey   = errors.New("invalid api key")
+	ErrDeviceMismatch = errors.New("device is not bound to this chamber")
+)
+
+// GenerateDeviceKey crea una API key nueva y devuelve la key en claro (se muestra una sola vez) y su hash.
+// Si no hay aleatoriedad disponible devuelve error: nunca se entrega una key predecible.
+func GenerateDeviceKey() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("generando la API key del dispositivo: %w", err)
+	}
+	key := "rk_" + hex.EncodeToString(buf)
+	return key, hashDeviceKey(key), nil
+}
+
+func hashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DeviceKeyGracePeriod es el tiempo que la key anterior sigue siendo válida tras una rotación
+// (DEVICE_KEY_GRACE_MINUTES, default 60) para dar tiempo a reconfigurar el dispositivo
+func DeviceKeyGracePeriod() time.Duration {
+	minutes := 60
+	if m, err := strconv.Atoi(os.Getenv("DEVICE_KEY_GRACE_MINUTES")); err == nil && m >= 0 {
+		minutes = m
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// AuthenticateDevice valida la API key de un dispositivo (la actual o la anterior dentro del periodo de gracia)
+func AuthenticateDevice(deviceID, key string) (models.Device, error) {
+	var d models.Device
+	var keyHash string
+	var prevHash sql.NullString
+	var prevExpires, revokedAt, lastSeen sql.NullTime
+
+	query := `
+		SELECT id, chamber_id, name, api_key_hash, previous_key_hash, previous_key_expires_at, revoked_at, key_rotated_at, last_seen_at, created_at
+		FROM devices
+		WHERE id = ?`
+
+	err := db.DB.QueryRow(query, deviceID).Scan(&d.ID, &d.ChamberID, &d.Name, &keyHash, &prevHash, &prevExpires, &revokedAt, &d.KeyRotatedAt, &lastSeen, &d.CreatedAt)
+	if err == sql.ErrNoRows {
+		return d, ErrDeviceUnknown
+	} else if err != nil {
+		return d, err
+	}
+
+	if lastSeen.Valid {
+		val := lastSeen.Time
+		d.LastSeenAt = &val
+	}
+	if revokedAt.Valid {
+		val := revokedAt.Time
+		d.RevokedAt = &val
+		return d, ErrDeviceRevoked
+	}
+
+	given := []byte(hashDeviceKey(key))
+	if subtle.ConstantTimeCompare(given, []byte(keyHash)) == 1 {
+		return d, nil
+	}
+	if prevHash.Valid && prevExpires.Valid && time.Now().Before(prevExpires.Time) &&
+		subtle.ConstantTimeCompare(given, []byte(prevHash.String)) == 1 {
+		return d, nil
+	}
+
+	return d, ErrDeviceBadKey
+}
+
+// TouchDevice registra la última vez que el dispositivo envió datos válidos
+func TouchDevice(deviceID string) {
+	db.DB.Exec(`UPDATE devices SET last_seen_at = ? WHERE id = ?`, time.Now(), deviceID)
+}
+
+// LogDeviceRejection guarda un intento de ingestión rechazado
+func LogDeviceRejection(deviceID, sensorID, remoteAddr, reason string) {
+	fmt.Printf("⛔ Ingestión rechazada: dispositivo=%q sensor=%q origen=%s motivo=%s\n", deviceID, sensorID, remoteAddr, reason)
+
+	query := `INSERT INTO device_rejections (device_id, sensor_id, remote_addr, reason, created_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := db.DB.Exec(query, deviceID, sensorID, remoteAddr, reason, time.Now()); err != nil {
+		fmt.Printf("Error DB: %v\n", err)
+	}
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// Parámetros de la inferencia de ciclos del compresor
+const (
+	equipmentHysteresis   = 0.2              // °C que debe revertir la temperatura para contar un cambio de fase
+	equipmentMaxGap       = 10 * time.Minute // un hueco mayor corta la fase en curso sin contarla
+	equipmentBackfillDays = 7                // días cerrados que el monitor completa si faltan
+	equipmentTrendDays    = 7                // ventana de la tendencia del ciclo de trabajo
+	equipmentTrendMinDays = 5
+	equipmentTrendSlope   = 0.01 // fracción por día (1 punto porcentual)
+	equipmentTrendRise    = 0.10 // aumento total mínimo dentro de la ventana
+)
+
+// inferEquipmentDay deduce los ciclos del compresor a partir del diente de sierra de points
+// (en orden). Mientras el compresor funciona la cámara se enfría y cuando se detiene se
+// calienta, así que cada tramo descendente es un encendido. Los cambios de fase se detectan
+// con histéresis para no contar el ruido de la sonda. La recuperación es el tiempo desde el
+// pico de cada cruce del umbral de advertencia hasta volver bajo él.
+// Las lecturas dentro de un descongelamiento se descartan y cortan la fase en curso como un
+// hueco: el calentamiento no es un apagado del compresor ni la vuelta una recuperación.
+func inferEquipmentDay(points []riskPoint, warning float64, defrosts []defrostSpan) models.EquipmentDay {
+	var day models.EquipmentDay
+
+	const (
+		unknown = iota
+		falling // compresor encendido
+		rising  // compresor detenido
+	)
+	phase := unknown
+	var phaseStart, extreme riskPoint
+	var partial bool
+	var onMinutes, offMinutes, drop float64
+
+	var above bool
+	var peak riskPoint
+	var recoveryMinutes float64
+
+	var prev riskPoint
+	started, cut := false, false
+	for _, p := range points {
+		if duringDefrost(p.at, defrosts) {
+			cut = true
+			continue
+		}
+		day.Readings++
+
+		contiguous := false
+		if started {
+			gap := p.at.Sub(prev.at)
+			if cut || gap > equipmentMaxGap {
+				phase = unknown
+				above = false
+			} else {
+				contiguous = true
+				day.CoveredMinutes += gap.Minutes()
+			}
+		}
+
+		switch {
+		case phase == unknown:
+			// La primera fase tras un hueco empieza a mitad de camino y no se cuenta
+			if contiguous {
+				partial = true
+				if p.temp < prev.temp {
+					phase, phaseStart, extreme = falling, prev, p
+				} else if p.temp > prev.temp {
+					phase, phaseStart, extreme = rising, prev, p
+				}
+			}
+
+		case phase == falling && p.temp < extreme.temp:
+			extreme = p
+		case phase == falling && p.temp-extreme.temp >= equipmentHysteresis:
+			// El mínimo marca el apagado: termina un ciclo de enfriamiento completo
+			minutes := extreme.at.Sub(phaseStart.at).Minutes()
+			if !partial && minutes > 0 {
+				onMinutes += minutes
+				drop += phaseStart.temp - extreme.temp
+				day.CycleCount++
+			}
+			phase, phaseStart, extreme, partial = rising, extreme, p, false
+
+		case phase == rising && p.temp > extreme.temp:
+			extreme = p
+		case phase == rising && extreme.temp-p.temp >= equipmentHysteresis:
+			// El máximo marca el encendido
+			if !partial {
+				offMinutes += extreme.at.Sub(phaseStart.at).Minutes()
+			}
+			phase, phaseStart, extreme, partial = falling, extreme, p, false
+		}
+
+		switch {
+		case p.temp > warning && !above:
+			above, peak = true, p
+		case p.temp > warning && p.temp > peak.temp:
+			peak = p
+		case p.temp <= warning && above:
+			above = false
+			recoveryMinutes += p.at.Sub(peak.at).Minutes()
+			day.Recoveries++
+		}
+		prev, started, cut = p, true, false
+	}
+
+	if total := onMinutes + offMinutes; total > 0 {
+		val := math.Round(onMinutes/total*10000) / 10000
+		day.DutyCycle = &val
+	}
+	if onMinutes > 0 {
+		val := math.Round(drop/onMinutes*1000) / 1000
+		day.PullDownRate = &val
+	}
+	if day.Recoveries > 0 {
+		val := math.Round(recoveryMinutes/float64(day.Recoveries)*100) / 100
+		day.RecoveryMinutes = &val
+	}
+	day.CoveredMinutes = math.Round(day.CoveredMinutes*100) / 100
+	return day
+}
+
+// localDay devuelve el inicio del día local (EXPORT_TIMEZONE) que contiene at
+func localDay(at time.Time) time.Time {
+	local := at.In(ReportTimezone())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+}
+
+// defrostSpan es el intervalo de un descongelamiento, desde su inicio hasta la recuperación
+type defrostSpan struct {
+	from time.Time
+	to   time.Time
+}
+
+func duringDefrost(at time.Time, defrosts []defrostSpan) bool {
+	for _, d := range defrosts {
+		if !at.Before(d.from) && !at.After(d.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDefrostSpans lee los descongelamientos de la cámara que se solapan con [from, to].
+// Uno en curso se extiende hasta su recover_by.
+func loadDefrostSpans(sensorID string, from, to time.Time) ([]defrostSpan, error) {
+	rows, err := db.DB.Query(`
+		SELECT started_at, COALESCE(ended_at, recover_by)
+		FROM defrost_cycles
+		WHERE sensor_id = ? AND started_at <= ? AND COALESCE(ended_at, recover_by) >= ?
+		ORDER BY started_at`, sensorID, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spans []defrostSpan
+	for rows.Next() {
+		var s defrostSpan
+		if err := rows.Scan(&s.from, &s.to); err != nil {
+			return nil, err
+		}
+		spans = append(spans, s)
+	}
+	return spans, rows.Err()
+}
+
+// computeEquipmentDay infiere las métricas de un día local con las lecturas válidas de la
+// cámara fuera de sus descongelamientos
+func computeEquipmentDay(sensorID string, start time.Time, warning float64) (models.EquipmentDay, error) {
+	end := start.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	points, err := liveSink.riskPoints(sensorID, start, end)
+	if err != nil {
+		return models.EquipmentDay{}, err
+	}
+	defrosts, err := loadDefrostSpans(sensorID, start, end)
+	if err != nil {
+		return models.EquipmentDay{}, err
+	}
+	day := inferEquipmentDay(points, warning, defrosts)
+	day.Day = start.Format("2006-01-02")
+	return day, nil
+}
+
+// dutyCycleTrend ajusta una recta al ciclo de trabajo de days (en orden) y devuelve la
+// variación por día; rising indica un aumento sostenido, señal temprana de pérdida de
+// refrigerante o condensador sucio
+func dutyCycleTrend(days []models.EquipmentDay) (slope *float64, rising bool) {
+	if len(days) > equipmentTrendDays {
+		days = days[len(days)-equipmentTrendDays:]
+	}
+
+	// linearFit trabaja en minutos; cada día se ubica a su medianoche
+	var points []riskPoint
+	for _, d := range days {
+		if d.DutyCycle == nil {
+			continue
+		}
+		at, err := time.Parse("2006-01-02", d.Day)
+		if err != nil {
+			continue
+		}
+		points = append(points, riskPoint{at: at, temp: *d.DutyCycle})
+	}
+	if len(points) < equipmentTrendMinDays {
+		return nil, false
+	}
+
+	perMinute, _ := linearFit(points)
+	perDay := math.Round(perMinute*24*60*10000) / 10000
+	span := points[len(points)-1].at.Sub(points[0].at).Hours() / 24
+	return &perDay, perDay >= equipmentTrendSlope && perDay*span >= equipmentTrendRise
+}
+
+// EquipmentHealth devuelve las métricas diarias de los últimos days días cerrados, las del
+// día en curso (calculadas al vuelo) y la tendencia del ciclo de trabajo.
+// Devuelve sql.ErrNoRows si la cámara no existe.
+func EquipmentHealth(sensorID string, days int) (models.EquipmentHealth, error) {
+	health := models.EquipmentHealth{SensorID: sensorID, Days: []models.EquipmentDay{}}
+
+	band, err := loadBand(sensorID)
+	if err != nil {
+		return health, err
+	}
+
+	today := localDay(time.Now())
+	stored, err := storedEquipmentDays(sensorID, today.AddDate(0, 0, -days), today)
+	if err != nil {
+		return health, err
+	}
+	health.Days = stored
+
+	current, err := computeEquipmentDay(sensorID, today, band.warning)
+	if err != nil {
+		return health, err
+	}
+	health.Today = &current
+
+	health.DutyCycleTrend, health.TrendRising = dutyCycleTrend(health.Days)
+	return health, nil
+}
+
+// storedEquipmentDays lee las métricas guardadas de los días locales en [from, to)
+func storedEquipmentDays(sensorID string, from, to time.Time) ([]models.EquipmentDay, error) {
+	rows, err := db.DB.Query(`
+		SELECT day, cycle_count, duty_cycle, pull_down_rate, recovery_minutes, recoveries, covered_minutes, readings
+		FROM equipment_daily
+		WHERE sensor_id = ? AND day >= ? AND day < ?
+		ORDER BY day`, sensorID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []models.EquipmentDay{}
+	for rows.Next() {
+		var d models.EquipmentDay
+		var day time.Time
+		var duty, pullDown, recovery sql.NullFloat64
+		if err := rows.Scan(&day, &d.CycleCount, &duty, &pullDown, &recovery, &d.Recoveries, &d.CoveredMinutes, &d.Readings); err != nil {
+			return nil, err
+		}
+		d.Day = day.Format("2006-01-02")
+		for _, f := range []struct {
+			src sql.NullFloat64
+			dst **float64
+		}{{duty, &d.DutyCycle}, {pullDown, &d.PullDownRate}, {recovery, &d.RecoveryMinutes}} {
+			if f.src.Valid {
+				val := f.src.Float64
+				*f.dst = &val
+			}
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// StartEquipmentMonitor guarda cada hora las métricas de los días cerrados que falten y, cuando
+// agrega un día, avisa (maintenanceRequired) si el ciclo de trabajo viene en aumento
+func StartEquipmentMonitor() {
+	go func() {
+		updateEquipmentHealth()
+		ticker := time.NewTicker(time.Hour)
+		for range ticker.C {
+			updateEquipmentHealth()
+		}
+	}()
+}
+
+func updateEquipmentHealth() {
+	bands, err := loadBands("c.is_active = TRUE")
+	if err != nil {
+		fmt.Printf("Error revisando equipos: %v\n", err)
+		return
+	}
+
+	today := localDay(time.Now())
+	for sensorID, band := range bands {
+		stored, err := storedEquipmentDays(sensorID, today.AddDate(0, 0, -equipmentBackfillDays), today)
+		if err != nil {
+			fmt.Printf("Error revisando equipos: %v\n", err)
+			continue
+		}
+		have := make(map[string]bool)
+		for _, d := range stored {
+			have[d.Day] = true
+		}
+
+		added := false
+		for start := today.AddDate(0, 0, -equipmentBackfillDays); start.Before(today); start = start.AddDate(0, 0, 1) {
+			if have[start.Format("2006-01-02")] {
+				continue
+			}
+			day, err := computeEquipmentDay(sensorID, start, band.warning)
+			if err != nil {
+				fmt.Printf("Error calculando equipo de %s: %v\n", sensorID, err)
+				continue
+			}
+			if day.Readings == 0 {
+				continue
+			}
+			if err := saveEquipmentDay(sensorID, day); err != nil {
+				fmt.Printf("Error DB: %v\n", err)
+				continue
+			}
+			added = true
+		}
+		if added {
+			checkDutyCycleTrend(sensorID, today)
+		}
+	}
+}
+
+func saveEquipmentDay(sensorID string, d models.EquipmentDay) error {
+	query := `
+		INSERT INTO equipment_daily (sensor_id, day, cycle_count, duty_cycle, pull_down_rate, recovery_minutes, recoveries, covered_minutes, readings)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE cycle_count = VALUES(cycle_count), duty_cycle = VALUES(duty_cycle), pull_down_rate = VALUES(pull_down_rate),
+			recovery_minutes = VALUES(recovery_minutes), recoveries = VALUES(recoveries), covered_minutes = VALUES(covered_minutes), readings = VALUES(readings)`
+	_, err := db.DB.Exec(query, sensorID, d.Day, d.CycleCount, d.DutyCycle, d.PullDownRate, d.RecoveryMinutes, d.Recoveries, d.CoveredMinutes, d.Readings)
+	return err
+}
+
+// checkDutyCycleTrend evalúa la tendencia de los últimos días cerrados; se llama una vez por
+// día agregado, así que avisa como máximo una vez al día por cámara
+func checkDutyCycleTrend(sensorID string, today time.Time) {
+	days, err := storedEquipmentDays(sensorID, today.AddDate(0, 0, -equipmentTrendDays), today)
+	if err != nil {
+		fmt.Printf("Error revisando equipos: %v\n", err)
+		return
+	}
+	slope, rising := dutyCycleTrend(days)
+	if !rising {
+		return
+	}
+
+	var first, last *models.EquipmentDay
+	for i := range days {
+		if days[i].DutyCycle == nil {
+			continue
+		}
+		if first == nil {
+			first = &days[i]
+		}
+		last = &days[i]
+	}
+
+	action := "Revisar carga de refrigerante, limpieza del condensador y sellos de puertas"
+	raiseAlert(DataPoint{SensorID: sensorID, Timestamp: time.Now()}, liveSink, models.AlertPriorityP3, models.AlertTypeMaintenanceRequired,
+		fmt.Sprintf("TENDENCIA DEL COMPRESOR: %s", sensorID),
+		fmt.Sprintf("El ciclo de trabajo del compresor sube %.1f puntos por día: %.0f%% el %s y %.0f%% el %s. "+
+			"Un compresor que trabaja cada vez más para sostener la temperatura suele indicar pérdida de refrigerante o un condensador sucio",
+			*slope*100, *first.DutyCycle*100, first.Day, *last.DutyCycle*100, last.Day),
+		alertImpact{suggestedAction: &action}, nil)
+}
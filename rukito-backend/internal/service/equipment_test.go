@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+var sawtoothStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func minute(m int) time.Time { return sawtoothStart.Add(time.Duration(m) * time.Minute) }
+
+// sawtooth genera una lectura por minuto de 0 a minutes con ciclos de 15 min: el compresor
+// enfría 5 min de -18 a -23°C (1°C/min) y se detiene 10 min calentando a 0.5°C/min.
+// Los minutos en skip no tienen lectura.
+func sawtooth(minutes int, skip func(m int) bool) []riskPoint {
+	var points []riskPoint
+	for m := 0; m <= minutes; m++ {
+		if skip != nil && skip(m) {
+			continue
+		}
+		temp := -18 - float64(m%15)
+		if m%15 > 5 {
+			temp = -23 + 0.5*float64(m%15-5)
+		}
+		points = append(points, riskPoint{at: minute(m), temp: temp})
+	}
+	return points
+}
+
+func TestInferEquipmentDay(t *testing.T) {
+	between := func(from, to int) func(m int) bool {
+		return func(m int) bool { return m >= from && m <= to }
+	}
+
+	tests := []struct {
+		name     string
+		points   []riskPoint
+		defrosts []defrostSpan
+		cycles   int
+		duty     float64 // redondeado a 4 decimales; 0 = sin ciclo de trabajo
+		readings int
+		covered  float64
+	}{
+		{"no readings", nil, nil, 0, 0, 0, 0},
+		{"noise within the hysteresis", []riskPoint{
+			{minute(0), -20}, {minute(1), -20.1}, {minute(2), -20}, {minute(3), -20.1}, {minute(4), -20},
+		}, nil, 0, 0, 5, 4},
+		// Mínimos en 5, 20, …, 110: el primer enfriamiento empezó antes de la primera lectura y
+		// no se cuenta. 7 encendidos de 5 min y 7 detenciones de 10 min.
+		{"full cycles", sawtooth(120, nil), nil, 7, 0.3333, 121, 120},
+		// Sin lecturas de 31 a 44 se pierde el mínimo de 35 y el primer enfriamiento tras el hueco
+		// (45 a 50) empieza a mitad de camino: quedan los mínimos de 20, 65, 80, 95 y 110
+		{"gap cuts the phase", sawtooth(120, between(31, 44)), nil, 5, 0.3333, 107, 105},
+		// Un descongelamiento corta la fase como un hueco aunque dure menos que equipmentMaxGap:
+		// el calentamiento de 37 a 45 no se cuenta como detención y se pierde el mínimo de 35
+		{"defrost cuts the phase", sawtooth(120, nil), []defrostSpan{{minute(32), minute(36)}}, 6, 0.3333, 116, 114},
+		{"defrost over the whole day", sawtooth(120, nil), []defrostSpan{{minute(0), minute(120)}}, 0, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day := inferEquipmentDay(tt.points, -19, tt.defrosts)
+			if day.CycleCount != tt.cycles {
+				t.Errorf("CycleCount = %d, want %d", day.CycleCount, tt.cycles)
+			}
+			switch {
+			case tt.duty == 0 && day.DutyCycle != nil:
+				t.Errorf("DutyCycle = %v, want nil", *day.DutyCycle)
+			case tt.duty != 0 && day.DutyCycle == nil:
+				t.Errorf("DutyCycle = nil, want %.4f", tt.duty)
+			case tt.duty != 0 && *day.DutyCycle != tt.duty:
+				t.Errorf("DutyCycle = %v, want %.4f", *day.DutyCycle, tt.duty)
+			}
+			if day.Readings != tt.readings {
+				t.Errorf("Readings = %d, want %d", day.Readings, tt.readings)
+			}
+			if day.CoveredMinutes != tt.covered {
+				t.Errorf("CoveredMinutes = %v, want %v", day.CoveredMinutes, tt.covered)
+			}
+		})
+	}
+}
+
+func TestInferEquipmentDayRates(t *testing.T) {
+	// Enfría a 1°C/min y cada pico (-18) vuelve bajo la advertencia (-19) al minuto siguiente;
+	// el pico final de 120 todavía no se recuperó
+	day := inferEquipmentDay(sawtooth(120, nil), -19, nil)
+	if day.PullDownRate == nil || *day.PullDownRate != 1 {
+		t.Errorf("PullDownRate = %v, want 1", day.PullDownRate)
+	}
+	if day.Recoveries != 8 {
+		t.Errorf("Recoveries = %d, want 8", day.Recoveries)
+	}
+	if day.RecoveryMinutes == nil || *day.RecoveryMinutes != 1 {
+		t.Errorf("RecoveryMinutes = %v, want 1", day.RecoveryMinutes)
+	}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// Direcciones de una excursión
+const (
+	ExcursionHigh = "high" // sobre el límite superior del rango seguro
+	ExcursionLow  = "low"  // bajo el límite inferior del rango seguro
+)
+
+// excursionMaxGap es el tiempo sin lecturas tras el cual una excursión abierta
+// se cierra en su última lectura: sin datos no se puede afirmar que siguió fuera de rango
+const excursionMaxGap = 30 * time.Minute
+
+// safeBand es el rango seguro de una cámara, la única fuente de umbrales del pipeline:
+// excursiones, estado de la lectura, alertas, pronóstico y descongelamientos lo comparten.
+// Los límites salen de la configuración de alertas vigente; una cámara sin configuración
+// usa su critical_threshold y no tiene límite inferior.
+type safeBand struct {
+	high             float64
+	low              *float64
+	warning          float64 // warning_threshold de la cámara, nunca sobre high
+	revision         *int    // revisión de alert_configs de la que salen los límites; nil sin configuración
+	alertsEnabled    bool
+	activationEnergy float64 // kJ/mol de la categoría de la cámara, para la MKT
+	forecastLead     *int    // minutos de anticipación del aviso de cruce previsto; nil = por defecto
+}
+
+// loadBands carga el rango seguro de las cámaras que cumplen filter (vacío = todas)
+func loadBands(filter string, args ...interface{}) (map[string]safeBand, error) {
+	query := `
+		SELECT c.id, c.critical_threshold, c.warning_threshold, ac.max_temperature, ac.min_temperature, ac.revision,
+			COALESCE(ac.is_enabled, TRUE), COALESCE(c.content, ''), COALESCE(c.product_category, ''), c.forecast_lead_minutes
+		FROM chambers c
+		LEFT JOIN alert_configs ac ON ac.sensor_id = c.id`
+	if filter != "" {
+		query += " WHERE " + filter
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	energies := loadActivationEnergies()
+	bands := make(map[string]safeBand)
+	for rows.Next() {
+		var chamber models.ColdChamber
+		var band safeBand
+		var high, low sql.NullFloat64
+		var revision, lead sql.NullInt64
+		if err := rows.Scan(&chamber.ID, &band.high, &band.warning, &high, &low, &revision, &band.alertsEnabled,
+			&chamber.Content, &chamber.ProductCategory, &lead); err != nil {
+			return nil, err
+		}
+		if high.Valid && low.Valid {
+			band.high = high.Float64
+			val := low.Float64
+			band.low = &val
+		}
+		if revision.Valid {
+			val := int(revision.Int64)
+			band.revision = &val
+		}
+		band.warning = math.Min(band.warning, band.high)
+		if lead.Valid {
+			val := int(lead.Int64)
+			band.forecastLead = &val
+		}
+		band.activationEnergy = activationEnergyFor(energies, ProductCategoryFor(chamber))
+		bands[chamber.ID] = band
+	}
+	return bands, rows.Err()
+}
+
+// loadBand carga el rango seguro de una cámara; sql.ErrNoRows si no existe
+func loadBand(sensorID string) (safeBand, error) {
+	bands, err := loadBands("c.id = ?", sensorID)
+	if err != nil {
+		return safeBand{}, err
+	}
+	band, ok := bands[sensorID]
+	if !ok {
+		return band, sql.ErrNoRows
+	}
+	return band, nil
+}
+
+// bandCache cachea el rango seguro de cada cámara y lo refresca periódicamente,
+// igual que las calibraciones, para que un cambio de umbrales aplique sin reiniciar.
+// El pipeline usa una sola instancia, así todos sus pasos ven la misma revisión.
+type bandCache struct {
+	current  map[string]safeBand
+	loadedAt time.Time
+	ttl      time.Duration
+}
+
+func newBandCache() *bandCache {
+	return &bandCache{ttl: time.Minute}
+}
+
+func (c *bandCache) refresh() {
+	current, err := loadBands("")
+	if err != nil {
+		fmt.Printf("Error cargando umbrales: %v\n", err)
+		return
+	}
+
+	c.current = current
+	c.loadedAt = time.Now()
+}
+
+func (c *bandCache) get(sensorID string) (safeBand, bool) {
+	if c.current == nil || time.Since(c.loadedAt) > c.ttl {
+		c.refresh()
+	}
+	band, ok := c.current[sensorID]
+	return band, ok
+}
+
+// excess devuelve cuántos grados está temp fuera de la banda (0 si está dentro) y hacia dónde
+func (b safeBand) excess(temp float64) (float64, string, float64) {
+	if temp > b.high {
+		return temp - b.high, ExcursionHigh, b.high
+	}
+	if b.low != nil && temp < *b.low {
+		return *b.low - temp, ExcursionLow, *b.low
+	}
+	return 0, "", 0
+}
+
+// openExcursion es el estado en memoria de una excursión en curso
+type openExcursion struct {
+	id            string
+	sensorID      string
+	direction     string
+	threshold     float64
+	startedAt     time.Time
+	endedAt       *time.Time
+	lastAt        time.Time
+	lastExcess    float64
+	lastTemp      float64
+	peak          float64
+	degreeMinutes float64
+	mkt           mktAccumulator
+	readings      int
+}
+
+// excursionTracker abre una excursión cuando una cámara sale de su rango seguro
+// y la cierra cuando vuelve, acumulando pico, grados-minuto y temperatura cinética media
+type excursionTracker struct {
+	bands     *bandCache
+	open      map[string]*openExcursion
+	resumed   map[string]bool
+	lotChecks map[string]time.Time // última evaluación de lotes por excursión
+}
+
+func newExcursionTracker(bands *bandCache) *excursionTracker {
+	return &excursionTracker{bands: bands, open: make(map[string]*openExcursion), resumed: make(map[string]bool), lotChecks: make(map[string]time.Time)}
+}
+
+// observe procesa una lectura válida (ya calibrada y en orden). Durante un descongelamiento
+// reconocido no se abren excursiones: se calienta el aire y no el producto; una ya abierta sigue.
+func (t *excursionTracker) observe(dp DataPoint, sink dataSink, defrosting bool) {
+	band, ok := t.bands.get(dp.SensorID)
+	if !ok {
+		return
+	}
+
+	// Tras un reinicio se retoma la excursión que quedó abierta en la base
+	if !t.resumed[dp.SensorID] {
+		t.resumed[dp.SensorID] = true
+		if e := sink.loadOpenExcursion(dp.SensorID); e != nil {
+			t.open[dp.SensorID] = e
+		}
+	}
+
+	e := t.open[dp.SensorID]
+	if e != nil && dp.Timestamp.Sub(e.lastAt) > excursionMaxGap {
+		t.close(e, DataPoint{SensorID: e.sensorID, Temperature: e.lastTemp, Timestamp: e.lastAt}, sink)
+		e = nil
+	}
+
+	excess, direction, threshold := band.excess(dp.Temperature)
+
+	// Un cruce directo de un extremo al otro cierra la excursión y abre otra
+	if e != nil && excess > 0 && direction != e.direction {
+		t.close(e, dp, sink)
+		e = nil
+	}
+
+	// Un descongelamiento calienta el aire y no el producto: no abre excursiones nuevas,
+	// pero una que ya estaba abierta sigue acumulando
+	if defrosting && e == nil {
+		return
+	}
+
+	switch {
+	case excess > 0 && e == nil:
+		e = &openExcursion{
+			id:         "EXC-" + uuid.New().String()[:8],
+			sensorID:   dp.SensorID,
+			direction:  direction,
+			threshold:  threshold,
+			startedAt:  dp.Timestamp,
+			lastAt:     dp.Timestamp,
+			lastExcess: excess,
+			lastTemp:   dp.Temperature,
+			peak:       dp.Temperature,
+			mkt:        mktAccumulator{activationEnergy: band.activationEnergy},
+			readings:   1,
+		}
+		t.open[dp.SensorID] = e
+		fmt.Printf("🌡️ EXCURSIÓN ABIERTA: %s (%.1f°C)\n", dp.SensorID, dp.Temperature)
+		t.save(e, sink)
+		t.checkLots(e, dp, sink, false)
+
+	case excess > 0:
+		e.accumulate(dp.Timestamp, excess, dp.Temperature)
+		if (direction == ExcursionHigh && dp.Temperature > e.peak) || (direction == ExcursionLow && dp.Temperature < e.peak) {
+			e.peak = dp.Temperature
+		}
+		e.readings++
+		t.save(e, sink)
+		t.checkLots(e, dp, sink, false)
+
+	case e != nil:
+		// La primera lectura de vuelta en rango cierra la excursión
+		e.accumulate(dp.Timestamp, 0, dp.Temperature)
+		t.close(e, dp, sink)
+	}
+}
+
+// checkLots pone en cuarentena los lotes que la excursión dejó fuera de los límites de su
+// producto. Se evalúa cada lotCheckEvery y al cerrar; los replays no modifican lotes.
+func (t *excursionTracker) checkLots(e *openExcursion, dp DataPoint, sink dataSink, closing bool) {
+	if sink.runID != "" {
+		return
+	}
+	if closing {
+		delete(t.lotChecks, e.id)
+	} else {
+		if last, ok := t.lotChecks[e.id]; ok && dp.Timestamp.Sub(last) < lotCheckEvery {
+			return
+		}
+		t.lotChecks[e.id] = dp.Timestamp
+	}
+	quarantineExposedLots(e.sensorID, e.id, dp)
+}
+
+// accumulate suma los grados-minuto y la MKT desde la lectura anterior (regla del trapecio)
+func (e *openExcursion) accumulate(at time.Time, excess, temp float64) {
+	if minutes := at.Sub(e.lastAt).Minutes(); minutes > 0 {
+		e.degreeMinutes += (e.lastExcess + excess) / 2 * minutes
+		e.mkt.add(e.lastTemp, temp, minutes)
+	}
+	e.lastAt = at
+	e.lastExcess = excess
+	e.lastTemp = temp
+}
+
+// mktValue devuelve la MKT de la excursión; con una sola lectura es esa temperatura
+func (e *openExcursion) mktValue() float64 {
+	if mkt, ok := e.mkt.value(); ok {
+		return mkt
+	}
+	return e.lastTemp
+}
+
+// close cierra la excursión en la lectura end (la última fuera de rango si hubo un hueco).
+// Todo cierre pasa por aquí, para que siempre se evalúen los lotes por última vez.
+func (t *excursionTracker) close(e *openExcursion, end DataPoint, sink dataSink) {
+	at := end.Timestamp
+	e.endedAt = &at
+	delete(t.open, e.sensorID)
+	t.save(e, sink)
+	fmt.Printf("✅ EXCURSIÓN CERRADA: %s (%s, pico %.1f°C, %.1f °C·min)\n", e.sensorID, at.Sub(e.startedAt).Round(time.Second), e.peak, e.degreeMinutes)
+	t.checkLots(e, end, sink, true)
+}
+
+func (t *excursionTracker) save(e *openExcursion, sink dataSink) {
+	if err := sink.saveExcursion(e); err != nil {
+		fmt.Printf("Error DB: %v\n", err)
+	}
+}
+
+// saveExcursion crea o actualiza la excursión. Los replays no registran excursiones.
+func (s dataSink) saveExcursion(e *openExcursion) error {
+	if s.runID != "" {
+		return nil
+	}
+
+	query := `
+		INSERT INTO excursions (id, sensor_id, direction, threshold, started_at, ended_at, last_reading_at, peak_temperature, degree_minutes, mkt, activation_energy, reading_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE ended_at = VALUES(ended_at), last_reading_at = VALUES(last_reading_at),
+			peak_temperature = VALUES(peak_temperature), degree_minutes = VALUES(degree_minutes), mkt = VALUES(mkt), reading_count = VALUES(reading_count)`
+	_, err := db.DB.Exec(query, e.id, e.sensorID, e.direction, e.threshold, e.startedAt, e.endedAt, e.lastAt, e.peak, e.degreeMinutes,
+		e.mktValue(), e.mkt.activationEnergy, e.readings)
+	return err
+}
+
+// loadOpenExcursion devuelve la excursión sin cerrar de un sensor, si existe
+func (s dataSink) loadOpenExcursion(sensorID string) *openExcursion {
+	if s.runID != "" {
+		return nil
+	}
+
+	e := &openExcursion{sensorID: sensorID}
+	var mkt, activationEnergy sql.NullFloat64
+	err := db.DB.QueryRow(`
+		SELECT id, direction, threshold, started_at, last_reading_at, peak_temperature, degree_minutes, mkt, activation_energy, reading_count
+		FROM excursions
+		WHERE sensor_id = ? AND ended_at IS NULL
+		ORDER BY started_at DESC
+		LIMIT 1`, sensorID).Scan(&e.id, &e.direction, &e.threshold, &e.startedAt, &e.lastAt, &e.peak, &e.degreeMinutes, &mkt, &activationEnergy, &e.readings)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error cargando excursión abierta de %s: %v\n", sensorID, err)
+		}
+		return nil
+	}
+	// El exceso de la última lectura no se guarda; se aproxima con el pico
+	e.lastExcess = e.peak - e.threshold
+	if e.direction == ExcursionLow {
+		e.lastExcess = e.threshold - e.peak
+	}
+	e.lastTemp = e.peak
+	e.mkt.activationEnergy = DefaultActivationEnergy
+	if activationEnergy.Valid {
+		e.mkt.activationEnergy = activationEnergy.Float64
+	}
+	if mkt.Valid {
+		e.mkt.resume(mkt.Float64, e.lastAt.Sub(e.startedAt).Minutes())
+	}
+	return e
+}
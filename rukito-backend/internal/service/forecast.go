@@ -0,0 +1,259 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// Parámetros del pronóstico de tiempo hasta umbral
+const (
+	forecastWindow      = 30 * time.Minute // tendencia reciente sobre la que se ajusta
+	forecastMinReadings = 6
+	forecastMinSpan     = 5 * time.Minute
+	forecastHorizon     = 24 * time.Hour // un cruce más lejano no se considera previsto
+	forecastEvery       = time.Minute    // cada cuánto (en tiempo de las lecturas) se reajusta en el pipeline
+	forecastStableSlope = 0.001          // °C/min; con una pendiente menor la cámara se considera estable
+	forecastMinRise     = 0.05           // °C entre tercios de la ventana para ajustar una exponencial y no ruido
+	predictedAlertEvery = 30 * time.Minute
+)
+
+// defaultForecastLead es la anticipación del aviso de cruce previsto para cámaras sin una propia
+func defaultForecastLead() time.Duration {
+	if m, err := strconv.Atoi(os.Getenv("FORECAST_LEAD_MINUTES")); err == nil && m > 0 {
+		return time.Duration(m) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// fitForecast ajusta la tendencia de points (en orden, dentro de forecastWindow) y estima los
+// minutos hasta cada umbral. Prefiere un acercamiento exponencial a una asíntota (el calentamiento
+// típico tras abrir una puerta o una falla del compresor) y si no, una recta.
+func fitForecast(sensorID string, points []riskPoint, warning, critical float64) models.Forecast {
+	f := models.Forecast{
+		SensorID:          sensorID,
+		Model:             models.ForecastInsufficient,
+		WarningThreshold:  warning,
+		CriticalThreshold: critical,
+		Readings:          len(points),
+	}
+	if len(points) == 0 {
+		return f
+	}
+	last := points[len(points)-1]
+	f.At = last.at
+	f.Temperature = last.temp
+	if len(points) < forecastMinReadings || last.at.Sub(points[0].at) < forecastMinSpan {
+		return f
+	}
+
+	slope, intercept := linearFit(points)
+	f.SlopePerMinute = slope
+
+	var minutesTo func(threshold float64) *float64
+	if asymptote, ratio, step, now, ok := exponentialFit(points); ok {
+		f.Model = models.ForecastExponential
+		f.Asymptote = &asymptote
+		minutesTo = func(threshold float64) *float64 {
+			if threshold >= asymptote {
+				return nil
+			}
+			val := 0.0
+			if threshold > now {
+				val = step * math.Log((asymptote-threshold)/(asymptote-now)) / math.Log(ratio)
+			}
+			return &val
+		}
+	} else if slope > forecastStableSlope {
+		f.Model = models.ForecastLinear
+		now := intercept + slope*last.at.Sub(points[0].at).Minutes()
+		minutesTo = func(threshold float64) *float64 {
+			val := math.Max((threshold-now)/slope, 0)
+			return &val
+		}
+	} else {
+		f.Model = models.ForecastStable
+	}
+
+	eta := func(threshold float64) *float64 {
+		if last.temp >= threshold {
+			zero := 0.0
+			return &zero
+		}
+		if minutesTo == nil {
+			return nil
+		}
+		m := minutesTo(threshold)
+		if m == nil || *m > forecastHorizon.Minutes() {
+			return nil
+		}
+		return m
+	}
+	f.MinutesToWarning = eta(warning)
+	f.MinutesToCritical = eta(critical)
+	return f
+}
+
+// linearFit ajusta una recta por mínimos cuadrados (t en minutos desde la primera lectura)
+func linearFit(points []riskPoint) (slope, intercept float64) {
+	var sumT, sumY, sumTT, sumTY float64
+	n := float64(len(points))
+	for _, p := range points {
+		t := p.at.Sub(points[0].at).Minutes()
+		sumT += t
+		sumY += p.temp
+		sumTT += t * t
+		sumTY += t * p.temp
+	}
+	if den := n*sumTT - sumT*sumT; den != 0 {
+		slope = (n*sumTY - sumT*sumY) / den
+	}
+	intercept = (sumY - slope*sumT) / n
+	return slope, intercept
+}
+
+// exponentialFit ajusta T(t) = A + B·r^(t/step) con el método de los tres promedios: la ventana se
+// divide en tres tercios de duración step y sus promedios y1, y2, y3 dan r = (y3-y2)/(y2-y1).
+// Solo aplica a un calentamiento que se desacelera (0 < r < 1). Devuelve la asíntota A, r, step
+// en minutos y la temperatura ajustada en la última lectura.
+func exponentialFit(points []riskPoint) (asymptote, ratio, step, now float64, ok bool) {
+	start := points[0].at
+	span := points[len(points)-1].at.Sub(start)
+	step = span.Minutes() / 3
+
+	var sums, counts [3]float64
+	for _, p := range points {
+		i := int(float64(p.at.Sub(start)) / float64(span) * 3)
+		if i > 2 {
+			i = 2
+		}
+		sums[i] += p.temp
+		counts[i]++
+	}
+	for _, c := range counts {
+		if c < 2 {
+			return 0, 0, 0, 0, false
+		}
+	}
+	y1, y2, y3 := sums[0]/counts[0], sums[1]/counts[1], sums[2]/counts[2]
+	if y2-y1 < forecastMinRise || y3-y2 <= 0 {
+		return 0, 0, 0, 0, false
+	}
+	ratio = (y3 - y2) / (y2 - y1)
+	if ratio >= 1 {
+		return 0, 0, 0, 0, false
+	}
+
+	asymptote = y1 + (y2-y1)/(1-ratio)
+	// y1 corresponde al centro del primer tercio
+	elapsed := span.Minutes() - step/2
+	now = asymptote + (y1-asymptote)*math.Pow(ratio, elapsed/step)
+	return asymptote, ratio, step, now, true
+}
+
+// ForecastChamber pronostica una cámara con sus lecturas válidas más recientes
+func ForecastChamber(sensorID string) (models.Forecast, error) {
+	band, err := loadBand(sensorID)
+	if err != nil {
+		return models.Forecast{}, err
+	}
+
+	// La ventana se ancla en la última lectura, así una sonda que dejó de reportar no se pronostica con el reloj
+	var lastAt sql.NullTime
+	err = db.DB.QueryRow(`SELECT MAX(timestamp) FROM temperature_readings WHERE sensor_id = ? AND quality = 'OK'`, sensorID).Scan(&lastAt)
+	if err != nil {
+		return models.Forecast{}, err
+	}
+	if !lastAt.Valid {
+		return fitForecast(sensorID, nil, band.warning, band.high), nil
+	}
+
+	points, err := liveSink.riskPoints(sensorID, lastAt.Time.Add(-forecastWindow), lastAt.Time)
+	if err != nil {
+		return models.Forecast{}, err
+	}
+	return fitForecast(sensorID, points, band.warning, band.high), nil
+}
+
+// forecaster mantiene la ventana reciente de cada cámara en el pipeline y avisa cuando la
+// tendencia prevé cruzar un umbral antes de la anticipación configurada
+type forecaster struct {
+	bands       *bandCache
+	defaultLead time.Duration
+	points      map[string][]riskPoint
+	lastFit     map[string]time.Time
+	lastAlert   map[string]time.Time
+}
+
+func newForecaster(bands *bandCache) *forecaster {
+	return &forecaster{
+		bands:       bands,
+		defaultLead: defaultForecastLead(),
+		points:      make(map[string][]riskPoint),
+		lastFit:     make(map[string]time.Time),
+		lastAlert:   make(map[string]time.Time),
+	}
+}
+
+// observe procesa una lectura válida (ya calibrada y en orden)
+func (f *forecaster) observe(dp DataPoint, sink dataSink) {
+	band, ok := f.bands.get(dp.SensorID)
+	if !ok {
+		return
+	}
+
+	points := append(f.points[dp.SensorID], riskPoint{at: dp.Timestamp, temp: dp.Temperature})
+	cutoff := dp.Timestamp.Add(-forecastWindow)
+	i := 0
+	for i < len(points) && points[i].at.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		points = append([]riskPoint(nil), points[i:]...)
+	}
+	f.points[dp.SensorID] = points
+
+	if last, ok := f.lastFit[dp.SensorID]; ok && dp.Timestamp.Sub(last) < forecastEvery {
+		return
+	}
+	f.lastFit[dp.SensorID] = dp.Timestamp
+
+	lead := f.defaultLead
+	if band.forecastLead != nil {
+		lead = time.Duration(*band.forecastLead) * time.Minute
+	}
+
+	// Se avisa el umbral más severo que se cruzaría dentro de la anticipación; uno ya superado
+	// lo cubren las alertas de umbral
+	fc := fitForecast(dp.SensorID, points, band.warning, band.high)
+	level, threshold, eta := "", 0.0, (*float64)(nil)
+	switch {
+	case fc.MinutesToCritical != nil && *fc.MinutesToCritical > 0 && *fc.MinutesToCritical <= lead.Minutes():
+		level, threshold, eta = "crítico", fc.CriticalThreshold, fc.MinutesToCritical
+	case fc.MinutesToWarning != nil && *fc.MinutesToWarning > 0 && *fc.MinutesToWarning <= lead.Minutes():
+		level, threshold, eta = "de advertencia", fc.WarningThreshold, fc.MinutesToWarning
+	default:
+		return
+	}
+
+	if last, ok := f.lastAlert[dp.SensorID]; ok && dp.Timestamp.Sub(last) < predictedAlertEvery {
+		return
+	}
+	f.lastAlert[dp.SensorID] = dp.Timestamp
+
+	trend := fmt.Sprintf("tendencia lineal de %+.2f°C/min", fc.SlopePerMinute)
+	if fc.Model == models.ForecastExponential {
+		trend = fmt.Sprintf("acercamiento exponencial a %.1f°C", *fc.Asymptote)
+	}
+	action := "Revisar puertas, carga y compresor antes del cruce"
+	raiseAlert(dp, sink, models.AlertPriorityP2, models.AlertTypeTemperatureWarning,
+		fmt.Sprintf("CRUCE PREVISTO: %s", dp.SensorID),
+		fmt.Sprintf("Con %.1f°C alcanzará el umbral %s (%.1f°C) en ~%.0f min (%s)", dp.Temperature, level, threshold, *eta, trend),
+		alertImpact{suggestedAction: &action}, band.revision)
+}
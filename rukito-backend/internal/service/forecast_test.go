@@ -0,0 +1,81 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// sampled muestrea temp(t) (t en minutos) cada every minutos durante span minutos
+func sampled(span, every float64, temp func(t float64) float64) []riskPoint {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var points []riskPoint
+	for t := 0.0; t <= span+1e-9; t += every {
+		points = append(points, riskPoint{at: start.Add(time.Duration(t * float64(time.Minute))), temp: temp(t)})
+	}
+	return points
+}
+
+func TestFitForecast(t *testing.T) {
+	eta := func(m float64) *float64 { return &m }
+
+	tests := []struct {
+		name      string
+		points    []riskPoint
+		warning   float64
+		critical  float64
+		model     string
+		toWarning *float64
+		toCrit    *float64
+		tolerance float64
+	}{
+		{"no readings", nil, -18, -15, models.ForecastInsufficient, nil, nil, 0},
+		{"too few readings", sampled(4, 1, func(t float64) float64 { return -20 + t }), -18, -15,
+			models.ForecastInsufficient, nil, nil, 0},
+		{"too short a span", sampled(3, 0.5, func(t float64) float64 { return -20 + t }), -18, -15,
+			models.ForecastInsufficient, nil, nil, 0},
+		{"stable", sampled(20, 1, func(float64) float64 { return -20 }), -18, -15,
+			models.ForecastStable, nil, nil, 0},
+		{"cooling", sampled(20, 1, func(t float64) float64 { return -15 - 0.1*t }), -10, -5,
+			models.ForecastStable, nil, nil, 0},
+		// -20 + 0.25·t: en t = 20 está en -15, llega a -10 en 20 min más y a -5 en 40
+		{"linear", sampled(20, 1, func(t float64) float64 { return -20 + 0.25*t }), -10, -5,
+			models.ForecastLinear, eta(20), eta(40), 1e-6},
+		{"linear beyond the horizon", sampled(20, 1, func(t float64) float64 { return -20 + 0.002*t }), -10, -5,
+			models.ForecastLinear, nil, nil, 0},
+		// -20·e^(-t/10) tiende a 0: cruza -0.5 en t = 10·ln 40 ≈ 36.89 y -0.2 en t = 10·ln 100 ≈ 46.05;
+		// la última lectura es t = 29.5
+		{"exponential", sampled(29.5, 0.5, func(t float64) float64 { return -20 * math.Exp(-t/10) }), -0.5, -0.2,
+			models.ForecastExponential, eta(10*math.Log(40) - 29.5), eta(10*math.Log(100) - 29.5), 0.5},
+		{"exponential never reaches", sampled(29.5, 0.5, func(t float64) float64 { return -20 * math.Exp(-t/10) }), 1, 2,
+			models.ForecastExponential, nil, nil, 0},
+		{"already above", sampled(20, 1, func(t float64) float64 { return -20 + 0.25*t }), -16, -15,
+			models.ForecastLinear, eta(0), eta(0), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := fitForecast("CF-1", tt.points, tt.warning, tt.critical)
+			if f.Model != tt.model {
+				t.Fatalf("Model = %q, want %q", f.Model, tt.model)
+			}
+			if f.Readings != len(tt.points) {
+				t.Errorf("Readings = %d, want %d", f.Readings, len(tt.points))
+			}
+			check := func(field string, got, want *float64) {
+				switch {
+				case want == nil && got != nil:
+					t.Errorf("%s = %v, want nil", field, *got)
+				case want != nil && got == nil:
+					t.Errorf("%s = nil, want %v", field, *want)
+				case want != nil && math.Abs(*got-*want) > tt.tolerance:
+					t.Errorf("%s = %v, want %v ± %v", field, *got, *want, tt.tolerance)
+				}
+			}
+			check("MinutesToWarning", f.MinutesToWarning, tt.toWarning)
+			check("MinutesToCritical", f.MinutesToCritical, tt.toCrit)
+		})
+	}
+}
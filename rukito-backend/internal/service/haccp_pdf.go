@@ -0,0 +1,412 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/models"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Márgenes y alturas del PDF (mm, A4 vertical)
+const (
+	pdfMargin     = 15.0
+	pdfWidth      = 210.0 - 2*pdfMargin
+	pdfRowHeight  = 6.0
+	pdfPageBottom = 297.0 - 20.0
+	pdfChartH     = 70.0
+)
+
+// pdfColumn es una columna de tabla: título y ancho en mm
+type pdfColumn struct {
+	title string
+	width float64
+	align string
+}
+
+// haccpPDF agrupa el documento y el traductor a cp1252 de las fuentes base
+type haccpPDF struct {
+	pdf *gofpdf.Fpdf
+	tr  func(string) string
+	tz  *time.Location
+}
+
+func (h *haccpPDF) font(style string, size float64) {
+	h.pdf.SetFont("Helvetica", style, size)
+}
+
+func (h *haccpPDF) text(w float64, s, align string) {
+	h.pdf.CellFormat(w, pdfRowHeight, h.tr(s), "", 0, align, false, 0, "")
+}
+
+func (h *haccpPDF) section(title string) {
+	h.ensureSpace(3 * pdfRowHeight)
+	h.pdf.Ln(4)
+	h.font("B", 12)
+	h.pdf.CellFormat(pdfWidth, 8, h.tr(title), "B", 1, "L", false, 0, "")
+	h.pdf.Ln(2)
+}
+
+func (h *haccpPDF) ensureSpace(height float64) bool {
+	if h.pdf.GetY()+height > pdfPageBottom {
+		h.pdf.AddPage()
+		return true
+	}
+	return false
+}
+
+func (h *haccpPDF) tableHeader(cols []pdfColumn) {
+	// El encabezado siempre va en negro, aunque la fila que lo repite esté resaltada
+	r, g, b := h.pdf.GetTextColor()
+	defer h.pdf.SetTextColor(r, g, b)
+	h.pdf.SetTextColor(0, 0, 0)
+
+	h.font("B", 9)
+	h.pdf.SetFillColor(225, 232, 240)
+	for _, c := range cols {
+		h.pdf.CellFormat(c.width, pdfRowHeight, h.tr(c.title), "1", 0, "C", true, 0, "")
+	}
+	h.pdf.Ln(-1)
+	h.font("", 9)
+}
+
+// tableRow escribe una fila y repite el encabezado si salta de página
+func (h *haccpPDF) tableRow(cols []pdfColumn, values []string) {
+	if h.ensureSpace(pdfRowHeight) {
+		h.tableHeader(cols)
+	}
+	for i, c := range cols {
+		h.pdf.CellFormat(c.width, pdfRowHeight, h.tr(values[i]), "1", 0, c.align, false, 0, "")
+	}
+	h.pdf.Ln(-1)
+}
+
+func (h *haccpPDF) local(t time.Time) string {
+	return t.In(h.tz).Format("2006-01-02 15:04")
+}
+
+func formatTemp(t float64) string {
+	return fmt.Sprintf("%.1f °C", t)
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%d min", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%d h %02d min", int(d.Hours()), int(d.Minutes())%60)
+}
+
+var alertPriorityLabels = []string{"P1 - Crítica", "P2 - Alta", "P3 - Media"}
+
+// WritePDF genera el registro HACCP: datos de la cámara, gráfico con bandas de
+// umbral, resumen diario, excursiones, historial de alertas y bloque de firmas
+func (rep *HACCPReport) WritePDF(w io.Writer) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AliasNbPages("")
+	pdf.SetTitle("Registro HACCP "+rep.ChamberID, true)
+	pdf.SetCreator("Rukito", true)
+
+	h := &haccpPDF{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor(""), tz: rep.Timezone}
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		h.font("I", 8)
+		h.text(pdfWidth/2, fmt.Sprintf("%s · %s a %s", rep.ChamberID, h.local(rep.Start), h.local(rep.End)), "L")
+		h.text(pdfWidth/2, fmt.Sprintf("Página %d de {nb}", pdf.PageNo()), "R")
+	})
+
+	pdf.AddPage()
+	rep.writeHeader(h)
+	rep.writeChart(h)
+	rep.writeDays(h)
+	rep.writeExcursions(h)
+	rep.writeActions(h)
+	rep.writeAlerts(h)
+	rep.writeSignatures(h)
+
+	return pdf.Output(w)
+}
+
+func (rep *HACCPReport) writeHeader(h *haccpPDF) {
+	h.font("B", 16)
+	h.pdf.CellFormat(pdfWidth, 10, h.tr("Registro de Temperaturas - HACCP"), "", 1, "C", false, 0, "")
+	h.font("", 10)
+	h.pdf.CellFormat(pdfWidth, 6, h.tr(fmt.Sprintf("Período: %s a %s (%s)", h.local(rep.Start), h.local(rep.End), rep.Timezone)), "", 1, "C", false, 0, "")
+	h.pdf.Ln(4)
+
+	minAllowed := "-"
+	if rep.MinAllowed != nil {
+		minAllowed = formatTemp(*rep.MinAllowed)
+	}
+	info := [][2]string{
+		{"Cámara", rep.ChamberName + " (" + rep.ChamberID + ")"},
+		{"Local", rep.Location},
+		{"Contenido", rep.Content},
+		{"Temperatura objetivo", formatTemp(rep.Target)},
+		{"Límite de advertencia", formatTemp(rep.Warning)},
+		{"Límite crítico", formatTemp(rep.Critical)},
+		{"Mínimo permitido", minAllowed},
+	}
+	for _, row := range info {
+		h.font("B", 10)
+		h.text(50, row[0]+":", "L")
+		h.font("", 10)
+		h.text(pdfWidth-50, row[1], "L")
+		h.pdf.Ln(-1)
+	}
+
+	h.section("Resumen")
+	summary := [][2]string{
+		{"Lecturas válidas", fmt.Sprintf("%d (%d sospechosas excluidas)", rep.Readings, rep.Suspect)},
+		{"Tiempo fuera de rango", fmt.Sprintf("%s en %d excursiones", formatDuration(rep.TimeOutOfRange()), len(rep.Excursions))},
+		{"Sin acción correctiva", fmt.Sprintf("%d de %d excursiones", rep.MissingActions(), len(rep.Excursions))},
+		{"Valor expuesto", fmt.Sprintf("$%.2f (inventario al inicio de cada excursión)", rep.ExposedValue())},
+		{"Alertas", fmt.Sprintf("%d", rep.TotalAlerts)},
+	}
+	if rep.Readings > 0 {
+		summary = append(summary, [2]string{"Mín / Prom / Máx", fmt.Sprintf("%s / %s / %s", formatTemp(rep.Min), formatTemp(rep.Avg), formatTemp(rep.Max))})
+	}
+	for _, row := range summary {
+		h.font("B", 10)
+		h.text(50, row[0]+":", "L")
+		h.font("", 10)
+		h.text(pdfWidth-50, row[1], "L")
+		h.pdf.Ln(-1)
+	}
+}
+
+// writeChart dibuja el rango mín-máx y el promedio por intervalo sobre las
+// bandas de advertencia y críticas
+func (rep *HACCPReport) writeChart(h *haccpPDF) {
+	h.section("Gráfico de temperatura")
+	if rep.Readings == 0 {
+		h.font("I", 10)
+		h.text(pdfWidth, "Sin lecturas válidas en el período.", "L")
+		h.pdf.Ln(-1)
+		return
+	}
+	h.ensureSpace(pdfChartH + 12)
+
+	pdf := h.pdf
+	left := pdfMargin + 12
+	top := pdf.GetY()
+	width := pdfWidth - 12
+	height := pdfChartH
+
+	lo := math.Min(rep.Min, rep.Target)
+	hi := math.Max(rep.Max, rep.Critical)
+	if rep.MinAllowed != nil {
+		lo = math.Min(lo, *rep.MinAllowed)
+	}
+	lo, hi = math.Floor(lo-1), math.Ceil(hi+1)
+
+	y := func(t float64) float64 { return top + height - (t-lo)/(hi-lo)*height }
+	span := rep.End.Sub(rep.Start).Seconds()
+	x := func(t time.Time) float64 { return left + t.Sub(rep.Start).Seconds()/span*width }
+
+	// Bandas: advertencia (amarillo) y fuera de límite (rojo)
+	pdf.SetFillColor(255, 243, 205)
+	pdf.Rect(left, y(rep.Critical), width, y(rep.Warning)-y(rep.Critical), "F")
+	pdf.SetFillColor(248, 215, 218)
+	pdf.Rect(left, top, width, y(rep.Critical)-top, "F")
+	if rep.MinAllowed != nil {
+		pdf.Rect(left, y(*rep.MinAllowed), width, top+height-y(*rep.MinAllowed), "F")
+	}
+
+	// Eje Y
+	h.font("", 7)
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.SetLineWidth(0.1)
+	stepY := math.Max(1, math.Ceil((hi-lo)/6))
+	for t := lo; t <= hi; t += stepY {
+		pdf.Line(left, y(t), left+width, y(t))
+		pdf.SetXY(pdfMargin, y(t)-2)
+		pdf.CellFormat(11, 4, fmt.Sprintf("%.0f", t), "", 0, "R", false, 0, "")
+	}
+
+	// Eje X: hasta 8 marcas
+	for i := 0; i <= 7; i++ {
+		t := rep.Start.Add(time.Duration(float64(rep.End.Sub(rep.Start)) * float64(i) / 7))
+		pdf.SetXY(x(t)-10, top+height+1)
+		pdf.CellFormat(20, 4, t.In(h.tz).Format("02/01 15:04"), "", 0, "C", false, 0, "")
+	}
+
+	// Objetivo
+	pdf.SetDrawColor(40, 150, 70)
+	pdf.SetLineWidth(0.3)
+	pdf.SetDashPattern([]float64{1.5, 1}, 0)
+	pdf.Line(left, y(rep.Target), left+width, y(rep.Target))
+	pdf.SetDashPattern([]float64{}, 0)
+
+	// Rango mín-máx de cada intervalo y línea del promedio
+	pdf.SetFillColor(180, 205, 235)
+	pdf.SetDrawColor(30, 80, 160)
+	pdf.SetLineWidth(0.3)
+	var prev *haccpPoint
+	for i := range rep.points {
+		p := &rep.points[i]
+		if p.Count == 0 {
+			prev = nil // un hueco sin lecturas corta la línea
+			continue
+		}
+		if prev != nil {
+			x0, x1 := x(prev.At), x(p.At)
+			pdf.Polygon([]gofpdf.PointType{{X: x0, Y: y(prev.Max)}, {X: x1, Y: y(p.Max)}, {X: x1, Y: y(p.Min)}, {X: x0, Y: y(prev.Min)}}, "F")
+			pdf.Line(x0, y(prev.Avg), x1, y(p.Avg))
+		}
+		prev = p
+	}
+
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.SetLineWidth(0.2)
+	pdf.Rect(left, top, width, height, "D")
+
+	pdf.SetXY(pdfMargin, top+height+6)
+	h.font("I", 8)
+	h.text(pdfWidth, "Azul: promedio y rango mín-máx por intervalo · Verde: objetivo · Amarillo: advertencia · Rojo: fuera de límite", "L")
+	pdf.Ln(-1)
+}
+
+func (rep *HACCPReport) writeDays(h *haccpPDF) {
+	h.section("Resumen diario")
+	cols := []pdfColumn{
+		{"Fecha", 40, "C"}, {"Mínima", 28, "R"}, {"Promedio", 28, "R"}, {"Máxima", 28, "R"},
+		{"Lecturas", 28, "R"}, {"Fuera de rango", 28, "R"},
+	}
+	h.tableHeader(cols)
+	for _, d := range rep.Days {
+		h.tableRow(cols, []string{d.Date, formatTemp(d.Min), formatTemp(d.Avg), formatTemp(d.Max),
+			fmt.Sprintf("%d", d.Readings), fmt.Sprintf("%d", d.OutOfRange)})
+	}
+}
+
+func (rep *HACCPReport) writeExcursions(h *haccpPDF) {
+	h.section("Excursiones fuera de límite")
+	if len(rep.Excursions) == 0 {
+		h.font("I", 10)
+		h.text(pdfWidth, "No hubo excursiones en el período.", "L")
+		h.pdf.Ln(-1)
+		return
+	}
+
+	cols := []pdfColumn{
+		{"Inicio", 30, "C"}, {"Fin", 30, "C"}, {"Duración", 24, "R"}, {"Pico", 20, "R"}, {"Tipo", 16, "C"}, {"Valor", 20, "R"}, {"Acción correctiva", 40, "L"},
+	}
+	h.tableHeader(cols)
+	for _, e := range rep.Excursions {
+		end := h.local(e.End)
+		if e.Ongoing {
+			end += " *"
+		}
+		kind := "Alta"
+		if !e.High {
+			kind = "Baja"
+		}
+
+		// Las excursiones sin acción documentada se marcan en rojo
+		action := "FALTA ACCIÓN CORRECTIVA"
+		if len(e.Actions) > 0 {
+			last := e.Actions[len(e.Actions)-1]
+			action = truncate(dispositionLabels[last.Disposition]+": "+last.Action, 25)
+		} else {
+			h.pdf.SetTextColor(200, 30, 30)
+		}
+		h.tableRow(cols, []string{h.local(e.Start), end, formatDuration(e.Duration()), formatTemp(e.Peak), kind, fmt.Sprintf("$%.2f", e.ExposedValue), action})
+		h.pdf.SetTextColor(0, 0, 0)
+	}
+	h.font("I", 8)
+	h.text(pdfWidth, "* Seguía fuera de rango al cierre del período.", "L")
+	h.pdf.Ln(-1)
+}
+
+var dispositionLabels = map[string]string{
+	models.DispositionKept:      "Conservado",
+	models.DispositionMoved:     "Trasladado",
+	models.DispositionDiscarded: "Descartado",
+}
+
+func (rep *HACCPReport) writeActions(h *haccpPDF) {
+	if len(rep.Actions) == 0 {
+		return
+	}
+	h.section("Acciones correctivas")
+
+	cols := []pdfColumn{{"Fecha", 30, "C"}, {"Responsable", 32, "L"}, {"Producto", 24, "C"}, {"Acción", 94, "L"}}
+	h.tableHeader(cols)
+	for _, a := range rep.Actions {
+		h.tableRow(cols, []string{h.local(a.PerformedAt), truncate(a.PerformedBy, 18), dispositionLabels[a.Disposition], truncate(a.Action, 60)})
+	}
+}
+
+// truncate corta s a n caracteres (runas) agregando "..."
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func (rep *HACCPReport) writeAlerts(h *haccpPDF) {
+	h.section("Historial de alertas")
+	if len(rep.Alerts) == 0 {
+		h.font("I", 10)
+		h.text(pdfWidth, "No hubo alertas en el período.", "L")
+		h.pdf.Ln(-1)
+		return
+	}
+
+	cols := []pdfColumn{{"Fecha", 32, "C"}, {"Prioridad", 26, "C"}, {"Alerta", 108, "L"}, {"Leída", 14, "C"}}
+	h.tableHeader(cols)
+	for _, a := range rep.Alerts {
+		priority := fmt.Sprintf("%d", a.Priority)
+		if a.Priority >= 0 && a.Priority < len(alertPriorityLabels) {
+			priority = alertPriorityLabels[a.Priority]
+		}
+
+		read := "No"
+		if a.IsRead {
+			read = "Sí"
+		}
+		h.tableRow(cols, []string{h.local(a.Timestamp), priority, truncate(a.Title, 70), read})
+	}
+	if rep.TotalAlerts > len(rep.Alerts) {
+		h.font("I", 8)
+		h.text(pdfWidth, fmt.Sprintf("Se muestran %d de %d alertas.", len(rep.Alerts), rep.TotalAlerts), "L")
+		h.pdf.Ln(-1)
+	}
+}
+
+func (rep *HACCPReport) writeSignatures(h *haccpPDF) {
+	h.ensureSpace(60)
+	h.section("Verificación")
+
+	generatedBy := rep.GeneratedBy
+	if generatedBy == "" {
+		generatedBy = "-"
+	}
+	h.font("", 9)
+	h.text(pdfWidth, fmt.Sprintf("Generado el %s por %s.", h.local(rep.GeneratedAt), generatedBy), "L")
+	h.pdf.Ln(12)
+
+	// Dos firmas: responsable del registro y quien lo verifica
+	half := pdfWidth / 2
+	for _, line := range []string{"Nombre", "Cargo", "Firma", "Fecha"} {
+		for _, role := range []string{"Responsable", "Verificado por"} {
+			label := line
+			if line == "Nombre" {
+				label = role + " - " + line
+			}
+			h.text(35, label+":", "L")
+			x, y := h.pdf.GetXY()
+			h.pdf.Line(x, y+pdfRowHeight-1, x+half-45, y+pdfRowHeight-1)
+			h.pdf.SetX(x + half - 35)
+		}
+		h.pdf.Ln(pdfRowHeight + 4)
+	}
+}
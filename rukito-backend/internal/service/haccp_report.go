@@ -0,0 +1,520 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+const (
+	defaultReportTimezone = "America/Guayaquil"
+	haccpChartPoints      = 300 // intervalos del gráfico; el período se resume para no dibujar cada lectura
+	haccpMaxAlerts        = 300 // alertas listadas en el PDF; el resto solo se cuenta
+)
+
+// HACCPDay resume las lecturas válidas de un día (hora local)
+type HACCPDay struct {
+	Date       string
+	Min        float64
+	Max        float64
+	Avg        float64
+	Readings   int
+	OutOfRange int
+}
+
+// HACCPExcursion es una excursión registrada por el pipeline, recortada al período del informe
+type HACCPExcursion struct {
+	ID      string
+	Start   time.Time
+	End     time.Time
+	Peak    float64 // de toda la excursión, aunque empiece o termine fuera del período
+	High    bool    // true = sobre el límite crítico, false = bajo el mínimo configurado
+	Ongoing bool    // seguía fuera de rango al cerrar el período
+	Actions []models.CorrectiveAction
+
+	// Contenido de la cámara al iniciar la excursión, según el inventario
+	ExposedValue   float64
+	ExposedContent string
+}
+
+func (e HACCPExcursion) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// haccpPoint es un intervalo del gráfico; Count = 0 indica que no hubo lecturas
+type haccpPoint struct {
+	At    time.Time
+	Min   float64
+	Max   float64
+	Avg   float64
+	Count int
+}
+
+// HACCPReport es el registro de temperaturas de una cámara en un período
+type HACCPReport struct {
+	ChamberID   string
+	ChamberName string
+	Content     string
+	Location    string
+	Target      float64
+	Warning     float64
+	Critical    float64
+	MinAllowed  *float64 // límite inferior del rango seguro, si existe
+
+	Start    time.Time
+	End      time.Time
+	Timezone *time.Location
+
+	Readings    int
+	Suspect     int
+	Min         float64
+	Max         float64
+	Avg         float64
+	Days        []HACCPDay
+	Excursions  []HACCPExcursion
+	Alerts      []models.Alert
+	TotalAlerts int
+	Actions     []models.CorrectiveAction
+	points      []haccpPoint
+
+	GeneratedAt time.Time
+	GeneratedBy string
+}
+
+var (
+	reportTimezoneOnce sync.Once
+	reportTimezone     *time.Location
+)
+
+// ReportTimezone es la zona horaria de reportes y exportaciones (EXPORT_TIMEZONE, default America/Guayaquil).
+// Se resuelve una sola vez: el pipeline la consulta en cada lectura.
+func ReportTimezone() *time.Location {
+	reportTimezoneOnce.Do(func() {
+		name := os.Getenv("EXPORT_TIMEZONE")
+		if name == "" {
+			name = defaultReportTimezone
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			fmt.Printf("Zona horaria inválida '%s', se usa UTC: %v\n", name, err)
+			loc = time.UTC
+		}
+		reportTimezone = loc
+	})
+	return reportTimezone
+}
+
+// BuildHACCPReport reúne lecturas, excursiones y alertas de una cámara entre start y end.
+// Devuelve sql.ErrNoRows si la cámara no existe.
+func BuildHACCPReport(chamberID string, start, end time.Time, tz *time.Location) (*HACCPReport, error) {
+	rep := &HACCPReport{
+		ChamberID:   chamberID,
+		Start:       start,
+		End:         end,
+		Timezone:    tz,
+		GeneratedAt: time.Now(),
+	}
+
+	err := db.DB.QueryRow(`
+		SELECT c.name, COALESCE(c.content, ''), COALESCE(l.name, ''), c.target_temperature
+		FROM chambers c
+		LEFT JOIN locations l ON l.id = c.location_id
+		WHERE c.id = ?`, chamberID).Scan(&rep.ChamberName, &rep.Content, &rep.Location, &rep.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Los límites del informe son los mismos con los que el pipeline abre las excursiones
+	band, err := loadBand(chamberID)
+	if err != nil {
+		return nil, err
+	}
+	rep.Warning = band.warning
+	rep.Critical = band.high
+	rep.MinAllowed = band.low
+
+	if err := rep.loadReadings(); err != nil {
+		return nil, err
+	}
+	if err := rep.loadExcursions(); err != nil {
+		return nil, err
+	}
+	if err := rep.loadAlerts(); err != nil {
+		return nil, err
+	}
+	if err := rep.loadCorrectiveActions(); err != nil {
+		return nil, err
+	}
+	if err := rep.loadExposure(); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+// outOfRange indica si una temperatura está fuera de los límites críticos de la cámara
+func (rep *HACCPReport) outOfRange(temp float64) bool {
+	return temp > rep.Critical || (rep.MinAllowed != nil && temp < *rep.MinAllowed)
+}
+
+// loadReadings recorre las lecturas en orden y calcula en una sola pasada
+// el resumen diario y los puntos del gráfico
+func (rep *HACCPReport) loadReadings() error {
+	rows, err := db.DB.Query(`
+		SELECT temperature, quality, timestamp
+		FROM temperature_readings
+		WHERE sensor_id = ? AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC`, rep.ChamberID, rep.Start, rep.End)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	step := rep.End.Sub(rep.Start) / haccpChartPoints
+	if step <= 0 {
+		step = time.Minute
+	}
+	rep.points = make([]haccpPoint, haccpChartPoints)
+	for i := range rep.points {
+		rep.points[i].At = rep.Start.Add(time.Duration(i) * step)
+	}
+
+	days := make(map[string]*HACCPDay)
+	var sum float64
+
+	for rows.Next() {
+		var temp float64
+		var quality string
+		var ts time.Time
+		if err := rows.Scan(&temp, &quality, &ts); err != nil {
+			return err
+		}
+
+		// Las lecturas sospechosas se cuentan, pero no entran en el registro
+		if quality != QualityOK {
+			rep.Suspect++
+			continue
+		}
+
+		if rep.Readings == 0 || temp < rep.Min {
+			rep.Min = temp
+		}
+		if rep.Readings == 0 || temp > rep.Max {
+			rep.Max = temp
+		}
+		rep.Readings++
+		sum += temp
+
+		date := ts.In(rep.Timezone).Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &HACCPDay{Date: date, Min: temp, Max: temp}
+			days[date] = day
+		}
+		day.Min = min(day.Min, temp)
+		day.Max = max(day.Max, temp)
+		day.Avg += temp // se divide al final
+		day.Readings++
+		if rep.outOfRange(temp) {
+			day.OutOfRange++
+		}
+
+		i := min(int(ts.Sub(rep.Start)/step), haccpChartPoints-1)
+		if p := &rep.points[i]; p.Count == 0 {
+			p.Min, p.Max, p.Avg, p.Count = temp, temp, temp, 1
+		} else {
+			p.Min = min(p.Min, temp)
+			p.Max = max(p.Max, temp)
+			p.Avg += temp
+			p.Count++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if rep.Readings > 0 {
+		rep.Avg = sum / float64(rep.Readings)
+	}
+	for i := range rep.points {
+		if rep.points[i].Count > 0 {
+			rep.points[i].Avg /= float64(rep.points[i].Count)
+		}
+	}
+	for _, day := range days {
+		day.Avg /= float64(day.Readings)
+		rep.Days = append(rep.Days, *day)
+	}
+	sort.Slice(rep.Days, func(i, j int) bool { return rep.Days[i].Date < rep.Days[j].Date })
+
+	return nil
+}
+
+// loadExcursions carga las excursiones que registró el pipeline (las mismas de /api/excursions,
+// con sus reglas de descongelamiento y huecos) que se solapan con el período, recortadas a él
+func (rep *HACCPReport) loadExcursions() error {
+	rows, err := db.DB.Query(`
+		SELECT id, direction, started_at, ended_at, peak_temperature
+		FROM excursions
+		WHERE sensor_id = ? AND started_at <= ? AND (ended_at IS NULL OR ended_at >= ?)
+		ORDER BY started_at ASC`, rep.ChamberID, rep.End, rep.Start)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Una excursión abierta dura hasta ahora, o hasta el cierre del período si ya pasó
+	until := rep.End
+	if now := time.Now(); now.Before(until) {
+		until = now
+	}
+	for rows.Next() {
+		var e HACCPExcursion
+		var direction string
+		var endedAt sql.NullTime
+		if err := rows.Scan(&e.ID, &direction, &e.Start, &endedAt, &e.Peak); err != nil {
+			return err
+		}
+		e.High = direction == ExcursionHigh
+		if e.Start.Before(rep.Start) {
+			e.Start = rep.Start
+		}
+		e.End = until
+		if endedAt.Valid && !endedAt.Time.After(rep.End) {
+			e.End = endedAt.Time
+		} else {
+			e.Ongoing = true
+		}
+		rep.Excursions = append(rep.Excursions, e)
+	}
+	return rows.Err()
+}
+
+func (rep *HACCPReport) loadAlerts() error {
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM alerts WHERE sensor_id = ? AND timestamp BETWEEN ? AND ?`,
+		rep.ChamberID, rep.Start, rep.End).Scan(&rep.TotalAlerts); err != nil {
+		return err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, title, COALESCE(description, ''), priority, type, is_read, timestamp
+		FROM alerts
+		WHERE sensor_id = ? AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC
+		LIMIT ?`, rep.ChamberID, rep.Start, rep.End, haccpMaxAlerts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := models.Alert{SensorID: rep.ChamberID}
+		if err := rows.Scan(&a.ID, &a.Title, &a.Description, &a.Priority, &a.Type, &a.IsRead, &a.Timestamp); err != nil {
+			return err
+		}
+		rep.Alerts = append(rep.Alerts, a)
+	}
+	return rows.Err()
+}
+
+// loadCorrectiveActions carga las acciones de las excursiones y alertas del período y las asigna
+// a su excursión por excursion_id. Las acciones antiguas sin excursion_id se asignan a la
+// excursión que contiene su excursion_start (o la hora de su alerta).
+func (rep *HACCPReport) loadCorrectiveActions() error {
+	rows, err := db.DB.Query(`
+		SELECT ca.id, ca.alert_id, ca.excursion_id, ca.action, ca.disposition, ca.performed_by, ca.performed_at, COALESCE(ca.excursion_start, a.timestamp) AS ref
+		FROM corrective_actions ca
+		LEFT JOIN alerts a ON a.id = ca.alert_id
+		LEFT JOIN excursions e ON e.id = ca.excursion_id
+		WHERE ca.sensor_id = ? AND (
+			(e.id IS NOT NULL AND e.started_at <= ? AND (e.ended_at IS NULL OR e.ended_at >= ?))
+			OR (ca.excursion_id IS NULL AND COALESCE(ca.excursion_start, a.timestamp) BETWEEN ? AND ?))
+		ORDER BY ca.performed_at ASC`, rep.ChamberID, rep.End, rep.Start, rep.Start, rep.End)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := models.CorrectiveAction{SensorID: rep.ChamberID}
+		var alertID, excursionID sql.NullString
+		var ref sql.NullTime
+		if err := rows.Scan(&a.ID, &alertID, &excursionID, &a.Action, &a.Disposition, &a.PerformedBy, &a.PerformedAt, &ref); err != nil {
+			return err
+		}
+		if alertID.Valid {
+			val := alertID.String
+			a.AlertID = &val
+		}
+		if excursionID.Valid {
+			val := excursionID.String
+			a.ExcursionID = &val
+		}
+		rep.Actions = append(rep.Actions, a)
+
+		for i := range rep.Excursions {
+			e := &rep.Excursions[i]
+			matches := excursionID.Valid && excursionID.String == e.ID
+			if !excursionID.Valid && ref.Valid {
+				matches = !ref.Time.Before(e.Start) && !ref.Time.After(e.End)
+			}
+			if matches {
+				e.Actions = append(e.Actions, a)
+				break
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// loadExposure valora el inventario que había en la cámara al inicio de cada excursión
+func (rep *HACCPReport) loadExposure() error {
+	for i := range rep.Excursions {
+		e := &rep.Excursions[i]
+		inv, err := ChamberInventory(rep.ChamberID, e.Start)
+		if err != nil {
+			return err
+		}
+		e.ExposedValue = inv.TotalValue
+		e.ExposedContent = DescribeInventory(inv)
+	}
+	return nil
+}
+
+// ExposedValue suma el valor del contenido expuesto en todas las excursiones
+func (rep *HACCPReport) ExposedValue() float64 {
+	total := 0.0
+	for _, e := range rep.Excursions {
+		total += e.ExposedValue
+	}
+	return total
+}
+
+// MissingActions cuenta las excursiones sin acción correctiva documentada
+func (rep *HACCPReport) MissingActions() int {
+	missing := 0
+	for _, e := range rep.Excursions {
+		if len(e.Actions) == 0 {
+			missing++
+		}
+	}
+	return missing
+}
+
+// TimeOutOfRange suma la duración de todas las excursiones
+func (rep *HACCPReport) TimeOutOfRange() time.Duration {
+	var total time.Duration
+	for _, e := range rep.Excursions {
+		total += e.Duration()
+	}
+	return total
+}
+
+// reportPeriod devuelve el último período completo según REPORT_SCHEDULE (daily, weekly, monthly)
+func reportPeriod(schedule string, now time.Time) (time.Time, time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch schedule {
+	case "daily":
+		return today.AddDate(0, 0, -1), today, true
+	case "weekly":
+		// Semanas de lunes a domingo
+		monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, -7), monday, true
+	case "monthly":
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return first.AddDate(0, -1, 0), first, true
+	default:
+		return time.Time{}, time.Time{}, false
+	}
+}
+
+// StartReportScheduler genera cada hora los PDF HACCP pendientes del último período
+// completo (REPORT_SCHEDULE) para todas las cámaras activas y los guarda en REPORTS_DIR.
+// Un archivo ya existente no se vuelve a generar, así que reiniciar el servidor es seguro.
+func StartReportScheduler() {
+	schedule := os.Getenv("REPORT_SCHEDULE")
+	if _, _, ok := reportPeriod(schedule, time.Now()); !ok {
+		if schedule != "" {
+			fmt.Printf("REPORT_SCHEDULE '%s' no válido (daily, weekly, monthly); reportes programados desactivados\n", schedule)
+		}
+		return
+	}
+
+	dir := os.Getenv("REPORTS_DIR")
+	if dir == "" {
+		dir = "reports"
+	}
+
+	go func() {
+		generateScheduledReports(schedule, dir)
+		ticker := time.NewTicker(time.Hour)
+		for range ticker.C {
+			generateScheduledReports(schedule, dir)
+		}
+	}()
+}
+
+func generateScheduledReports(schedule, dir string) {
+	tz := ReportTimezone()
+	start, end, _ := reportPeriod(schedule, time.Now().In(tz))
+
+	rows, err := db.DB.Query(`SELECT id FROM chambers WHERE is_active = TRUE`)
+	if err != nil {
+		fmt.Printf("Error generando reportes HACCP: %v\n", err)
+		return
+	}
+	var chamberIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			chamberIDs = append(chamberIDs, id)
+		}
+	}
+	rows.Close()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Printf("Error generando reportes HACCP: %v\n", err)
+		return
+	}
+
+	for _, id := range chamberIDs {
+		path := filepath.Join(dir, fmt.Sprintf("haccp_%s_%s_%s.pdf", id, schedule, start.Format("20060102")))
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		rep, err := BuildHACCPReport(id, start, end.Add(-time.Second), tz)
+		if err != nil {
+			fmt.Printf("Error generando reporte HACCP de %s: %v\n", id, err)
+			continue
+		}
+		rep.GeneratedBy = "Reporte programado (" + schedule + ")"
+
+		// Se escribe en un temporal para no dejar PDFs a medias si el proceso se corta
+		tmp := path + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			fmt.Printf("Error generando reporte HACCP de %s: %v\n", id, err)
+			continue
+		}
+		err = rep.WritePDF(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			fmt.Printf("Error generando reporte HACCP de %s: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("📄 Reporte HACCP generado: %s\n", path)
+	}
+}
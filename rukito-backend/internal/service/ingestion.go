@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrIngestionDisabled = errors.New("live ingestion is not running")
+	ErrIngestionBusy     = errors.New("ingestion queue is full")
+)
+
+// liveChannel es el canal del procesador en vivo; nil en modo REPLAY
+var liveChannel chan DataPoint
+
+// startLiveProcessor arranca el procesador en vivo y devuelve el canal donde
+// simuladores y dispositivos de red depositan sus lecturas
+func startLiveProcessor() chan<- DataPoint {
+	liveChannel = make(chan DataPoint, 100)
+	go processSensorData(liveChannel, liveSink)
+	return liveChannel
+}
+
+// StartDeviceIngestion arranca solo el procesador en vivo, sin simuladores.
+// Las lecturas llegan exclusivamente desde dispositivos vía POST /api/ingest/readings.
+func StartDeviceIngestion() {
+	fmt.Println("📡 MODO DISPOSITIVOS: SOLO INGESTIÓN DE RED")
+	startLiveProcessor()
+}
+
+// Ingest encola una lectura recibida por red en el procesador en vivo
+func Ingest(dp DataPoint) error {
+	if liveChannel == nil {
+		return ErrIngestionDisabled
+	}
+
+	select {
+	case liveChannel <- dp:
+		return nil
+	default:
+		return ErrIngestionBusy
+	}
+}
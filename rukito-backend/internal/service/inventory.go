@@ -0,0 +1,84 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// stockQuantity suma los movimientos con signo: los ingresos suman y las salidas restan
+const stockQuantity = `SUM(CASE WHEN m.type = 'out' THEN -m.quantity_kg ELSE m.quantity_kg END)`
+
+// rowQuerier es *sql.DB o *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ChamberInventory devuelve el contenido de una cámara en el instante at,
+// sumando sus movimientos de stock hasta ese momento. Se valora al precio vigente de cada producto.
+func ChamberInventory(sensorID string, at time.Time) (models.ChamberInventory, error) {
+	inv := models.ChamberInventory{SensorID: sensorID, At: at, Items: []models.StockItem{}}
+
+	rows, err := db.DB.Query(`
+		SELECT p.id, p.name, p.category, p.price_per_kg, `+stockQuantity+` AS quantity
+		FROM stock_movements m
+		JOIN products p ON p.id = m.product_id
+		WHERE m.sensor_id = ? AND m.moved_at <= ?
+		GROUP BY p.id, p.name, p.category, p.price_per_kg
+		HAVING quantity > 0
+		ORDER BY quantity * p.price_per_kg DESC, p.name`, sensorID, at)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.StockItem
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.Category, &item.PricePerKg, &item.QuantityKg); err != nil {
+			return inv, err
+		}
+		item.Value = item.QuantityKg * item.PricePerKg
+		inv.Items = append(inv.Items, item)
+		inv.TotalKg += item.QuantityKg
+		inv.TotalValue += item.Value
+	}
+	return inv, rows.Err()
+}
+
+// StockBalance devuelve los kg de un producto en una cámara en el instante at
+func StockBalance(q rowQuerier, sensorID, productID string, at time.Time) (float64, error) {
+	var balance sql.NullFloat64
+	err := q.QueryRow(`
+		SELECT `+stockQuantity+`
+		FROM stock_movements m
+		WHERE m.sensor_id = ? AND m.product_id = ? AND m.moved_at <= ?`, sensorID, productID, at).Scan(&balance)
+	return balance.Float64, err
+}
+
+// DescribeInventory resume el contenido, p. ej. "Lomo fino de res 200.0 kg, Costilla de cerdo 120.0 kg"
+func DescribeInventory(inv models.ChamberInventory) string {
+	parts := make([]string, 0, len(inv.Items))
+	for _, item := range inv.Items {
+		parts = append(parts, fmt.Sprintf("%s %.1f kg", item.Name, item.QuantityKg))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// estimateLoss valora lo que había en la cámara al momento de la lectura.
+// Sin inventario registrado el costo es 0 y el contenido queda vacío.
+func estimateLoss(dp DataPoint) (float64, *string) {
+	inv, err := ChamberInventory(dp.SensorID, dp.Timestamp)
+	if err != nil {
+		fmt.Printf("Error cargando inventario de %s: %v\n", dp.SensorID, err)
+		return 0, nil
+	}
+	if len(inv.Items) == 0 {
+		return 0, nil
+	}
+	content := DescribeInventory(inv)
+	return inv.TotalValue, &content
+}
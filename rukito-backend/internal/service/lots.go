@@ -0,0 +1,167 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// lotCheckEvery limita cada cuánto (en tiempo de las lecturas) se evalúan los lotes durante una excursión
+const lotCheckEvery = 5 * time.Minute
+
+// LotBalance devuelve los kg que quedan de un lote según sus movimientos
+func LotBalance(q rowQuerier, lotID string) (float64, error) {
+	var balance sql.NullFloat64
+	err := q.QueryRow(`SELECT `+stockQuantity+` FROM stock_movements m WHERE m.lot_id = ?`, lotID).Scan(&balance)
+	return balance.Float64, err
+}
+
+// QuarantinedKg devuelve los kg de un producto bloqueados en cuarentena en una cámara
+func QuarantinedKg(q rowQuerier, sensorID, productID string) (float64, error) {
+	var kg sql.NullFloat64
+	err := q.QueryRow(`
+		SELECT `+stockQuantity+`
+		FROM stock_movements m
+		JOIN lots l ON l.id = m.lot_id
+		WHERE l.sensor_id = ? AND l.product_id = ? AND l.status = ?`, sensorID, productID, models.LotQuarantined).Scan(&kg)
+	return kg.Float64, err
+}
+
+// exposableLot es un lote utilizable con las reglas de su producto
+type exposableLot struct {
+	id        string
+	product   string
+	status    string
+	from      time.Time // desde cuándo cuenta su exposición
+	remaining float64
+	price     float64
+	rules     models.ProductRules
+}
+
+// loadExposableLots devuelve los lotes utilizables con stock de una cámara. La exposición de un lote
+// cuenta desde su recepción, o desde su liberación si ya pasó por una cuarentena.
+func loadExposableLots(sensorID string, at time.Time) ([]exposableLot, error) {
+	rows, err := db.DB.Query(`
+		SELECT l.id, p.name, l.status, l.received_at, l.resolved_at, p.category, p.price_per_kg,
+			p.safe_min_temperature, p.safe_max_temperature, p.max_exposure_minutes, p.degradation_rate,
+			(SELECT `+stockQuantity+` FROM stock_movements m WHERE m.lot_id = l.id) AS remaining
+		FROM lots l
+		JOIN products p ON p.id = l.product_id
+		WHERE l.sensor_id = ? AND l.status IN (?, ?) AND l.received_at <= ?
+		HAVING remaining > 0`, sensorID, models.LotAvailable, models.LotReleased, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []exposableLot
+	for rows.Next() {
+		var l exposableLot
+		var category string
+		var resolvedAt sql.NullTime
+		var safeMin, safeMax, maxExposure, degradationRate sql.NullFloat64
+		err := rows.Scan(&l.id, &l.product, &l.status, &l.from, &resolvedAt, &category, &l.price,
+			&safeMin, &safeMax, &maxExposure, &degradationRate, &l.remaining)
+		if err != nil {
+			return nil, err
+		}
+		if l.status == models.LotReleased && resolvedAt.Valid && resolvedAt.Time.After(l.from) {
+			l.from = resolvedAt.Time
+		}
+		if windowStart := at.Add(-spoilageWindow); l.from.Before(windowStart) {
+			l.from = windowStart
+		}
+		l.rules = ProductRulesFor(category, safeMin, safeMax, maxExposure, degradationRate)
+		lots = append(lots, l)
+	}
+	return lots, rows.Err()
+}
+
+// quarantineExposedLots pone en cuarentena los lotes de la cámara cuya exposición agotó los
+// límites de su producto durante la excursión, y avisa con una alerta
+func quarantineExposedLots(sensorID, excursionID string, dp DataPoint) {
+	lots, err := loadExposableLots(sensorID, dp.Timestamp)
+	if err != nil {
+		fmt.Printf("Error cargando lotes de %s: %v\n", sensorID, err)
+		return
+	}
+	if len(lots) == 0 {
+		return
+	}
+
+	earliest := dp.Timestamp
+	for _, l := range lots {
+		if l.from.Before(earliest) {
+			earliest = l.from
+		}
+	}
+	points, err := liveSink.riskPoints(sensorID, earliest, dp.Timestamp)
+	if err != nil {
+		fmt.Printf("Error cargando lecturas de %s: %v\n", sensorID, err)
+		return
+	}
+	if len(points) == 0 || dp.Timestamp.After(points[len(points)-1].at) {
+		points = append(points, riskPoint{at: dp.Timestamp, temp: dp.Temperature})
+	}
+
+	var locationID *string
+	var loc sql.NullString
+	if err := db.DB.QueryRow(`SELECT location_id FROM chambers WHERE id = ?`, sensorID).Scan(&loc); err == nil && loc.Valid {
+		locationID = &loc.String
+	}
+
+	var names []string
+	value := 0.0
+	for _, l := range lots {
+		start := sort.Search(len(points), func(i int) bool { return !points[i].at.Before(l.from) })
+		risk := models.ProductRisk{Name: l.product, Rules: l.rules}
+		score(&risk, points[start:])
+		if risk.RiskScore < riskDiscardAt {
+			continue
+		}
+
+		reason := fmt.Sprintf("%.0f min y %.1f °C·h fuera del rango seguro de %s (tolera %.0f min)",
+			risk.ExposureMinutes, risk.DegreeHours, l.product, l.rules.MaxExposureMinutes)
+		res, err := db.DB.Exec(`
+			UPDATE lots SET status = ?, quarantined_at = ?, quarantine_excursion_id = ?, quarantine_reason = ?
+			WHERE id = ? AND status = ?`, models.LotQuarantined, dp.Timestamp, excursionID, reason, l.id, l.status)
+		if err != nil {
+			fmt.Printf("Error poniendo en cuarentena el lote %s: %v\n", l.id, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		RecordAudit(models.AuditEntry{
+			ActorUsername: "system",
+			Action:        AuditLotQuarantine,
+			EntityType:    "lot",
+			EntityID:      l.id,
+			LocationID:    locationID,
+		}, map[string]interface{}{"status": l.status}, map[string]interface{}{
+			"status":                  models.LotQuarantined,
+			"quarantine_excursion_id": excursionID,
+			"quarantine_reason":       reason,
+		})
+
+		fmt.Printf("🔒 LOTE EN CUARENTENA: %s (%s)\n", l.id, reason)
+		names = append(names, fmt.Sprintf("%s (%s, %.1f kg)", l.id, l.product, l.remaining))
+		value += l.remaining * l.price
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	content := strings.Join(names, ", ")
+	action := "Liberar o descartar los lotes en cuarentena con su justificación"
+	raiseAlert(dp, liveSink, models.AlertPriorityP2, models.AlertTypeTemperatureCritical,
+		fmt.Sprintf("LOTES EN CUARENTENA: %s", sensorID),
+		fmt.Sprintf("La excursión agotó los límites de producto de: %s", content),
+		alertImpact{estCost: value, affectedContent: &content, suggestedAction: &action}, nil)
+}
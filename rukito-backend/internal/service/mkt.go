@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/angello/rukito-backend/internal/db"
+)
+
+// DefaultActivationEnergy es la ΔH de referencia de USP <1079> (kJ/mol), usada si la categoría no tiene una registrada
+const DefaultActivationEnergy = 83.144
+
+// gasConstant en J/(mol·K)
+const gasConstant = 8.3144598
+
+// mktAccumulator acumula la temperatura cinética media (MKT): la temperatura constante que
+// produciría la misma degradación (Arrhenius) que la serie de temperaturas observada
+type mktAccumulator struct {
+	activationEnergy float64 // kJ/mol
+	weighted         float64 // Σ duración · e^(-ΔH/RT)
+	minutes          float64
+}
+
+// arrhenius devuelve e^(-ΔH/RT) con la temperatura en °C
+func (m *mktAccumulator) arrhenius(temp float64) float64 {
+	return math.Exp(-m.activationEnergy * 1000 / (gasConstant * (temp + 273.15)))
+}
+
+// add suma un tramo entre dos lecturas consecutivas (regla del trapecio sobre el factor de Arrhenius)
+func (m *mktAccumulator) add(from, to, minutes float64) {
+	if minutes <= 0 {
+		return
+	}
+	m.weighted += (m.arrhenius(from) + m.arrhenius(to)) / 2 * minutes
+	m.minutes += minutes
+}
+
+// value devuelve la MKT en °C; false si todavía no hay ningún tramo
+func (m *mktAccumulator) value() (float64, bool) {
+	if m.minutes <= 0 || m.weighted <= 0 {
+		return 0, false
+	}
+	kelvin := m.activationEnergy * 1000 / gasConstant / -math.Log(m.weighted/m.minutes)
+	return kelvin - 273.15, true
+}
+
+// resume reconstruye el acumulado a partir de una MKT ya calculada sobre minutes minutos
+func (m *mktAccumulator) resume(mkt, minutes float64) {
+	m.minutes = minutes
+	m.weighted = m.arrhenius(mkt) * minutes
+}
+
+// ActivationEnergies devuelve la energía de activación (kJ/mol) configurada por categoría de producto
+func ActivationEnergies() (map[string]float64, error) {
+	rows, err := db.DB.Query(`SELECT category, activation_energy FROM product_categories`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	energies := make(map[string]float64)
+	for rows.Next() {
+		var category string
+		var energy float64
+		if err := rows.Scan(&category, &energy); err != nil {
+			return nil, err
+		}
+		energies[category] = energy
+	}
+	return energies, rows.Err()
+}
+
+// activationEnergyFor devuelve la energía de la categoría, o la de referencia si no está configurada
+func activationEnergyFor(energies map[string]float64, category string) float64 {
+	if energy, ok := energies[category]; ok && energy > 0 {
+		return energy
+	}
+	return DefaultActivationEnergy
+}
+
+// loadActivationEnergies es ActivationEnergies para los caches del pipeline: ante un error
+// se registra y se sigue con la energía de referencia
+func loadActivationEnergies() map[string]float64 {
+	energies, err := ActivationEnergies()
+	if err != nil {
+		fmt.Printf("Error cargando energías de activación: %v\n", err)
+	}
+	return energies
+}
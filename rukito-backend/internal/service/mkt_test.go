@@ -0,0 +1,63 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMKT(t *testing.T) {
+	type segment struct{ from, to, minutes float64 }
+
+	// Valores calculados a mano con ΔH/R = 83144 / 8.3144598 ≈ 9999.93 K:
+	// MKT = (ΔH/R) / -ln(Σ tᵢ·e^(-ΔH/RTᵢ) / Σ tᵢ) - 273.15
+	tests := []struct {
+		name     string
+		segments []segment
+		want     float64
+		ok       bool
+	}{
+		{"no segments", nil, 0, false},
+		{"zero-length segment", []segment{{5, 5, 0}}, 0, false},
+		{"constant temperature", []segment{{5, 5, 60}, {5, 5, 60}}, 5, true},
+		// Arrhenius pesa más la hora a 30°C que la media aritmética (25°C)
+		{"one hour at 20 and one at 30", []segment{{20, 20, 60}, {30, 30, 60}}, 26.2599, true},
+		{"one hour at 25 and three at 5", []segment{{25, 25, 60}, {5, 5, 180}}, 15.1322, true},
+		// trapecio sobre el factor de Arrhenius de los extremos
+		{"ramp from 0 to 10", []segment{{0, 10, 30}}, 6.4327, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mktAccumulator{activationEnergy: DefaultActivationEnergy}
+			for _, s := range tt.segments {
+				m.add(s.from, s.to, s.minutes)
+			}
+			got, ok := m.value()
+			if ok != tt.ok {
+				t.Fatalf("value() ok = %v, want %v", ok, tt.ok)
+			}
+			if math.Abs(got-tt.want) > 1e-4 {
+				t.Errorf("value() = %.4f, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMKTResume(t *testing.T) {
+	// Reanudar desde una MKT guardada y sumar más tramos da lo mismo que acumular todo de una vez
+	whole := mktAccumulator{activationEnergy: DefaultActivationEnergy}
+	whole.add(25, 25, 60)
+	whole.add(5, 5, 180)
+	stored, _ := whole.value()
+
+	resumed := mktAccumulator{activationEnergy: DefaultActivationEnergy}
+	resumed.resume(stored, 240)
+	whole.add(5, 12, 30)
+	resumed.add(5, 12, 30)
+
+	want, _ := whole.value()
+	got, ok := resumed.value()
+	if !ok || math.Abs(got-want) > 1e-9 {
+		t.Errorf("resumed value() = %v, %v; want %v", got, ok, want)
+	}
+}
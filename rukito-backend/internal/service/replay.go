@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/google/uuid"
+)
+
+// replayRecord es el formato de cada línea de un archivo JSONL de replay
+type replayRecord struct {
+	SensorID    string    `json:"sensor_id"`
+	Temperature float64   `json:"temperature"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// StartReplaySimulation re-ejecuta lecturas grabadas a través del procesador real.
+// Fuente: REPLAY_SOURCE (archivo .csv o .jsonl) o, si no se define,
+// el rango REPLAY_FROM / REPLAY_TO (RFC3339) de temperature_readings.
+// Velocidad: REPLAY_SPEED = ORIGINAL (default), MAX o un multiplicador (ej. 10).
+// Los resultados se guardan en replay_readings / replay_alerts bajo un run_id propio.
+func StartReplaySimulation() {
+	fmt.Println("⏪ MODO SIMULACIÓN: REPLAY ACTIVADO")
+
+	points, source, err := loadReplayPoints()
+	if err != nil {
+		fmt.Printf("Error cargando replay: %v\n", err)
+		return
+	}
+
+	speed, err := parseReplaySpeed(os.Getenv("REPLAY_SPEED"))
+	if err != nil {
+		fmt.Printf("Error en REPLAY_SPEED: %v\n", err)
+		return
+	}
+
+	runID := "RUN-" + uuid.New().String()[:8]
+	_, err = db.DB.Exec(`INSERT INTO replay_runs (id, source, speed, total_points, started_at) VALUES (?, ?, ?, ?, ?)`,
+		runID, source, speed, len(points), time.Now())
+	if err != nil {
+		fmt.Printf("Error registrando replay: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Replay %s: %d lecturas desde %s (velocidad %s)\n", runID, len(points), source, formatReplaySpeed(speed))
+
+	dataChannel := make(chan DataPoint, 100)
+	done := make(chan struct{})
+
+	go func() {
+		processSensorData(dataChannel, dataSink{runID: runID})
+		close(done)
+	}()
+
+	go func() {
+		feedReplay(points, speed, dataChannel)
+		close(dataChannel)
+		<-done
+
+		db.DB.Exec(`UPDATE replay_runs SET finished_at = ? WHERE id = ?`, time.Now(), runID)
+		fmt.Printf("✅ Replay %s terminado\n", runID)
+	}()
+}
+
+// feedReplay envía los puntos respetando los intervalos originales divididos por speed.
+// speed == 0 significa máxima velocidad (sin esperas).
+func feedReplay(points []DataPoint, speed float64, out chan<- DataPoint) {
+	for i, dp := range points {
+		if i > 0 && speed > 0 {
+			gap := dp.Timestamp.Sub(points[i-1].Timestamp)
+			if gap > 0 {
+				time.Sleep(time.Duration(float64(gap) / speed))
+			}
+		}
+		out <- dp
+	}
+}
+
+func loadReplayPoints() ([]DataPoint, string, error) {
+	var points []DataPoint
+	var err error
+
+	source := os.Getenv("REPLAY_SOURCE")
+	if source != "" {
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".csv":
+			points, err = readReplayCSV(source)
+		case ".jsonl":
+			points, err = readReplayJSONL(source)
+		default:
+			return nil, "", fmt.Errorf("formato no soportado: %s (use .csv o .jsonl)", source)
+		}
+	} else {
+		from, to := os.Getenv("REPLAY_FROM"), os.Getenv("REPLAY_TO")
+		if from == "" || to == "" {
+			return nil, "", fmt.Errorf("defina REPLAY_SOURCE o REPLAY_FROM y REPLAY_TO")
+		}
+		source = fmt.Sprintf("db:%s..%s", from, to)
+		points, err = readReplayDB(from, to)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// El procesador asume orden temporal, así que ordenamos la fuente
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	})
+
+	return points, source, nil
+}
+
+// readReplayCSV lee un CSV con cabecera que incluya sensor_id, temperature y timestamp
+// (el orden de las columnas es libre, columnas extra como status se ignoran)
+func readReplayCSV(path string) ([]DataPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"sensor_id", "temperature", "timestamp"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("columna requerida ausente: %s", required)
+		}
+	}
+
+	var points []DataPoint
+	line := 1
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: %v", line, err)
+		}
+
+		temp, err := strconv.ParseFloat(rec[cols["temperature"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: temperatura inválida: %v", line, err)
+		}
+		ts, err := time.Parse(time.RFC3339, rec[cols["timestamp"]])
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: timestamp inválido: %v", line, err)
+		}
+
+		points = append(points, DataPoint{SensorID: rec[cols["sensor_id"]], Temperature: temp, Timestamp: ts})
+	}
+
+	return points, nil
+}
+
+func readReplayJSONL(path string) ([]DataPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []DataPoint
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec replayRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("línea %d: %v", line, err)
+		}
+		points = append(points, DataPoint{SensorID: rec.SensorID, Temperature: rec.Temperature, Timestamp: rec.Timestamp})
+	}
+
+	return points, scanner.Err()
+}
+
+func readReplayDB(from, to string) ([]DataPoint, error) {
+	query := `
+		SELECT sensor_id, COALESCE(raw_temperature, temperature), timestamp
+		FROM temperature_readings
+		WHERE timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC`
+
+	rows, err := db.DB.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []DataPoint
+	for rows.Next() {
+		var dp DataPoint
+		if err := rows.Scan(&dp.SensorID, &dp.Temperature, &dp.Timestamp); err != nil {
+			return nil, err
+		}
+		points = append(points, dp)
+	}
+
+	return points, rows.Err()
+}
+
+// parseReplaySpeed devuelve el multiplicador de velocidad; 0 = máxima velocidad
+func parseReplaySpeed(s string) (float64, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "", "ORIGINAL":
+		return 1, nil
+	case "MAX":
+		return 0, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || !(speed > 0) || math.IsInf(speed, 0) {
+		return 0, fmt.Errorf("valor inválido %q (use ORIGINAL, MAX o un número > 0)", s)
+	}
+	return speed, nil
+}
+
+func formatReplaySpeed(speed float64) string {
+	if speed == 0 {
+		return "MAX"
+	}
+	return fmt.Sprintf("%gx", speed)
+}
@@ -0,0 +1,37 @@
+package service
+
+import "testing"
+
+func TestParseReplaySpeed(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"original", 1, false},
+		{" MAX ", 0, false},
+		{"2", 2, false},
+		{"10x", 10, false},
+		{"0.5X", 0.5, false},
+		{"0", 0, true},
+		{"0x", 0, true},
+		{"-2", 0, true},
+		{"x", 0, true},
+		{"fast", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseReplaySpeed(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReplaySpeed(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseReplaySpeed(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
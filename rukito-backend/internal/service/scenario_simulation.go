@@ -12,7 +12,9 @@ import (
 func StartScenarioSimulation() {
 	fmt.Println("⚠️  MODO SIMULACIÓN: ESCENARIOS ACTIVADO ⚠️")
 	
-	dataChannel := make(chan DataPoint, 100)
+	// Reutilizamos la MISMA lógica de procesamiento que el servicio real
+	// Esto es clave para asegurar que probamos el procesador real
+	dataChannel := withChaos(startLiveProcessor())
 
 	// --- ESCENARIO 1: CF-1 (CRÍTICO -> ESTABLE) ---
 	go func() {
@@ -62,8 +64,4 @@ func StartScenarioSimulation() {
 			dataChannel <- DataPoint{SensorID: "REF-3", Temperature: 2.0, Timestamp: time.Now()}
 		}
 	}()
-
-	// Reutilizamos la MISMA lógica de procesamiento que el servicio real
-	// Esto es clave para asegurar que probamos el procesador real
-	go processSensorData(dataChannel)
 }
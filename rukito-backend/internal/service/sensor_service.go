@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -17,8 +18,61 @@ type DataPoint struct {
 }
 
 type sensorState struct {
-	temp float64
-	time time.Time
+	temp float64   // última lectura válida, calibrada, para la tasa de cambio
+	time time.Time // hora de esa lectura válida
+	raw  float64   // última lectura recibida (válida o sospechosa) tal como llegó
+	at   time.Time // hora de la última lectura recibida; ordena y descarta reenvíos
+}
+
+// dataSink define dónde persiste el procesador sus resultados.
+// El flujo en vivo escribe en las tablas reales; un replay escribe en
+// tablas aparte para poder comparar qué alertas habrían saltado.
+type dataSink struct {
+	runID          string // vacío para el flujo en vivo
+	updateChambers bool
+}
+
+// liveSink es el destino por defecto de los simuladores y sensores reales
+var liveSink = dataSink{updateChambers: true}
+
+func (s dataSink) insertReading(dp DataPoint, rawTemperature, rateOfChange float64, status, quality string) error {
+	if s.runID != "" {
+		query := `
+			INSERT INTO replay_readings (run_id, sensor_id, temperature, raw_temperature, rate_of_change, status, quality, timestamp) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err := db.DB.Exec(query, s.runID, dp.SensorID, dp.Temperature, rawTemperature, rateOfChange, status, quality, dp.Timestamp)
+		return err
+	}
+
+	query := `
+		INSERT INTO temperature_readings (sensor_id, temperature, raw_temperature, rate_of_change, status, quality, timestamp) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.DB.Exec(query, dp.SensorID, dp.Temperature, rawTemperature, rateOfChange, status, quality, dp.Timestamp)
+	return err
+}
+
+// alertImpact es lo que una alerta informa sobre el producto afectado
+type alertImpact struct {
+	estCost         float64
+	affectedContent *string
+	suggestedAction *string
+}
+
+func (s dataSink) insertAlert(id, title, desc string, priority, alertType int, dp DataPoint, impact alertImpact, configRevision *int) error {
+	if s.runID != "" {
+		query := `
+			INSERT INTO replay_alerts (id, run_id, title, description, priority, type, sensor_id, estimated_cost, affected_content, suggested_action, config_revision, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err := db.DB.Exec(query, id, s.runID, title, desc, priority, alertType, dp.SensorID, impact.estCost, impact.affectedContent, impact.suggestedAction, configRevision, dp.Timestamp)
+		return err
+	}
+
+	// Una alerta disparada con una excursión abierta queda vinculada a ella
+	query := `
+		INSERT INTO alerts (id, title, description, priority, type, sensor_id, is_read, estimated_cost, affected_content, suggested_action, config_revision, excursion_id, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT id FROM excursions WHERE sensor_id = ? AND ended_at IS NULL ORDER BY started_at DESC LIMIT 1), ?)`
+	_, err := db.DB.Exec(query, id, title, desc, priority, alertType, dp.SensorID, false, impact.estCost, impact.affectedContent, impact.suggestedAction, configRevision, dp.SensorID, dp.Timestamp)
+	return err
 }
 
 // StartSensorSimulation inicia la simulación aleatoria normal
@@ -34,7 +88,7 @@ func StartSensorSimulation() {
 		{"REF-3", 2.0},
 	}
 
-	dataChannel := make(chan DataPoint, 100)
+	dataChannel := withChaos(startLiveProcessor())
 
 	for _, s := range sensors {
 		go func(id string, base float64) {
@@ -53,60 +107,122 @@ func StartSensorSimulation() {
 			}
 		}(s.ID, s.BaseTemp)
 	}
-
-	go processSensorData(dataChannel)
 }
 
-func processSensorData(dataChan <-chan DataPoint) {
+func processSensorData(dataChan <-chan DataPoint, sink dataSink) {
 	fmt.Println("Worker Pool: Procesando flujo de datos...")
 
 	lastAlertTime := make(map[string]time.Time)
+	lastMaintenanceAlert := make(map[string]time.Time)
 	lastStates := make(map[string]sensorState)
+	validator := newQualityValidator()
+	calibrations := newCalibrator()
+	bands := newBandCache()
+	defrosts := newDefrostTracker(bands)
+	excursions := newExcursionTracker(bands)
+	forecasts := newForecaster(bands)
+	anomalies := newAnomalyDetector(bands)
 
 	for dp := range dataChan {
+		// 0. Descartar duplicados y detectar lecturas fuera de orden.
+		// Una lectura atrasada se guarda, pero no altera el estado ni la tasa de cambio.
+		last, seen := lastStates[dp.SensorID]
+		outOfOrder := false
+		if seen && !dp.Timestamp.After(last.at) {
+			if dp.Timestamp.Equal(last.at) && dp.Temperature == last.raw {
+				continue
+			}
+			outOfOrder = true
+		}
+
+		// Validar calidad: una lectura sospechosa se guarda marcada, pero no se evalúa.
+		// Sí se recuerda para descartar su reenvío; la tasa de cambio sigue con la última válida.
+		quality, faultReason := validator.check(dp, outOfOrder)
+		if quality != QualityOK {
+			if !outOfOrder {
+				last.raw, last.at = dp.Temperature, dp.Timestamp
+				lastStates[dp.SensorID] = last
+			}
+
+			if faultReason != "" {
+				lastTime, exists := lastMaintenanceAlert[dp.SensorID]
+				if !exists || dp.Timestamp.Sub(lastTime) > 30*time.Minute {
+					raiseMaintenanceAlert(dp, sink, faultReason)
+					lastMaintenanceAlert[dp.SensorID] = dp.Timestamp
+				}
+			}
+
+			if err := sink.insertReading(dp, dp.Temperature, 0, "SOSPECHOSO", quality); err != nil {
+				fmt.Printf("Error DB: %v\n", err)
+			}
+			continue
+		}
+
+		// Aplicar la calibración vigente; el valor crudo se conserva en raw_temperature
+		rawTemperature := dp.Temperature
+		dp.Temperature = calibrations.apply(dp.SensorID, rawTemperature, dp.Timestamp)
+
 		// 1. Calcular tasa de cambio instantánea (dT/dt)
 		rateOfChange := 0.0
-		if last, ok := lastStates[dp.SensorID]; ok {
+		if seen && !outOfOrder && !last.time.IsZero() {
 			durationMinutes := dp.Timestamp.Sub(last.time).Minutes()
 			if durationMinutes > 0 {
 				rateOfChange = (dp.Temperature - last.temp) / durationMinutes
 			}
 		}
 		// Guardar estado actual para la próxima lectura
-		lastStates[dp.SensorID] = sensorState{temp: dp.Temperature, time: dp.Timestamp}
+		if !outOfOrder {
+			lastStates[dp.SensorID] = sensorState{temp: dp.Temperature, time: dp.Timestamp, raw: rawTemperature, at: dp.Timestamp}
+		}
 
+		// 2. Evaluar contra el rango seguro de la configuración vigente (ver safeBand)
+		band, hasBand := bands.get(dp.SensorID)
 		status := "NORMAL"
 		isCritical := false
-		
-		if dp.SensorID == "CF-1" && dp.Temperature > -18.0 {
-			status = "CRÍTICO"
-			isCritical = true
-		} else if dp.SensorID == "CF-2" && dp.Temperature > 8.0 {
-			status = "CRÍTICO"
-			isCritical = true
-		} else if dp.SensorID == "CF-1" && dp.Temperature > -19.0 {
-			status = "ADVERTENCIA"
+		if hasBand {
+			if excess, _, _ := band.excess(dp.Temperature); excess > 0 {
+				status = "CRÍTICO"
+				isCritical = true
+			} else if dp.Temperature > band.warning {
+				status = "ADVERTENCIA"
+			}
+		}
+
+		// Un descongelamiento reconocido suspende las alertas de umbral hasta que la cámara se recupera
+		defrosting := defrosts.suppressing(dp)
+
+		// Abrir/cerrar excursiones antes de alertar, para que la alerta quede vinculada
+		if !outOfOrder {
+			defrosting = defrosts.observe(dp, sink)
+			excursions.observe(dp, sink, defrosting)
+			if !defrosting {
+				forecasts.observe(dp, sink)
+				anomalies.observe(dp, sink)
+			}
 		}
 
-		if isCritical {
+		// Una configuración deshabilitada deja el estado y las excursiones, pero no alerta
+		if isCritical && !defrosting && band.alertsEnabled {
 			lastTime, exists := lastAlertTime[dp.SensorID]
-			// En modo normal, alerta cada 2 minutos
-			if !exists || time.Since(lastTime) > 2*time.Minute {
-				createAlert(dp)
-				lastAlertTime[dp.SensorID] = time.Now()
+			// En modo normal, alerta cada 2 minutos.
+			// Se usa el tiempo de la lectura y no el reloj, para que un replay
+			// acelerado deduplique igual que el flujo original.
+			if !exists || dp.Timestamp.Sub(lastTime) > 2*time.Minute {
+				createAlert(dp, sink, band)
+				lastAlertTime[dp.SensorID] = dp.Timestamp
 			}
 		}
 
-		query := `
-			INSERT INTO temperature_readings (sensor_id, temperature, rate_of_change, status, timestamp) 
-			VALUES (?, ?, ?, ?, ?)`
-		
-		_, err := db.DB.Exec(query, dp.SensorID, dp.Temperature, rateOfChange, status, dp.Timestamp)
-		if err != nil {
+		if err := sink.insertReading(dp, rawTemperature, rateOfChange, status, quality); err != nil {
 			fmt.Printf("Error DB: %v\n", err)
 			continue
 		}
 
+		// El snapshot de la cámara solo refleja la lectura más reciente
+		if !sink.updateChambers || outOfOrder {
+			continue
+		}
+
 		// Actualizar cámara
 		chamberStatus := 0
 		if status != "NORMAL" {
@@ -118,21 +234,34 @@ func processSensorData(dataChan <-chan DataPoint) {
 	}
 }
 
-func createAlert(dp DataPoint) {
-	alertID := "ALT-" + uuid.New().String()[:8]
+func createAlert(dp DataPoint, sink dataSink, band safeBand) {
 	title := fmt.Sprintf("ALERTA CRÍTICA: %s", dp.SensorID)
 	desc := fmt.Sprintf("Temperatura crítica: %.1f°C", dp.Temperature)
-	
-	query := `
-		INSERT INTO alerts (id, title, description, priority, type, sensor_id, is_read, estimated_cost, timestamp)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`
-	
-	estCost := 0.0
-	if dp.SensorID == "CF-1" {
-		estCost = 15000.0
+
+	// El costo estimado es el valor de lo que había en la cámara al momento de la lectura
+	var impact alertImpact
+	impact.estCost, impact.affectedContent = estimateLoss(dp)
+
+	// La acción sugerida sale de las reglas de deterioro de cada producto en la cámara
+	assessment, err := assessSpoilage(dp.SensorID, dp.Timestamp, sink, &riskPoint{at: dp.Timestamp, temp: dp.Temperature})
+	if err != nil {
+		fmt.Printf("Error evaluando deterioro de %s: %v\n", dp.SensorID, err)
+	} else if assessment.SuggestedAction != "" {
+		impact.suggestedAction = &assessment.SuggestedAction
 	}
 
-	db.DB.Exec(query, alertID, title, desc, 0, 0, dp.SensorID, false, estCost, dp.Timestamp)
-	fmt.Printf("🚨 ALERTA CREADA: %s (%.1f°C)\n", dp.SensorID, dp.Temperature)
+	raiseAlert(dp, sink, models.AlertPriorityP1, models.AlertTypeTemperatureCritical, title, desc, impact, band.revision)
+}
+
+// raiseAlert persiste una alerta de cualquier tipo en el destino indicado. configRevision es la
+// revisión de alert_configs cuyos umbrales la dispararon (nil si no depende de la configuración),
+// la misma que usó la lectura, así un replay con otra configuración se compara revisión a revisión.
+func raiseAlert(dp DataPoint, sink dataSink, priority, alertType int, title, desc string, impact alertImpact, configRevision *int) {
+	alertID := "ALT-" + uuid.New().String()[:8]
+
+	if err := sink.insertAlert(alertID, title, desc, priority, alertType, dp, impact, configRevision); err != nil {
+		fmt.Printf("Error DB: %v\n", err)
+		return
+	}
+	fmt.Printf("🚨 ALERTA CREADA: %s - %s\n", dp.SensorID, title)
 }
\ No newline at end of file
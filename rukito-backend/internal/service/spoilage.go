@@ -0,0 +1,273 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// spoilageWindow es el período de lecturas sobre el que se acumula la exposición de cada producto
+const spoilageWindow = 24 * time.Hour
+
+// Umbrales del puntaje de riesgo para recomendar un destino
+const (
+	riskMoveAt    = 0.5 // desde aquí conviene trasladar el producto y priorizar su uso
+	riskDiscardAt = 1.0 // vida útil agotada
+)
+
+// spoilageTemplate son las reglas de deterioro por defecto de una categoría de producto
+type spoilageTemplate struct {
+	safeMin         float64
+	hasMin          bool // sin límite inferior, el frío extra no deteriora el producto
+	safeMax         float64
+	maxExposure     float64 // minutos
+	degradationRate float64 // fracción de vida útil por °C·h
+}
+
+var spoilageTemplates = map[string]spoilageTemplate{
+	models.ProductCategoryFrozenMeat: {safeMax: -15, maxExposure: 240, degradationRate: 0.05},
+	models.ProductCategoryDairy:      {safeMin: 0, hasMin: true, safeMax: 7, maxExposure: 120, degradationRate: 0.10},
+	models.ProductCategoryVegetables: {safeMin: 0, hasMin: true, safeMax: 8, maxExposure: 240, degradationRate: 0.04},
+	models.ProductCategoryGeneral:    {safeMin: 0, hasMin: true, safeMax: 8, maxExposure: 120, degradationRate: 0.08},
+}
+
+// ProductRulesFor combina las reglas propias del producto (NULL = no definida) con las de su categoría
+func ProductRulesFor(category string, safeMin, safeMax, maxExposure, degradationRate sql.NullFloat64) models.ProductRules {
+	t, ok := spoilageTemplates[category]
+	if !ok {
+		t = spoilageTemplates[models.ProductCategoryGeneral]
+	}
+
+	rules := models.ProductRules{
+		SafeMax:            t.safeMax,
+		MaxExposureMinutes: t.maxExposure,
+		DegradationRate:    t.degradationRate,
+		Source:             "category",
+	}
+	if t.hasMin {
+		val := t.safeMin
+		rules.SafeMin = &val
+	}
+
+	if safeMin.Valid {
+		val := safeMin.Float64
+		rules.SafeMin = &val
+	}
+	if safeMax.Valid {
+		rules.SafeMax = safeMax.Float64
+	}
+	if maxExposure.Valid {
+		rules.MaxExposureMinutes = maxExposure.Float64
+	}
+	if degradationRate.Valid {
+		rules.DegradationRate = degradationRate.Float64
+	}
+	if safeMin.Valid || safeMax.Valid || maxExposure.Valid || degradationRate.Valid {
+		rules.Source = "product"
+	}
+	return rules
+}
+
+// riskPoint es una lectura válida usada para acumular exposición
+type riskPoint struct {
+	at   time.Time
+	temp float64
+}
+
+// outsideBy devuelve cuántos grados está temp fuera del rango seguro del producto (0 si está dentro)
+func outsideBy(r models.ProductRules, temp float64) float64 {
+	if temp > r.SafeMax {
+		return temp - r.SafeMax
+	}
+	if r.SafeMin != nil && temp < *r.SafeMin {
+		return *r.SafeMin - temp
+	}
+	return 0
+}
+
+// score acumula la exposición del producto y deriva su riesgo: el mayor entre la fracción
+// de exposición tolerada consumida y la vida útil perdida por grados-hora
+func score(p *models.ProductRisk, points []riskPoint) {
+	for i := 1; i < len(points); i++ {
+		dt := points[i].at.Sub(points[i-1].at)
+		// Sin lecturas no se puede afirmar que siguió fuera de rango (igual que las excursiones)
+		if dt <= 0 || dt > excursionMaxGap {
+			continue
+		}
+		prev, cur := outsideBy(p.Rules, points[i-1].temp), outsideBy(p.Rules, points[i].temp)
+		if prev > 0 {
+			p.ExposureMinutes += dt.Minutes()
+		}
+		p.DegreeHours += (prev + cur) / 2 * dt.Hours()
+	}
+
+	risk := p.DegreeHours * p.Rules.DegradationRate
+	if p.Rules.MaxExposureMinutes > 0 {
+		risk = math.Max(risk, p.ExposureMinutes/p.Rules.MaxExposureMinutes)
+	}
+	p.RiskScore = math.Min(risk, 1)
+
+	switch {
+	case p.RiskScore >= riskDiscardAt:
+		p.Disposition = models.DispositionDiscarded
+	case p.RiskScore >= riskMoveAt:
+		p.Disposition = models.DispositionMoved
+	default:
+		p.Disposition = models.DispositionKept
+	}
+}
+
+// dispositionSeverity ordena los destinos de más a menos severo para la recomendación
+var dispositionSeverity = []struct {
+	disposition string
+	verb        string
+}{
+	{models.DispositionDiscarded, "Descartar"},
+	{models.DispositionMoved, "Trasladar y priorizar"},
+	{models.DispositionKept, "Conservar"},
+}
+
+// suggestedAction arma la recomendación, p. ej.
+// "Descartar Queso fresco (100%); Conservar Leche entera (20%)"
+func suggestedAction(products []models.ProductRisk) string {
+	var groups []string
+	for _, d := range dispositionSeverity {
+		var names []string
+		for _, p := range products {
+			if p.Disposition == d.disposition {
+				names = append(names, fmt.Sprintf("%s (%.0f%%)", p.Name, p.RiskScore*100))
+			}
+		}
+		if len(names) > 0 {
+			groups = append(groups, d.verb+" "+strings.Join(names, ", "))
+		}
+	}
+	return strings.Join(groups, "; ")
+}
+
+// AssessSpoilage evalúa el contenido de una cámara en el instante at contra las reglas de cada producto
+func AssessSpoilage(sensorID string, at time.Time) (models.SpoilageAssessment, error) {
+	return assessSpoilage(sensorID, at, liveSink, nil)
+}
+
+// assessSpoilage lee las lecturas del destino indicado (vivo o replay); current es la
+// lectura en proceso, que todavía no está guardada
+func assessSpoilage(sensorID string, at time.Time, sink dataSink, current *riskPoint) (models.SpoilageAssessment, error) {
+	a := models.SpoilageAssessment{SensorID: sensorID, WindowStart: at.Add(-spoilageWindow), At: at, Disposition: models.DispositionKept}
+
+	products, err := loadProductRisks(sensorID, at)
+	if err != nil {
+		return a, err
+	}
+	points, err := sink.riskPoints(sensorID, a.WindowStart, at)
+	if err != nil {
+		return a, err
+	}
+	if current != nil && (len(points) == 0 || current.at.After(points[len(points)-1].at)) {
+		points = append(points, *current)
+	}
+
+	for i := range products {
+		p := &products[i]
+		score(p, points)
+		a.ValueAtRisk += p.Value * p.RiskScore
+		// El puntaje define el destino, así que el mayor puntaje da también el destino más severo
+		if p.RiskScore > a.RiskScore {
+			a.RiskScore = p.RiskScore
+			a.Disposition = p.Disposition
+		}
+	}
+	a.Products = products
+	a.SuggestedAction = suggestedAction(products)
+	return a, nil
+}
+
+// loadProductRisks devuelve los productos en la cámara en el instante at con sus reglas.
+// Una cámara sin inventario registrado se evalúa como un único producto: su contenido declarado.
+func loadProductRisks(sensorID string, at time.Time) ([]models.ProductRisk, error) {
+	rows, err := db.DB.Query(`
+		SELECT p.id, p.name, p.category, p.price_per_kg, p.safe_min_temperature, p.safe_max_temperature, p.max_exposure_minutes, p.degradation_rate,
+			`+stockQuantity+` AS quantity
+		FROM stock_movements m
+		JOIN products p ON p.id = m.product_id
+		WHERE m.sensor_id = ? AND m.moved_at <= ?
+		GROUP BY p.id, p.name, p.category, p.price_per_kg, p.safe_min_temperature, p.safe_max_temperature, p.max_exposure_minutes, p.degradation_rate
+		HAVING quantity > 0
+		ORDER BY p.name`, sensorID, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.ProductRisk{}
+	for rows.Next() {
+		var p models.ProductRisk
+		var id string
+		var price float64
+		var safeMin, safeMax, maxExposure, degradationRate sql.NullFloat64
+		if err := rows.Scan(&id, &p.Name, &p.Category, &price, &safeMin, &safeMax, &maxExposure, &degradationRate, &p.QuantityKg); err != nil {
+			return nil, err
+		}
+		p.ProductID = &id
+		p.Value = p.QuantityKg * price
+		p.Rules = ProductRulesFor(p.Category, safeMin, safeMax, maxExposure, degradationRate)
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(products) > 0 {
+		return products, nil
+	}
+
+	var chamber models.ColdChamber
+	err = db.DB.QueryRow(`SELECT COALESCE(content, ''), COALESCE(product_category, '') FROM chambers WHERE id = ?`, sensorID).
+		Scan(&chamber.Content, &chamber.ProductCategory)
+	if err != nil {
+		return nil, err
+	}
+	p := models.ProductRisk{Name: chamber.Content, Category: ProductCategoryFor(chamber)}
+	if p.Name == "" {
+		p.Name = "Contenido de la cámara"
+	}
+	var none sql.NullFloat64
+	p.Rules = ProductRulesFor(p.Category, none, none, none, none)
+	return []models.ProductRisk{p}, nil
+}
+
+// riskPoints devuelve las lecturas válidas de un sensor entre from y to
+func (s dataSink) riskPoints(sensorID string, from, to time.Time) ([]riskPoint, error) {
+	query := `
+		SELECT timestamp, temperature FROM temperature_readings
+		WHERE sensor_id = ? AND quality = 'OK' AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp`
+	args := []interface{}{sensorID, from, to}
+	if s.runID != "" {
+		query = `
+			SELECT timestamp, temperature FROM replay_readings
+			WHERE run_id = ? AND sensor_id = ? AND quality = 'OK' AND timestamp BETWEEN ? AND ?
+			ORDER BY timestamp`
+		args = append([]interface{}{s.runID}, args...)
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []riskPoint
+	for rows.Next() {
+		var p riskPoint
+		if err := rows.Scan(&p.at, &p.temp); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/angello/rukito-backend/internal/models"
+)
+
+// series arma lecturas cada minuto con las temperaturas dadas
+func series(temps ...float64) []riskPoint {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	points := make([]riskPoint, len(temps))
+	for i, temp := range temps {
+		points[i] = riskPoint{at: start.Add(time.Duration(i) * time.Minute), temp: temp}
+	}
+	return points
+}
+
+func TestScore(t *testing.T) {
+	min := 0.0
+	dairy := models.ProductRules{SafeMin: &min, SafeMax: 4, MaxExposureMinutes: 120, DegradationRate: 0.05}
+	frozen := models.ProductRules{SafeMax: -15, MaxExposureMinutes: 240, DegradationRate: 0.02}
+	fish := models.ProductRules{SafeMin: &min, SafeMax: 4, MaxExposureMinutes: 120, DegradationRate: 0.3}
+
+	gap := series(-18, -10)
+	gap[1].at = gap[0].at.Add(excursionMaxGap + time.Minute)
+
+	tests := []struct {
+		name            string
+		rules           models.ProductRules
+		points          []riskPoint
+		exposureMinutes float64
+		degreeHours     float64
+		risk            float64
+		disposition     string
+	}{
+		{"inside the safe range", dairy, series(2, 3, 3.5, 2), 0, 0, 0, models.DispositionKept},
+		// 2°C sobre el máximo durante 60 min: 60/120 de exposición y 2 °C·h · 0.05
+		{"exposure drives the risk", dairy, series(append([]float64{6}, repeat(6, 60)...)...), 60, 2, 0.5, models.DispositionMoved},
+		// 1 min de 4 a 24°C y 10 min a 24°C: 10/60 °C·h (trapecio) + 20 · 10/60 °C·h = 3.5 °C·h
+		{"degree-hours drive the risk", dairy, series(append([]float64{4}, repeat(24, 11)...)...), 10, 3.5, 0.175, models.DispositionKept},
+		// 3.5 °C·h · 0.3 = 1.05, acotado a 1
+		{"risk is capped at 1", fish, series(append([]float64{4}, repeat(24, 11)...)...), 10, 3.5, 1, models.DispositionDiscarded},
+		{"below the safe minimum", dairy, series(-2, -2, -2), 2, 2.0 / 30, 2.0 / 120, models.DispositionKept},
+		{"no lower limit", frozen, series(-40, -40, -40), 0, 0, 0, models.DispositionKept},
+		{"a gap is not exposure", frozen, gap, 0, 0, 0, models.DispositionKept},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := models.ProductRisk{Rules: tt.rules}
+			score(&p, tt.points)
+			if math.Abs(p.ExposureMinutes-tt.exposureMinutes) > 1e-9 {
+				t.Errorf("ExposureMinutes = %v, want %v", p.ExposureMinutes, tt.exposureMinutes)
+			}
+			if math.Abs(p.DegreeHours-tt.degreeHours) > 1e-9 {
+				t.Errorf("DegreeHours = %v, want %v", p.DegreeHours, tt.degreeHours)
+			}
+			if math.Abs(p.RiskScore-tt.risk) > 1e-9 {
+				t.Errorf("RiskScore = %v, want %v", p.RiskScore, tt.risk)
+			}
+			if p.Disposition != tt.disposition {
+				t.Errorf("Disposition = %q, want %q", p.Disposition, tt.disposition)
+			}
+		})
+	}
+}
+
+func repeat(temp float64, n int) []float64 {
+	temps := make([]float64, n)
+	for i := range temps {
+		temps[i] = temp
+	}
+	return temps
+}
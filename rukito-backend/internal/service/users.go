@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/angello/rukito-backend/internal/auth"
+	"github.com/angello/rukito-backend/internal/db"
+	"github.com/google/uuid"
+)
+
+// EnsureOwnerAccount crea la cuenta owner inicial desde ADMIN_USERNAME / ADMIN_PASSWORD
+// cuando la tabla users está vacía. Sin esas variables no se crea nada.
+func EnsureOwnerAccount() {
+	var count int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		fmt.Printf("Error revisando usuarios: %v\n", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+
+	username, password := os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		fmt.Println("⚠️  No hay usuarios registrados. Defina ADMIN_USERNAME y ADMIN_PASSWORD para crear el owner inicial")
+		return
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		fmt.Printf("Error creando owner inicial: %v\n", err)
+		return
+	}
+
+	_, err = db.DB.Exec(`INSERT INTO users (id, username, full_name, password_hash, role) VALUES (?, ?, ?, ?, ?)`,
+		"USR-"+uuid.New().String()[:8], username, username, hash, auth.RoleOwner)
+	if err != nil {
+		fmt.Printf("Error creando owner inicial: %v\n", err)
+		return
+	}
+
+	fmt.Printf("👤 Owner inicial creado: %s\n", username)
+}
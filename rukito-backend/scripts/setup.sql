@@ -4,6 +4,22 @@
 CREATE DATABASE IF NOT EXISTS rukito;
 USE rukito;
 
+-- 0. Organizaciones y Locales (multi-local)
+CREATE TABLE IF NOT EXISTS organizations (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS locations (
+    id VARCHAR(50) PRIMARY KEY,
+    organization_id VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    address VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
+
 -- 1. Tabla de Cámaras Frigoríficas
 CREATE TABLE IF NOT EXISTS chambers (
     id VARCHAR(50) PRIMARY KEY,
@@ -12,20 +28,27 @@ CREATE TABLE IF NOT EXISTS chambers (
     target_temperature DECIMAL(5,2) NOT NULL,
     critical_threshold DECIMAL(5,2) NOT NULL,
     warning_threshold DECIMAL(5,2) NOT NULL,
-    location VARCHAR(255),
+    location VARCHAR(255),    -- descripción libre dentro del local (ej. 'Sala Principal')
+    location_id VARCHAR(50),  -- local al que pertenece la cámara
+    product_category VARCHAR(30), -- frozen_meat, dairy, vegetables, general (plantilla de alertas)
+    forecast_lead_minutes INT NULL, -- anticipación del aviso de cruce previsto; NULL = FORECAST_LEAD_MINUTES
     is_active BOOLEAN DEFAULT TRUE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (location_id) REFERENCES locations(id)
 );
 
 -- 2. Tabla de Lecturas de Temperatura
 CREATE TABLE IF NOT EXISTS temperature_readings (
     id INT AUTO_INCREMENT PRIMARY KEY,
     sensor_id VARCHAR(50),
-    temperature DECIMAL(5,2) NOT NULL,
+    temperature DECIMAL(5,2) NOT NULL,      -- valor corregido por calibración
+    raw_temperature DECIMAL(5,2),           -- valor crudo reportado por la sonda
     rate_of_change DECIMAL(5,2) DEFAULT 0.00,
     status VARCHAR(20) DEFAULT 'NORMAL',
+    quality VARCHAR(20) DEFAULT 'OK', -- OK, SENTINEL, OUT_OF_RANGE, SPIKE, STUCK
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_readings_sensor_time (sensor_id, timestamp, id), -- paginación por cursor
     FOREIGN KEY (sensor_id) REFERENCES chambers(id)
 );
 
@@ -38,9 +61,16 @@ CREATE TABLE IF NOT EXISTS alerts (
     type INT NOT NULL,     -- Enum de tipos
     sensor_id VARCHAR(50),
     is_read BOOLEAN DEFAULT FALSE,
-    estimated_cost DECIMAL(10,2),
+    estimated_cost DECIMAL(10,2),     -- valor del inventario en la cámara al disparar
+    affected_content TEXT,            -- productos y kilos en la cámara al disparar
+    suggested_action TEXT,            -- destino recomendado según las reglas de cada producto
+    config_revision INT NULL, -- revisión de alert_configs activa al disparar
+    excursion_id VARCHAR(50) NULL, -- excursión abierta al disparar (ver excursions)
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_alerts_time (timestamp, id),                  -- paginación por cursor
+    INDEX idx_alerts_sensor_time (sensor_id, timestamp, id),
+    INDEX idx_alerts_excursion (excursion_id),
     FOREIGN KEY (sensor_id) REFERENCES chambers(id)
 );
 
@@ -51,23 +81,368 @@ CREATE TABLE IF NOT EXISTS alert_configs (
     max_temperature DECIMAL(5,2) NOT NULL,
     min_temperature DECIMAL(5,2) NOT NULL,
     rate_of_change_threshold DECIMAL(5,2) NOT NULL,
-    priority INT NOT NULL, -- 0=low, 1=med, 2=high
+    priority INT NOT NULL, -- 0=P1 (más alta), 1=P2, 2=P3
     is_enabled BOOLEAN DEFAULT TRUE,
     notification_channels JSON, -- Almacena ['sms', 'push', etc]
     recipients JSON,            -- Almacena ['+593...', etc]
+    revision INT NOT NULL DEFAULT 1, -- revisión vigente (ver alert_config_revisions)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id)
+);
+
+-- Historial inmutable de la configuración: cada cambio crea una revisión nueva
+CREATE TABLE IF NOT EXISTS alert_config_revisions (
+    sensor_id VARCHAR(50) NOT NULL,
+    revision INT NOT NULL,
+    max_temperature DECIMAL(5,2) NOT NULL,
+    min_temperature DECIMAL(5,2) NOT NULL,
+    rate_of_change_threshold DECIMAL(5,2) NOT NULL,
+    priority INT NOT NULL,
+    is_enabled BOOLEAN NOT NULL,
+    notification_channels JSON,
+    recipients JSON,
+    created_by VARCHAR(50) NULL,      -- usuario que creó la revisión (NULL = sistema)
+    rolled_back_from INT NULL,        -- revisión restaurada, si fue un rollback
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sensor_id, revision),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id)
+);
+
+-- 5. Tablas de Replay (re-ejecución de lecturas grabadas con reglas nuevas)
+CREATE TABLE IF NOT EXISTS replay_runs (
+    id VARCHAR(50) PRIMARY KEY,
+    source VARCHAR(255) NOT NULL, -- ruta del archivo o rango 'db:desde..hasta'
+    speed DECIMAL(10,2) NOT NULL, -- 0 = máxima velocidad
+    total_points INT NOT NULL,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS replay_readings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    run_id VARCHAR(50) NOT NULL,
+    sensor_id VARCHAR(50),
+    temperature DECIMAL(5,2) NOT NULL,
+    raw_temperature DECIMAL(5,2),
+    rate_of_change DECIMAL(5,2) DEFAULT 0.00,
+    status VARCHAR(20) DEFAULT 'NORMAL',
+    quality VARCHAR(20) DEFAULT 'OK',
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_replay_readings_run (run_id, sensor_id, timestamp),
+    FOREIGN KEY (run_id) REFERENCES replay_runs(id)
+);
+
+CREATE TABLE IF NOT EXISTS replay_alerts (
+    id VARCHAR(50) PRIMARY KEY,
+    run_id VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    priority INT NOT NULL,
+    type INT NOT NULL,
+    sensor_id VARCHAR(50),
+    estimated_cost DECIMAL(10,2),
+    affected_content TEXT,
+    suggested_action TEXT,
+    config_revision INT NULL,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_replay_alerts_run (run_id, timestamp),
+    FOREIGN KEY (run_id) REFERENCES replay_runs(id)
+);
+
+-- 6. Calibraciones de Sondas (contra termómetro de referencia)
+CREATE TABLE IF NOT EXISTS sensor_calibrations (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    calibrated_at TIMESTAMP NOT NULL,
+    reference_value DECIMAL(5,2) NOT NULL, -- lectura del termómetro patrón
+    measured_value DECIMAL(5,2) NOT NULL,  -- lectura de la sonda en ese momento
+    offset DECIMAL(6,3) NOT NULL,          -- corregido = crudo * gain + offset
+    gain DECIMAL(6,4) NOT NULL DEFAULT 1.0000,
+    technician VARCHAR(255) NOT NULL,
+    notes TEXT,
+    next_due_at TIMESTAMP NULL,            -- vencimiento indicado por el técnico; NULL = calibrated_at + CALIBRATION_INTERVAL_DAYS
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_calibrations_sensor (sensor_id, calibrated_at),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id)
+);
+
+-- 7. Usuarios y Roles (el primer owner se crea con ADMIN_USERNAME / ADMIN_PASSWORD)
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(50) PRIMARY KEY,
+    username VARCHAR(100) NOT NULL UNIQUE,
+    full_name VARCHAR(255),
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL, -- owner, manager, staff, readonly
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP NULL
+);
+
+-- Locales asignados a cada usuario (los owners ven todos)
+CREATE TABLE IF NOT EXISTS user_locations (
+    user_id VARCHAR(50) NOT NULL,
+    location_id VARCHAR(50) NOT NULL,
+    PRIMARY KEY (user_id, location_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (location_id) REFERENCES locations(id)
+);
+
+-- 8. Registro de Dispositivos (credenciales de ingestión por red)
+CREATE TABLE IF NOT EXISTS devices (
+    id VARCHAR(50) PRIMARY KEY,
+    chamber_id VARCHAR(50) NOT NULL,       -- cámara a la que está vinculado
+    name VARCHAR(255) NOT NULL,
+    api_key_hash CHAR(64) NOT NULL,        -- SHA-256 de la API key vigente
+    previous_key_hash CHAR(64),            -- key anterior, válida hasta previous_key_expires_at
+    previous_key_expires_at TIMESTAMP NULL,
+    key_rotated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP NULL,
+    last_seen_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (chamber_id) REFERENCES chambers(id)
+);
+
+CREATE TABLE IF NOT EXISTS device_rejections (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    device_id VARCHAR(50),
+    sensor_id VARCHAR(50),
+    remote_addr VARCHAR(100),
+    reason VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_rejections_device (device_id, created_at)
+);
+
+-- 9. Log de Auditoría (append-only: los triggers impiden modificar o borrar entradas)
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor_id VARCHAR(50),               -- NULL si no hay usuario autenticado (ej. login fallido)
+    actor_username VARCHAR(100),
+    action VARCHAR(50) NOT NULL,        -- config.update, alert.acknowledge, chamber.update, auth.login, ...
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(100) NOT NULL,
+    location_id VARCHAR(50),            -- local afectado, para filtrar por alcance del usuario
+    before_data JSON,
+    after_data JSON,
+    changes JSON,                       -- {"campo": {"from": ..., "to": ...}}
+    remote_addr VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_entity (entity_type, entity_id, created_at),
+    INDEX idx_audit_actor (actor_id, created_at)
+);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+-- 10. Excursiones (período continuo fuera del rango seguro; se abren y cierran en el pipeline)
+CREATE TABLE IF NOT EXISTS excursions (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    direction VARCHAR(4) NOT NULL,         -- high (sobre critical_threshold), low (bajo min_temperature)
+    threshold DECIMAL(5,2) NOT NULL,       -- límite cruzado
+    started_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP NULL,               -- NULL mientras sigue abierta
+    last_reading_at TIMESTAMP NOT NULL,
+    peak_temperature DECIMAL(5,2) NOT NULL,
+    degree_minutes DECIMAL(10,2) NOT NULL DEFAULT 0, -- integral del exceso sobre el límite (°C·min)
+    mkt DECIMAL(5,2) NULL,                 -- temperatura cinética media durante la excursión
+    activation_energy DECIMAL(7,3) NULL,   -- kJ/mol usada para mkt (ver product_categories)
+    reading_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_excursions_sensor (sensor_id, started_at, id),
+    INDEX idx_excursions_time (started_at, id),
+    INDEX idx_excursions_open (sensor_id, ended_at),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id)
+);
+
+-- 11. Acciones Correctivas (HACCP: toda excursión debe tener una acción documentada)
+-- Se vinculan a una alerta, a una excursión registrada o a una excursión por su inicio (cámara + excursion_start)
+CREATE TABLE IF NOT EXISTS corrective_actions (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    alert_id VARCHAR(50),
+    excursion_id VARCHAR(50),
+    excursion_start TIMESTAMP NULL,
+    action TEXT NOT NULL,                  -- qué se hizo
+    disposition VARCHAR(20) NOT NULL,      -- destino del producto: kept, moved, discarded
+    performed_by VARCHAR(255) NOT NULL,    -- quién lo hizo
+    performed_at TIMESTAMP NOT NULL,       -- cuándo
+    notes TEXT,
+    recorded_by VARCHAR(50),               -- usuario que lo registró
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_corrective_sensor (sensor_id, performed_at),
+    INDEX idx_corrective_alert (alert_id),
+    INDEX idx_corrective_excursion (excursion_id),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id),
+    FOREIGN KEY (alert_id) REFERENCES alerts(id),
+    FOREIGN KEY (excursion_id) REFERENCES excursions(id)
+);
+
+-- 12. Inventario: catálogo de productos, lotes y movimientos de stock por cámara
+-- El contenido de una cámara en cualquier momento es la suma de sus movimientos hasta ese instante
+CREATE TABLE IF NOT EXISTS product_categories (
+    category VARCHAR(50) PRIMARY KEY,      -- frozen_meat, dairy, vegetables, general
+    activation_energy DECIMAL(7,3) NOT NULL DEFAULT 83.144, -- kJ/mol (ΔH) para la temperatura cinética media
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS products (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    category VARCHAR(50) NOT NULL,         -- frozen_meat, dairy, vegetables, general
+    price_per_kg DECIMAL(10,2) NOT NULL,
+    -- Reglas de deterioro; NULL = valor por defecto de la categoría
+    safe_min_temperature DECIMAL(5,2) NULL,
+    safe_max_temperature DECIMAL(5,2) NULL,
+    max_exposure_minutes INT NULL,          -- exposición acumulada tolerada fuera del rango seguro
+    degradation_rate DECIMAL(6,4) NULL,     -- fracción de vida útil perdida por °C·h fuera del rango
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Un lote se pone en cuarentena cuando una excursión agota los límites de su producto;
+-- queda bloqueado hasta que alguien lo libera o descarta con una justificación
+CREATE TABLE IF NOT EXISTS lots (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    lot_code VARCHAR(100),                 -- código del lote del proveedor
+    supplier VARCHAR(255) NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    quantity_kg DECIMAL(10,3) NOT NULL,    -- cantidad recibida
+    status VARCHAR(20) NOT NULL DEFAULT 'available', -- available, quarantined, released, discarded
+    quarantined_at TIMESTAMP NULL,
+    quarantine_excursion_id VARCHAR(50) NULL,
+    quarantine_reason TEXT,
+    resolved_at TIMESTAMP NULL,
+    resolved_by VARCHAR(50),
+    resolution TEXT,                       -- justificación de la liberación o el descarte
+    notes TEXT,
+    recorded_by VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_lots_sensor_status (sensor_id, status),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (quarantine_excursion_id) REFERENCES excursions(id)
+);
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    product_id VARCHAR(50) NOT NULL,
+    lot_id VARCHAR(50) NULL,               -- lote afectado, si se conoce
+    type VARCHAR(10) NOT NULL,             -- in (ingreso), out (salida)
+    quantity_kg DECIMAL(10,3) NOT NULL,    -- siempre positiva; el tipo da el sentido
+    moved_at TIMESTAMP NOT NULL,
+    notes TEXT,
+    recorded_by VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_stock_sensor_time (sensor_id, moved_at),
+    INDEX idx_stock_lot (lot_id),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (lot_id) REFERENCES lots(id)
+);
+
+-- 13. Descongelamiento: ciclos programados por cámara y ciclos reconocidos por el pipeline
+-- Durante un ciclo se suspenden las alertas de umbral hasta que la cámara vuelve bajo el umbral de advertencia
+CREATE TABLE IF NOT EXISTS defrost_schedules (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    start_time TIME NOT NULL,              -- hora local (EXPORT_TIMEZONE), todos los días
+    duration_minutes INT NOT NULL,         -- duración del calentamiento
+    recovery_minutes INT NOT NULL DEFAULT 30, -- tiempo tolerado tras el calentamiento para recuperarse
+    max_temperature DECIMAL(5,2) NULL,     -- sobre este valor se alerta igual; NULL = critical_threshold + 10
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    notes TEXT,
+    recorded_by VARCHAR(50),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_defrost_schedules_sensor (sensor_id),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id)
+);
+
+CREATE TABLE IF NOT EXISTS defrost_cycles (
+    id VARCHAR(50) PRIMARY KEY,
+    sensor_id VARCHAR(50) NOT NULL,
+    source VARCHAR(10) NOT NULL,           -- scheduled, detected (firma recurrente sin programación)
+    schedule_id VARCHAR(50) NULL,
+    started_at TIMESTAMP NOT NULL,
+    heating_until TIMESTAMP NOT NULL,      -- fin previsto del calentamiento
+    recover_by TIMESTAMP NOT NULL,         -- límite para volver bajo el umbral de advertencia
+    ended_at TIMESTAMP NULL,               -- NULL mientras sigue en curso
+    peak_temperature DECIMAL(5,2) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'in_progress', -- in_progress, recovered, prolonged
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_defrost_cycles_sensor (sensor_id, started_at),
+    INDEX idx_defrost_cycles_open (sensor_id, ended_at),
+    FOREIGN KEY (sensor_id) REFERENCES chambers(id),
+    FOREIGN KEY (schedule_id) REFERENCES defrost_schedules(id)
+);
+
+-- 14. Salud del equipo: actividad del compresor inferida del diente de sierra, por cámara y día local
+CREATE TABLE IF NOT EXISTS equipment_daily (
+    sensor_id VARCHAR(50) NOT NULL,
+    day DATE NOT NULL,                     -- día local (EXPORT_TIMEZONE)
+    cycle_count INT NOT NULL,              -- ciclos de enfriamiento completos
+    duty_cycle DECIMAL(5,4) NULL,          -- fracción del tiempo con el compresor encendido
+    pull_down_rate DECIMAL(6,3) NULL,      -- °C/min mientras enfría
+    recovery_minutes DECIMAL(7,2) NULL,    -- promedio desde el pico sobre la advertencia hasta volver bajo ella
+    recoveries INT NOT NULL DEFAULT 0,
+    covered_minutes DECIMAL(7,2) NOT NULL, -- minutos con lecturas, sin huecos
+    readings INT NOT NULL,
+    computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (sensor_id, day),
     FOREIGN KEY (sensor_id) REFERENCES chambers(id)
 );
 
 -- Datos Iniciales de Prueba (Seed Data)
-INSERT INTO chambers (id, name, content, target_temperature, critical_threshold, warning_threshold, location)
+INSERT INTO organizations (id, name)
+VALUES ('ORG-1', 'Restaurantes Don Jorge');
+
+INSERT INTO locations (id, organization_id, name, address)
+VALUES ('LOC-1', 'ORG-1', 'Local Centro', NULL);
+
+INSERT INTO chambers (id, name, content, target_temperature, critical_threshold, warning_threshold, location, location_id, product_category)
 VALUES 
-('CF-1', 'Cámara Frigorífica 1 (CF-1)', 'Carnes Prime', -20.00, -18.00, -17.00, 'Sala Principal'),
-('CF-2', 'Cámara Frigorífica 2 (CF-2)', 'Lácteos y Moros', 4.00, 8.00, 6.00, 'Sala Principal'),
-('REF-3', 'Refrigerador 3 (REF-3)', 'Vegetales', 2.00, 5.00, 3.00, 'Sala Principal');
+('CF-1', 'Cámara Frigorífica 1 (CF-1)', 'Carnes Prime', -20.00, -18.00, -19.00, 'Sala Principal', 'LOC-1', 'frozen_meat'),
+('CF-2', 'Cámara Frigorífica 2 (CF-2)', 'Lácteos y Moros', 4.00, 8.00, 6.00, 'Sala Principal', 'LOC-1', 'dairy'),
+('REF-3', 'Refrigerador 3 (REF-3)', 'Vegetales', 2.00, 5.00, 3.00, 'Sala Principal', 'LOC-1', 'vegetables');
 
 INSERT INTO alert_configs (id, sensor_id, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients)
 VALUES 
-('CONFIG-CF-1', 'CF-1', 5.00, -25.00, 0.50, 2, TRUE, '["sms", "push"]', '["+593999123456"]'),
-('CONFIG-CF-2', 'CF-2', 10.00, 0.00, 1.00, 1, TRUE, '["push"]', '["+593999000000"]');
+('CONFIG-CF-1', 'CF-1', -18.00, -25.00, 0.50, 0, TRUE, '["sms", "push"]', '["+593999123456"]'),
+('CONFIG-CF-2', 'CF-2', 8.00, 0.00, 1.00, 1, TRUE, '["push"]', '["+593999000000"]');
+
+INSERT INTO alert_config_revisions (sensor_id, revision, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients)
+SELECT sensor_id, revision, max_temperature, min_temperature, rate_of_change_threshold, priority, is_enabled, notification_channels, recipients
+FROM alert_configs;
+
+-- 83.144 kJ/mol es el valor de referencia de USP <1079>
+INSERT INTO product_categories (category, activation_energy)
+VALUES
+('frozen_meat', 83.144),
+('dairy', 83.144),
+('vegetables', 83.144),
+('general', 83.144);
+
+INSERT INTO products (id, name, category, price_per_kg)
+VALUES 
+('PRD-1', 'Lomo fino de res', 'frozen_meat', 25.50),
+('PRD-2', 'Costilla de cerdo', 'frozen_meat', 9.80),
+('PRD-3', 'Queso fresco', 'dairy', 6.40),
+('PRD-4', 'Leche entera', 'dairy', 1.10);
+
+INSERT INTO lots (id, sensor_id, product_id, lot_code, supplier, received_at, quantity_kg)
+VALUES 
+('LOT-1', 'CF-1', 'PRD-1', 'FS-2024-118', 'Frigorífico del Sur', NOW(), 200.000);
+
+INSERT INTO stock_movements (id, sensor_id, product_id, lot_id, type, quantity_kg, moved_at, notes)
+VALUES 
+('MOV-1', 'CF-1', 'PRD-1', 'LOT-1', 'in', 200.000, NOW(), 'Inventario inicial'),
+('MOV-2', 'CF-1', 'PRD-2', NULL, 'in', 120.000, NOW(), 'Inventario inicial'),
+('MOV-3', 'CF-2', 'PRD-3', NULL, 'in', 40.000, NOW(), 'Inventario inicial'),
+('MOV-4', 'CF-2', 'PRD-4', NULL, 'in', 60.000, NOW(), 'Inventario inicial');
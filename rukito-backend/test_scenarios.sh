@@ -6,14 +6,19 @@ echo "=== PRUEBA DE ESCENARIOS (CONTROLADA) ==="
 echo "Asegúrate de haber iniciado el servidor con: export SIMULATION_MODE=SCENARIO && go run cmd/server/main.go"
 echo ""
 
+TOKEN=$(curl -s -X POST "$API_URL/auth/login" \
+     -H "Content-Type: application/json" \
+     -d "{\"username\": \"${ADMIN_USERNAME:-admin}\", \"password\": \"${ADMIN_PASSWORD:-admin1234}\"}" | python3 -c "import sys, json; print(json.load(sys.stdin)['access_token'])")
+AUTH="Authorization: Bearer $TOKEN"
+
 # --- FASE 1: INICIO (0-15s) ---
 # CF-1 debería estar MAL (-16°C)
 # CF-2 debería estar BIEN (4°C)
 echo "[T=5s] Verificando estado inicial..."
 sleep 5
 
-TEMP_CF1=$(curl -s "$API_URL/chambers/CF-1" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
-TEMP_CF2=$(curl -s "$API_URL/chambers/CF-2" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
+TEMP_CF1=$(curl -s -H "$AUTH" "$API_URL/chambers/CF-1" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
+TEMP_CF2=$(curl -s -H "$AUTH" "$API_URL/chambers/CF-2" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
 
 echo "   CF-1 Temp: $TEMP_CF1 (Esperado: -16)"
 echo "   CF-2 Temp: $TEMP_CF2 (Esperado: 4)"
@@ -25,8 +30,8 @@ echo ""
 echo "[T=25s] Esperando transición de escenarios..."
 sleep 20
 
-TEMP_CF1_FINAL=$(curl -s "$API_URL/chambers/CF-1" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
-TEMP_CF2_FINAL=$(curl -s "$API_URL/chambers/CF-2" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
+TEMP_CF1_FINAL=$(curl -s -H "$AUTH" "$API_URL/chambers/CF-1" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
+TEMP_CF2_FINAL=$(curl -s -H "$AUTH" "$API_URL/chambers/CF-2" | grep "current_temperature" | awk '{print $2}' | tr -d ',')
 
 echo "   CF-1 Temp: $TEMP_CF1_FINAL (Esperado: -21 -> ARREGLADO)"
 echo "   CF-2 Temp: $TEMP_CF2_FINAL (Esperado: 10 -> FALLÓ)"
@@ -34,7 +39,7 @@ echo "   CF-2 Temp: $TEMP_CF2_FINAL (Esperado: 10 -> FALLÓ)"
 # --- VERIFICACIÓN ALERTAS ---
 echo ""
 echo "[ALERTA] Verificando si se generó alerta para CF-1..."
-ALERTS=$(curl -s "$API_URL/alerts/chamber/CF-1")
+ALERTS=$(curl -s -H "$AUTH" "$API_URL/alerts/chamber/CF-1")
 if [[ "$ALERTS" == *"ALERTA CRÍTICA"* ]]; then
     echo "✅ Alerta CF-1 Detectada."
 else